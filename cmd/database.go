@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/database/sqlitedb"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+	"github.com/nmalensek/video-uploader/internal/app/vault"
+)
+
+const (
+	databaseFile   = "file"
+	databaseSQLite = "sqlite"
+)
+
+// databaseConfig selects where upload status is saved.
+type databaseConfig struct {
+	// Type is file (uploads.json, the default) or sqlite.
+	Type string `yaml:"type"`
+	// Path is the SQLite database file, defaults to uploads.db in upload_status_path.
+	Path string `yaml:"path"`
+}
+
+// passwordVaultConfig sets where the key that encrypts saved video passwords is kept.
+type passwordVaultConfig struct {
+	// KeyPath is the key file, made with the password create-key command. It's required to save video passwords
+	// unless the key is in the VIDEO_PASSWORD_KEY environment variable.
+	KeyPath string `yaml:"key_path"`
+}
+
+// newDatastore opens the configured upload status datastore. Video passwords are encrypted before they're saved, so
+// a key is required if the config creates videos with passwords. The key is returned too, for deriving shared
+// passwords; it's nil if none is configured.
+func newDatastore(cfg uploadConfig) (database.UploadDatastore, []byte, error) {
+	var db database.UploadDatastore
+	var err error
+	switch cfg.Database.Type {
+	case "", databaseFile:
+		db, err = filedb.New(cfg.VideoStatusPath)
+	case databaseSQLite:
+		db, err = sqlitedb.New(cfg.sqlitePath())
+	default:
+		return nil, nil, fmt.Errorf("unknown database type %v, expected file or sqlite", cfg.Database.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := cfg.passwordKey()
+	if errors.Is(err, vault.ErrNoKey) {
+		// no videos get passwords, and records that already have encrypted ones fail to load instead of being used
+		// without them.
+		return vault.NewDatastore(db, vault.Vault{}), nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := vault.New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vault.NewDatastore(db, v), key, nil
+}
+
+// passwordKey loads the key that encrypts saved video passwords, which shared passwords are also derived from.
+// vault.ErrNoKey is returned if neither password_vault.key_path nor the environment variable is set and no videos get
+// passwords.
+func (c uploadConfig) passwordKey() ([]byte, error) {
+	key, err := vault.LoadKey(c.PasswordVault.KeyPath)
+	if errors.Is(err, vault.ErrNoKey) && c.needsPassword() {
+		return nil, fmt.Errorf("video passwords are saved encrypted, set password_vault.key_path to a key file made with the password create-key command, or set %v", vault.KeyEnv)
+	}
+
+	return key, err
+}
+
+// sqlitePath returns the SQLite database's path.
+func (c uploadConfig) sqlitePath() string {
+	if c.Database.Path != "" {
+		return c.Database.Path
+	}
+
+	return filepath.Join(c.VideoStatusPath, sqlitedb.DefaultFilename)
+}
+
+// runMigrateDB imports the records in uploads.json into the SQLite database. Records already in the database are
+// replaced, so it's safe to run again.
+func runMigrateDB(cfg uploadConfig, args []string) error {
+	fs := flag.NewFlagSet("migrate-db", flag.ExitOnError)
+	from := fs.String("from", cfg.VideoStatusPath, "folder containing the uploads.json to import.")
+	fs.Parse(args)
+
+	src, err := filedb.New(*from)
+	if err != nil {
+		return err
+	}
+
+	dst, err := sqlitedb.New(cfg.sqlitePath())
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	n, err := database.Copy(src, dst)
+	if err != nil {
+		return fmt.Errorf("imported %v records before failing: %v", n, err)
+	}
+
+	fmt.Printf("imported %v records into %v\n", n, cfg.sqlitePath())
+	if cfg.Database.Type != databaseSQLite {
+		fmt.Println("set database.type to sqlite in the config to start using it")
+	}
+
+	return nil
+}
+
+// runMigrateKeys gives records saved before files had IDs the ID of their file, looking for the files in the upload
+// folder, the finished folder, and any extra folders given. Records whose files can't be found keep their name as
+// their key until the file is uploaded again.
+func runMigrateKeys(cfg uploadConfig, db database.UploadDatastore, args []string) error {
+	fs := flag.NewFlagSet("migrate-keys", flag.ExitOnError)
+	extra := fs.String("folders", "", "comma-separated list of other folders containing uploaded videos.")
+	fs.Parse(args)
+
+	folders := []string{cfg.UploadFolderPath, filepath.Join(cfg.FinishedFolderPath, uploadedFolder)}
+	if *extra != "" {
+		folders = append(folders, strings.Split(*extra, ",")...)
+	}
+
+	var migrated int
+	for _, folder := range folders {
+		files, err := os.ReadDir(folder)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || (!strings.HasSuffix(file.Name(), ".mp4") && !strings.HasSuffix(file.Name(), ".mov")) {
+				continue
+			}
+
+			ok, err := migrateKey(db, filepath.Join(folder, file.Name()))
+			if err != nil {
+				return err
+			}
+			if ok {
+				migrated++
+			}
+		}
+	}
+
+	records, err := db.ListUploads()
+	if err != nil {
+		return err
+	}
+
+	var remaining []string
+	for _, r := range records {
+		if r.ID == "" {
+			remaining = append(remaining, r.Name)
+		}
+	}
+
+	fmt.Printf("added IDs to %v records\n", migrated)
+	if len(remaining) > 0 {
+		fmt.Printf("could not find the files of %v records, they're still tracked by name: %v\n", len(remaining), strings.Join(remaining, ", "))
+	}
+
+	return nil
+}
+
+// migrateKey gives the file's record its ID if it was saved without one, and returns whether it did.
+func migrateKey(db database.UploadDatastore, path string) (bool, error) {
+	filename := filepath.Base(path)
+
+	// .mov records used to keep their extension.
+	for _, name := range []string{database.NameFromFilename(filename), filename} {
+		r, err := db.GetUpload(name)
+		if err != nil {
+			return false, err
+		}
+
+		if r.IsEmpty() || r.ID != "" {
+			continue
+		}
+
+		id, err := filesystem.FileID(path)
+		if err != nil {
+			return false, err
+		}
+
+		existing, err := db.GetUpload(id)
+		if err != nil {
+			return false, err
+		}
+
+		if !existing.IsEmpty() {
+			fmt.Printf("WARN: %v already has a record under its ID %v, leaving the record named %v as is\n", filename, id, name)
+			return false, nil
+		}
+
+		r.ID = id
+		err = db.PutUpload(r)
+		if err != nil || r.Name == database.NameFromFilename(filename) {
+			return err == nil, err
+		}
+
+		// the record was re-keyed under its old name, now it can be renamed.
+		r.Name = database.NameFromFilename(filename)
+		return true, db.PutUpload(r)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+	"github.com/nmalensek/video-uploader/internal/app/peertube"
+	"github.com/nmalensek/video-uploader/internal/app/s3"
+	"github.com/nmalensek/video-uploader/internal/app/vimeo"
+	"github.com/nmalensek/video-uploader/internal/app/youtube"
+)
+
+const (
+	destinationVimeo      = "vimeo"
+	destinationYouTube    = "youtube"
+	destinationS3         = "s3"
+	destinationPeerTube   = "peertube"
+	destinationFilesystem = "filesystem"
+)
+
+// destinationConfig is one of several destinations every file is sent to. Each type uses its top-level settings
+// block, ex. vimeo_settings.
+type destinationConfig struct {
+	// Name identifies the destination's status in upload records, so it shouldn't change once files are uploaded.
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Optional destinations only produce a warning when they fail instead of keeping the file for another attempt.
+	Optional bool `yaml:"optional"`
+}
+
+// destinations returns the configured destinations. If the destinations list is empty, the single destination
+// setting is used, defaulting to Vimeo.
+func (c uploadConfig) destinations() []destinationConfig {
+	if len(c.Destinations) > 0 {
+		return c.Destinations
+	}
+
+	d := c.Destination
+	if d == "" {
+		d = destinationVimeo
+	}
+
+	return []destinationConfig{{Name: d, Type: d}}
+}
+
+// findDestination returns the first destination of the given type.
+func (c uploadConfig) findDestination(destinationType string) (destinationConfig, bool) {
+	for _, d := range c.destinations() {
+		if d.Type == destinationType {
+			return d, true
+		}
+	}
+
+	return destinationConfig{}, false
+}
+
+// destinationDatastore returns the datastore the named destination tracks its uploads in. With a destinations list,
+// each destination's state is kept inside the file's record, and records from before the list was added belong to
+// the first destination.
+func destinationDatastore(cfg uploadConfig, db database.UploadDatastore, name string) database.UploadDatastore {
+	if len(cfg.Destinations) == 0 {
+		return db
+	}
+
+	return database.Scoped(db, name, cfg.Destinations[0].Name)
+}
+
+// newUploader creates the uploader for the configured destinations, sending files to each of them in order if
+// there are several. Every attempt is added to the upload history, with its last HTTP status taken from statuses.
+func newUploader(cfg uploadConfig, db database.UploadDatastore, cl, uploadCl *http.Client, statuses *destination.StatusRecorder) (destination.Uploader, error) {
+	if len(cfg.Destinations) == 0 {
+		d := cfg.destinations()[0]
+		u, err := newDestination(cfg, d.Type, db, cl, uploadCl)
+		if err != nil {
+			return nil, err
+		}
+
+		return destination.RecordAttempts(u, db, "", statuses), nil
+	}
+
+	seen := map[string]bool{}
+	var targets []destination.Target
+	for _, d := range cfg.Destinations {
+		if d.Name == "" || seen[d.Name] {
+			return nil, fmt.Errorf("destination names must be unique and not empty, got %q", d.Name)
+		}
+		seen[d.Name] = true
+
+		u, err := newDestination(cfg, d.Type, destinationDatastore(cfg, db, d.Name), cl, uploadCl)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up destination %v: %v", d.Name, err)
+		}
+
+		targets = append(targets, destination.Target{
+			Name:     d.Name,
+			Uploader: destination.RecordAttempts(u, db, d.Name, statuses),
+			Optional: d.Optional,
+		})
+	}
+
+	return destination.NewFanOut(db, targets), nil
+}
+
+// newDestination creates the uploader for a destination type.
+func newDestination(cfg uploadConfig, destinationType string, db database.UploadDatastore, cl, uploadCl *http.Client) (destination.Uploader, error) {
+	switch destinationType {
+	case destinationVimeo:
+		return vimeo.NewUploader(cfg.VideoStatusPath, db, cl, uploadCl, cfg.VimeoSettings)
+	case destinationYouTube:
+		return youtube.New(cfg.VideoStatusPath, db, cl, uploadCl, cfg.YouTubeSettings)
+	case destinationS3:
+		return s3.New(db, cl, uploadCl, cfg.S3Settings)
+	case destinationPeerTube:
+		return peertube.New(cfg.VideoStatusPath, db, cl, uploadCl, cfg.peerTubeSettings())
+	case destinationFilesystem:
+		return filesystem.New(db, cfg.FilesystemSettings)
+	default:
+		return nil, fmt.Errorf("unknown destination type %v, expected vimeo, youtube, s3, peertube, or filesystem", destinationType)
+	}
+}
+
+// peerTubeSettings returns the PeerTube settings, using Vimeo's privacy view if PeerTube's isn't set.
+func (c uploadConfig) peerTubeSettings() peertube.Settings {
+	s := c.PeerTubeSettings
+	if s.PrivacyView == "" {
+		s.PrivacyView = c.VimeoSettings.UploadSettings.Privacy.View
+	}
+
+	return s
+}
+
+// needsPassword returns whether any destination makes videos password protected.
+func (c uploadConfig) needsPassword() bool {
+	if _, ok := c.findDestination(destinationVimeo); ok && c.VimeoSettings.UploadSettings.Privacy.View == "password" {
+		return true
+	}
+
+	_, ok := c.findDestination(destinationPeerTube)
+	return ok && c.peerTubeSettings().PrivacyView == "password"
+}
+
+// newVimeoUploader creates the uploader for the Vimeo destination and returns the datastore it uses, for commands
+// that only work with Vimeo.
+func newVimeoUploader(cfg uploadConfig, db database.UploadDatastore, cl, uploadCl *http.Client) (vimeo.Uploader, database.UploadDatastore, error) {
+	d, ok := cfg.findDestination(destinationVimeo)
+	if !ok {
+		return vimeo.Uploader{}, nil, errors.New("this command requires a vimeo destination")
+	}
+
+	vimeoDB := destinationDatastore(cfg, db, d.Name)
+	u, err := vimeo.NewUploader(cfg.VideoStatusPath, vimeoDB, cl, uploadCl, cfg.VimeoSettings)
+	if err != nil {
+		return vimeo.Uploader{}, nil, err
+	}
+
+	return u, vimeoDB, nil
+}
+
+// runLogin logs in to a destination that uses OAuth. The destination can be left out if only one is configured.
+func runLogin(cfg uploadConfig, db database.UploadDatastore, cl, uploadCl *http.Client, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	name := fs.String("destination", "", "name of the destination to log in to, required if several are configured.")
+	fs.Parse(args)
+
+	dests := cfg.destinations()
+	d := dests[0]
+	if *name != "" {
+		found := false
+		for _, dc := range dests {
+			if dc.Name == *name {
+				d = dc
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("no destination named %v", *name)
+		}
+	} else if len(dests) > 1 {
+		return errors.New("several destinations are configured, choose one with -destination")
+	}
+
+	u, err := newDestination(cfg, d.Type, destinationDatastore(cfg, db, d.Name), cl, uploadCl)
+	if err != nil {
+		return err
+	}
+
+	l, ok := u.(loginer)
+	if !ok {
+		return fmt.Errorf("destination %v does not support logging in", d.Name)
+	}
+
+	err = l.Login(func(authURL string) {
+		fmt.Printf("open the following URL in a browser to allow access to your %v account:\n%v\n", d.Type, authURL)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("logged in to %v\n", d.Name)
+	return nil
+}
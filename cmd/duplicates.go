@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+)
+
+const (
+	// uploadedFolder is the folder in finished_folder_path that uploaded files are moved to.
+	uploadedFolder = "uploaded"
+	// duplicatesFolder is the folder in finished_folder_path that copies of already uploaded files are moved to.
+	duplicatesFolder = "duplicates"
+)
+
+// duplicate is a file that wasn't uploaded because it's a copy of a finished upload.
+type duplicate struct {
+	filename string
+	original database.UploadRecord
+}
+
+// moveToDuplicates moves a duplicate file out of the upload folder. A number is added to its name if the duplicates
+// folder already has a file with the same name.
+func moveToDuplicates(conf uploadConfig, filename string) {
+	dir := filepath.Join(conf.FinishedFolderPath, duplicatesFolder)
+	ext := filepath.Ext(filename)
+	dst := filepath.Join(dir, filename)
+	for n := 2; ; n++ {
+		_, err := os.Stat(dst)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			fmt.Printf("could not check the duplicates folder for %v, leaving it in the upload folder: %v\n", filename, err)
+			return
+		}
+		dst = filepath.Join(dir, fmt.Sprintf("%v (%v)%v", strings.TrimSuffix(filename, ext), n, ext))
+	}
+
+	err := filesystem.Move(filepath.Join(conf.UploadFolderPath, filename), dst)
+	if err != nil {
+		fmt.Printf("could not move file %v into duplicates folder: %v\n", filename, err)
+	}
+}
+
+// reportDuplicates lists the files that weren't uploaded because they're copies of finished uploads.
+func reportDuplicates(conf uploadConfig, duplicates []duplicate) {
+	if len(duplicates) == 0 {
+		return
+	}
+
+	fmt.Println("------------------------------")
+	fmt.Printf("%v duplicate files were not uploaded and were moved to %v:\n", len(duplicates), filepath.Join(conf.FinishedFolderPath, duplicatesFolder))
+	for _, d := range duplicates {
+		fmt.Printf("%v is a copy of %v (%v)\n", d.filename, d.original.Name, d.original.VideoURI)
+	}
+	fmt.Println("------------------------------")
+}
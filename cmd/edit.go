@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/vimeo"
+)
+
+// runEdit updates the metadata of uploaded videos. Either a single video is edited using the given flags, or with -all
+// every video from a term has the current config's name/description templates, privacy, and tags re-applied.
+func runEdit(conf uploadConfig, videoEditor editor, db, vimeoDB database.UploadDatastore, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	name := fs.String("name", "", "name of the upload record to edit (the video's filename without extension) or its ID.")
+	title := fs.String("title", "", "new video name.")
+	description := fs.String("description", "", "new video description.")
+	view := fs.String("view", "", "new privacy view setting, other privacy settings are taken from the config file.")
+	password := fs.String("password", "", "new video password, used when the view setting is password.")
+	tags := fs.String("tags", "", "comma-separated list of tags that replaces the video's tags.")
+	all := fs.Bool("all", false, "re-apply the config's templates, privacy, and tags to every video from -term.")
+	term := fs.String("term", metadata.Term(conf.SemesterStartDate), "term of the videos to edit when using -all, ex. 2023 Spring.")
+	fs.Parse(args)
+
+	if *all {
+		return reapplySettings(conf, videoEditor, vimeoDB, *term)
+	}
+
+	if *name == "" {
+		return errors.New("edit requires -name or -all")
+	}
+
+	r, err := database.FindUpload(vimeoDB, *name)
+	if err != nil {
+		return fmt.Errorf("could not get upload record %v: %v", *name, err)
+	}
+
+	if r.IsEmpty() || r.VideoURI == "" {
+		return fmt.Errorf("no uploaded video found for %v", *name)
+	}
+
+	data := vimeo.EditData{
+		Name:        *title,
+		Description: *description,
+		Password:    *password,
+	}
+
+	if *view != "" {
+		p := conf.VimeoSettings.UploadSettings.Privacy
+		p.View = *view
+		data.Privacy = &p
+	}
+
+	if *tags != "" {
+		data.Tags = strings.Split(*tags, ",")
+	}
+
+	err = videoEditor.Edit(r.VideoURI, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("updated video %v (%v)\n", r.Name, r.VideoURI)
+
+	if *password != "" {
+		return savePassword(db, vimeoDB, r, *password)
+	}
+
+	return nil
+}
+
+// reapplySettings edits every uploaded video from the given term so it matches the current config. Video passwords
+// are left as they are.
+func reapplySettings(conf uploadConfig, videoEditor editor, db database.UploadDatastore, term string) error {
+	records, err := db.ListUploads()
+	if err != nil {
+		return fmt.Errorf("could not list upload records: %v", err)
+	}
+
+	settings := conf.VimeoSettings.UploadSettings
+	failed := 0
+	edited := 0
+	unknown := 0
+
+	for _, r := range records {
+		if r.VideoURI == "" {
+			continue
+		}
+
+		recordTerm := videoTerm(conf, r)
+		if recordTerm == "" {
+			unknown++
+			continue
+		}
+
+		if recordTerm != term {
+			continue
+		}
+
+		// the recording time isn't saved, the upload time is the closest to it for videos without a week in their name.
+		details := videoDetails(conf, recordFilename(r), r.UploadedAt)
+		details.CalculatedName = r.CalculatedName
+		details.Term = recordTerm
+		class, _ := metadata.MatchClass(conf.Classes, details.Filename)
+
+		// empty fallbacks leave the name and description unchanged when there is no template.
+		title, err := metadata.ApplyTemplate(settings.NameTemplate, "", details)
+		if err != nil {
+			return err
+		}
+
+		description, err := metadata.ApplyTemplate(settings.DescriptionTemplate, "", details)
+		if err != nil {
+			return err
+		}
+
+		privacy := settings.Privacy
+		data := vimeo.EditData{
+			Name:        title,
+			Description: description,
+			Privacy:     &privacy,
+			Tags:        settings.Tags,
+		}
+
+		if privacy.Embed == "whitelist" {
+			data.EmbedDomains = embedDomains(conf, class)
+		}
+
+		err = videoEditor.Edit(r.VideoURI, data)
+		if err != nil {
+			fmt.Printf("error updating video %v: %v, skipping...\n", r.Name, err)
+			failed++
+			continue
+		}
+
+		edited++
+		fmt.Printf("updated video %v (%v)\n", r.Name, r.VideoURI)
+	}
+
+	fmt.Printf("updated %v videos from %v, %v failed\n", edited, term, failed)
+	if unknown > 0 {
+		fmt.Printf("skipped %v videos whose term isn't known, edit them with -name instead\n", unknown)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v videos could not be updated", failed)
+	}
+
+	return nil
+}
+
+// recordFilename returns the filename of the video the record is for. Records are named after the file without its
+// extension, except ones saved before .mov files were supported, which kept it; uploads are assumed to be .mp4 files.
+func recordFilename(r database.UploadRecord) string {
+	if strings.HasSuffix(r.Name, ".mov") || strings.HasSuffix(r.Name, ".mp4") {
+		return r.Name
+	}
+
+	return r.Name + ".mp4"
+}
+
+// videoTerm returns the term the record's video is from. Records saved before terms were saved don't have one, so it's
+// worked out from when the video was uploaded, or else from the modification time of its file in the finished folder,
+// which is when it was recorded. An empty string is returned if none of them is known.
+func videoTerm(conf uploadConfig, r database.UploadRecord) string {
+	if r.Term != "" {
+		return r.Term
+	}
+
+	if !r.UploadedAt.IsZero() {
+		return metadata.Term(r.UploadedAt)
+	}
+
+	base := strings.TrimSuffix(recordFilename(r), filepath.Ext(recordFilename(r)))
+	for _, ext := range []string{".mp4", ".mov"} {
+		info, err := os.Stat(filepath.Join(conf.FinishedFolderPath, uploadedFolder, base+ext))
+		if err == nil {
+			return metadata.Term(info.ModTime())
+		}
+	}
+
+	return ""
+}
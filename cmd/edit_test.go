@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/vimeo"
+)
+
+// fakeEditor records the videos it's asked to edit.
+type fakeEditor struct {
+	edited []string
+}
+
+func (f *fakeEditor) Edit(videoURI string, data vimeo.EditData) error {
+	f.edited = append(f.edited, videoURI)
+	return nil
+}
+
+func TestReapplySettings(t *testing.T) {
+	dir := t.TempDir()
+	conf := uploadConfig{
+		SemesterStartDate:  time.Date(2023, time.January, 16, 0, 0, 0, 0, time.UTC),
+		FinishedFolderPath: filepath.Join(dir, "finished"),
+	}
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spring := time.Date(2023, time.March, 1, 12, 0, 0, 0, time.UTC)
+	records := []database.UploadRecord{
+		{Name: "Tap Week 1", VideoURI: "/videos/1", Term: "2023 Spring"},
+		{Name: "Tap Week 2", VideoURI: "/videos/2", Term: "2022 Winter"},
+		// saved before records had terms.
+		{Name: "Tap Week 3", VideoURI: "/videos/3", UploadedAt: spring},
+		{Name: "Tap Week 4", VideoURI: "/videos/4"},
+		{Name: "Tap Week 5", VideoURI: "/videos/5"},
+		{Name: "Tap Week 6", Term: "2023 Spring"},
+	}
+	for _, r := range records {
+		err = db.PutUpload(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tap Week 4's finished file shows when it was recorded, Tap Week 5's term can't be worked out.
+	finished := filepath.Join(conf.FinishedFolderPath, uploadedFolder, "Tap Week 4.mov")
+	err = os.MkdirAll(filepath.Dir(finished), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(finished, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(finished, spring, spring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := &fakeEditor{}
+	err = reapplySettings(conf, e, db, "2023 Spring")
+	if err != nil {
+		t.Fatalf("reapplySettings() error = %v", err)
+	}
+
+	want := []string{"/videos/1", "/videos/3", "/videos/4"}
+	if diff := cmp.Diff(want, e.edited); diff != "" {
+		t.Errorf("reapplySettings() edited videos mismatch (-want +got):\n%s", diff)
+	}
+}
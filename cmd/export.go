@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/export"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// exportDateLayout is the format of the -from and -to dates.
+const exportDateLayout = "2006-01-02"
+
+// runExport writes a report of upload records, ex. the videos uploaded this week with their links and passwords.
+func runExport(conf uploadConfig, db database.UploadDatastore, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", string(export.CSV), "report format: csv, jsonl, or markdown.")
+	output := fs.String("o", "", "file to write the report to, defaults to stdout.")
+	columns := fs.String("columns", strings.Join(export.DefaultColumns, ","), fmt.Sprintf("comma-separated columns to include, any of: %v.", strings.Join(export.ColumnNames(), ", ")))
+	term := fs.String("term", "", "only include videos from this term, ex. 2023 Spring.")
+	class := fs.String("class", "", "only include videos of this class.")
+	status := fs.String("status", "", "only include uploads with this status: complete, in_progress, or error.")
+	from := fs.String("from", "", "only include uploads that finished on or after this date, ex. 2023-02-06.")
+	to := fs.String("to", "", "only include uploads that finished on or before this date.")
+	fs.Parse(args)
+
+	f, err := export.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	cols, err := export.Columns(strings.Split(*columns, ","))
+	if err != nil {
+		return err
+	}
+
+	filter := export.Filter{
+		Term:   *term,
+		Class:  *class,
+		Status: database.UploadStatus(strings.ToUpper(*status)),
+	}
+
+	if *from != "" {
+		filter.From, err = time.ParseInLocation(exportDateLayout, *from, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid -from date %v, expected YYYY-MM-DD: %v", *from, err)
+		}
+	}
+
+	if *to != "" {
+		end, err := time.ParseInLocation(exportDateLayout, *to, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid -to date %v, expected YYYY-MM-DD: %v", *to, err)
+		}
+		// include the whole day.
+		filter.To = end.AddDate(0, 0, 1)
+	}
+
+	records, err := db.ListUploads()
+	if err != nil {
+		return fmt.Errorf("could not list upload records: %v", err)
+	}
+
+	// records saved before the class was recorded are matched to one by name.
+	for i, r := range records {
+		if r.Class == "" {
+			c, _ := metadata.MatchClass(conf.Classes, r.Name)
+			records[i].Class = c.Name
+		}
+	}
+
+	if *output == "" {
+		return writeReport(os.Stdout, f, records, cols, filter)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("could not create %v: %v", *output, err)
+	}
+
+	err = writeReport(file, f, records, cols, filter)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func writeReport(w io.Writer, f export.Format, records []database.UploadRecord, cols []export.Column, filter export.Filter) error {
+	err := export.Write(w, f, records, cols, filter)
+	if err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// attemptRetention limits how much upload attempt history is kept. Zero values keep everything.
+type attemptRetention struct {
+	// MaxAge is how long attempts are kept, ex. 2160h for 90 days.
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxPerUpload is how many of each file's most recent attempts are kept.
+	MaxPerUpload int `yaml:"max_per_upload"`
+}
+
+// runHistory prints every recorded attempt to upload the named file.
+func runHistory(db database.UploadDatastore, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: history <name>, where name is the video's filename without extension or its ID")
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(fs.Arg(0), ".mp4"), ".mov")
+	r, err := database.FindUpload(db, name)
+	if err != nil {
+		return err
+	}
+
+	// attempts from before the file had an ID are saved under its name.
+	keys := []string{name}
+	if !r.IsEmpty() {
+		keys = []string{r.Key()}
+		if r.ID != "" {
+			keys = append(keys, r.Name)
+		}
+	}
+
+	var attempts []database.Attempt
+	for _, key := range keys {
+		a, err := db.ListAttempts(key)
+		if err != nil {
+			return fmt.Errorf("could not read attempts for %v: %v", name, err)
+		}
+		attempts = append(attempts, a...)
+	}
+
+	if len(attempts) == 0 {
+		fmt.Printf("no upload attempts recorded for %v\n", name)
+		return nil
+	}
+
+	sort.SliceStable(attempts, func(i, j int) bool {
+		return attempts[i].StartedAt.Before(attempts[j].StartedAt)
+	})
+
+	return printAttempts(os.Stdout, attempts)
+}
+
+// printAttempts writes the attempts as a table, oldest first.
+func printAttempts(out io.Writer, attempts []database.Attempt) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tDURATION\tDESTINATION\tSTATUS\tOFFSETS\tSENT\tHTTP\tHOST\tERROR")
+
+	for _, a := range attempts {
+		dest := a.Destination
+		if dest == "" {
+			dest = "-"
+		}
+
+		httpStatus := "-"
+		if a.HTTPStatus != 0 {
+			httpStatus = fmt.Sprint(a.HTTPStatus)
+		}
+
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v-%v\t%v\t%v\t%v\t%v\n",
+			a.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			a.EndedAt.Sub(a.StartedAt).Round(time.Second),
+			dest, a.Status, a.StartOffset, a.EndOffset, a.BytesSent, httpStatus, a.Host, a.Error)
+	}
+
+	return w.Flush()
+}
+
+// pruneAttempts applies the attempt_retention settings. Failures only produce a warning since the uploads themselves
+// already finished.
+func pruneAttempts(cfg uploadConfig, db database.AttemptLog) {
+	r := cfg.AttemptRetention
+	if r.MaxAge <= 0 && r.MaxPerUpload <= 0 {
+		return
+	}
+
+	var cutoff time.Time
+	if r.MaxAge > 0 {
+		cutoff = time.Now().Add(-r.MaxAge)
+	}
+
+	n, err := db.PruneAttempts(cutoff, r.MaxPerUpload)
+	if err != nil {
+		fmt.Printf("WARN: could not prune upload attempt history: %v\n", err)
+		return
+	}
+
+	if n > 0 {
+		fmt.Printf("pruned %v old upload attempts\n", n)
+	}
+}
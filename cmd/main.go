@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -12,9 +13,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nmalensek/video-uploader/internal/app/captions"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/duplicates"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+	"github.com/nmalensek/video-uploader/internal/app/lock"
 	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/notify"
 	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+	"github.com/nmalensek/video-uploader/internal/app/peertube"
+	"github.com/nmalensek/video-uploader/internal/app/s3"
 	"github.com/nmalensek/video-uploader/internal/app/vimeo"
+	"github.com/nmalensek/video-uploader/internal/app/youtube"
 	"gopkg.in/yaml.v3"
 )
 
@@ -23,37 +34,185 @@ var (
 )
 
 type uploadConfig struct {
-	SemesterStartDate  time.Time        `yaml:"semester_start_date"`
-	UploadFolderPath   string           `yaml:"upload_folder_path"`
-	FinishedFolderPath string           `yaml:"finished_folder_path"`
-	VideoStatusPath    string           `yaml:"upload_status_path"`
-	ChunkSizeMB        int              `yaml:"chunk_size_mb"`
-	LogLevel           string           `yaml:"log_level"`
-	VimeoSettings      vimeo.Settings   `yaml:"vimeo_settings"`
-	Classes            []metadata.Class `yaml:"classes"`
+	SemesterStartDate  time.Time           `yaml:"semester_start_date"`
+	UploadFolderPath   string              `yaml:"upload_folder_path"`
+	FinishedFolderPath string              `yaml:"finished_folder_path"`
+	VideoStatusPath    string              `yaml:"upload_status_path"`
+	ChunkSizeMB        int                 `yaml:"chunk_size_mb"`
+	LogLevel           string              `yaml:"log_level"`
+	RunLockWait        time.Duration       `yaml:"run_lock_wait"`
+	Database           databaseConfig      `yaml:"database"`
+	AttemptRetention   attemptRetention    `yaml:"attempt_retention"`
+	PasswordVault      passwordVaultConfig `yaml:"password_vault"`
+	Passphrase         passphrase.Options  `yaml:"passphrase"`
+	PasswordScope      string              `yaml:"password_scope"`
+	TextTrackLanguage  string              `yaml:"text_track_language"`
+	Destination        string              `yaml:"destination"`
+	Destinations       []destinationConfig `yaml:"destinations"`
+	VimeoSettings      vimeo.Settings      `yaml:"vimeo_settings"`
+	YouTubeSettings    youtube.Settings    `yaml:"youtube_settings"`
+	S3Settings         s3.Settings         `yaml:"s3_settings"`
+	PeerTubeSettings   peertube.Settings   `yaml:"peertube_settings"`
+	FilesystemSettings filesystem.Settings `yaml:"filesystem_settings"`
+	Notifications      notify.Settings     `yaml:"notifications"`
+	Classes            []metadata.Class    `yaml:"classes"`
 }
 
-type uploader interface {
-	Upload(data vimeo.UploadData) error
+// runLockFilename is locked in the upload folder while files are being uploaded.
+const runLockFilename = ".video-uploader.lock"
+
+type editor interface {
+	Edit(videoURI string, data vimeo.EditData) error
+}
+
+type replacer interface {
+	Replace(name string, data destination.UploadData) error
+}
+
+type loginer interface {
+	Login(prompt func(authURL string)) error
 }
 
 func main() {
 	cfg := readConfig()
 
+	// statuses records the last HTTP status for the upload attempt history.
+	statuses := destination.NewStatusRecorder(nil)
+
 	cl := &http.Client{
-		Timeout: time.Second * 10,
+		Timeout:   time.Second * 10,
+		Transport: statuses,
 	}
 
 	uploadCl := &http.Client{
-		Timeout: time.Minute * 20,
+		Timeout:   time.Minute * 20,
+		Transport: statuses,
+	}
+
+	// these commands don't use the datastore, which would need the password key to open.
+	switch {
+	case flag.Arg(0) == "migrate-db":
+		err := runMigrateDB(cfg, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	case flag.Arg(0) == "password" && flag.Arg(1) == "create-key":
+		err := createPasswordKey(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	vimeoUploader, err := vimeo.NewUploader(cfg.VideoStatusPath, cl, uploadCl, cfg.VimeoSettings)
+	db, key, err := newDatastore(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	processFiles(cfg, vimeoUploader)
+	switch flag.Arg(0) {
+	case "", "upload":
+		runLock := acquireRunLock(cfg)
+		defer runLock.Release()
+
+		if cfg.needsPassword() {
+			err = checkPassphrases(cfg)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		notifier, err := newUploadNotifier(cfg, db)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		u, err := newUploader(cfg, db, cl, uploadCl, statuses)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		processFiles(cfg, db, u, key, notifier)
+		pruneAttempts(cfg, db)
+	case "edit":
+		vimeoUploader, vimeoDB, err := newVimeoUploader(cfg, db, cl, uploadCl)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runEdit(cfg, vimeoUploader, db, vimeoDB, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "replace":
+		runLock := acquireRunLock(cfg)
+		defer runLock.Release()
+
+		vimeoUploader, _, err := newVimeoUploader(cfg, db, cl, uploadCl)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = runReplace(cfg, vimeoUploader, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "history":
+		err = runHistory(db, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "migrate-keys":
+		runLock := acquireRunLock(cfg)
+		defer runLock.Release()
+
+		err = runMigrateKeys(cfg, db, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "password":
+		err = runPassword(cfg, db, cl, uploadCl, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "export":
+		err = runExport(cfg, db, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "login":
+		err = runLogin(cfg, db, cl, uploadCl, flag.Args()[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown command %v, expected one of: upload, edit, replace, history, export, password, login, migrate-db, migrate-keys", flag.Arg(0))
+	}
+}
+
+// acquireRunLock makes sure only one instance uploads at a time, ex. if a scheduled run starts while the previous
+// one is still uploading. It waits up to run_lock_wait for the other instance to finish, then exits.
+func acquireRunLock(cfg uploadConfig) *lock.File {
+	path := filepath.Join(cfg.UploadFolderPath, runLockFilename)
+
+	l, err := lock.Acquire(path, cfg.RunLockWait)
+	if errors.Is(err, lock.ErrLocked) {
+		owner := "another instance"
+		if pid := lock.Owner(path); pid != 0 {
+			owner = fmt.Sprintf("another instance (pid %v)", pid)
+		}
+		log.Fatalf("%v is already processing %v, exiting. Set run_lock_wait to wait for it to finish instead.", owner, cfg.UploadFolderPath)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = l.WriteOwner()
+	if err != nil {
+		fmt.Printf("WARN: could not record process ID in run lock: %v\n", err)
+	}
+
+	return l
 }
 
 func readConfig() uploadConfig {
@@ -89,12 +248,18 @@ func readConfig() uploadConfig {
 	return conf
 }
 
-func processFiles(conf uploadConfig, uploadClient uploader) {
+func processFiles(conf uploadConfig, db database.UploadDatastore, uploadClient destination.Uploader, passwordKey []byte, notifier *uploadNotifier) {
 	files, err := os.ReadDir(conf.UploadFolderPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	finder := duplicates.NewFinder(db, filepath.Join(conf.FinishedFolderPath, uploadedFolder))
+	var copies []duplicate
+	defer func() { reportDuplicates(conf, copies) }()
+	defer notifier.sendDigests()
+	notifier.resendFailed(conf)
+
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -110,41 +275,178 @@ func processFiles(conf uploadConfig, uploadClient uploader) {
 			continue
 		}
 
+		// the ID keeps the file's record if it's renamed, a file without one is tracked by name.
+		path := filepath.Join(conf.UploadFolderPath, file.Name())
+		id, idErr := filesystem.FileID(path)
+		if idErr != nil {
+			fmt.Printf("WARN: could not identify %v by its contents, tracking it by name: %v\n", file.Name(), idErr)
+		}
+
+		var original database.UploadRecord
+		if id != "" {
+			var dErr error
+			original, id, dErr = finder.Find(id, path)
+			if dErr != nil {
+				fmt.Printf("WARN: could not check whether %v was already uploaded under another name: %v\n", file.Name(), dErr)
+			}
+		}
+
 		// currently only using it for metrics, file name is expected to be final video name.
 		// temporarily skip this until this can be worked out reliably.
 		// calculatedFileName, _ := getVideoNameByDate(file, conf.UploadFolderPath, conf.Classes, conf.SemesterStartDate)
 
+		// the file's modification time is when it was recorded, unless it's been copied since.
+		details := videoDetails(conf, file.Name(), i.ModTime())
+		class, _ := metadata.MatchClass(conf.Classes, file.Name())
+
 		password := ""
-		if conf.VimeoSettings.UploadSettings.Privacy.View == "password" {
-			p, pErr := passphrase.Generate()
+		if conf.needsPassword() {
+			p, pErr := conf.videoPassword(passwordKey, details, class)
 			if pErr != nil {
-				fmt.Printf("error generating random password: %v, skipping file...\n", err)
+				fmt.Printf("error generating password: %v, skipping file...\n", pErr)
 				continue
 			}
-			password = p
+			password = p.Text
+		}
+
+		thumbnail := findSidecar(conf.UploadFolderPath, file.Name(), ".jpg", ".jpeg", ".png")
+
+		textTracks, cErr := captions.FindTextTracks(conf.UploadFolderPath, file.Name(), conf.TextTrackLanguage)
+		if cErr != nil {
+			fmt.Printf("WARN: could not check for %v text tracks: %v\n", file.Name(), cErr)
+		}
+
+		if !original.IsEmpty() {
+			moveToDuplicates(conf, file.Name())
+			for _, t := range textTracks {
+				moveToDuplicates(conf, t.Filename)
+			}
+			if thumbnail != "" {
+				moveToDuplicates(conf, filepath.Base(thumbnail))
+			}
+
+			copies = append(copies, duplicate{filename: file.Name(), original: original})
+			continue
 		}
 
-		uErr := uploadClient.Upload(vimeo.UploadData{
+		data := destination.UploadData{
+			ID:               id,
 			Filename:         file.Name(),
+			VideoTitle:       file.Name(),
 			VideoDescription: strings.TrimSuffix(file.Name(), ".mp4"),
+			Details:          details,
+			Class:            class,
 			VideoName:        "",
-			FilePath:         fmt.Sprintf("%v/%v", conf.UploadFolderPath, file.Name()),
+			Term:             details.Term,
+			FilePath:         path,
 			Password:         password,
 			FileSize:         i.Size(),
 			ChunkSize:        conf.ChunkSizeMB,
-		})
+			TextTracks:       textTracks,
+			ThumbnailPath:    thumbnail,
+			ThumbnailOffset:  class.ThumbnailOffset,
+			EmbedDomains:     embedDomains(conf, class),
+		}
 
+		uErr := uploadClient.Upload(data)
 		if uErr != nil {
 			fmt.Printf("error uploading %v, file may need to be re-processed. error: %v\n skipping...\n", file.Name(), uErr)
 			continue
 		}
 
-		os.MkdirAll(fmt.Sprintf("%v/%v", conf.FinishedFolderPath, "uploaded"), 0750)
+		sErr := saveUploadDetails(db, data)
+		if sErr != nil {
+			fmt.Printf("WARN: could not save the size and duration of %v for reports: %v\n", file.Name(), sErr)
+		}
+
+		if id != "" {
+			cErr := finder.SaveChecksum(id, path)
+			if cErr != nil {
+				fmt.Printf("WARN: could not save the checksum of %v, copies of it won't be detected: %v\n", file.Name(), cErr)
+			}
+		}
+
+		notifier.uploaded(data)
 
-		rErr := os.Rename(fmt.Sprintf("%v/%v", conf.UploadFolderPath, file.Name()), fmt.Sprintf("%v/%v/%v", conf.FinishedFolderPath, "uploaded", file.Name()))
-		if rErr != nil {
-			fmt.Printf("could not move file %v into completed uploads folder: %v", file.Name(), err)
+		moveToFinished(conf, file.Name())
+		for _, t := range textTracks {
+			moveToFinished(conf, t.Filename)
 		}
+		if thumbnail != "" {
+			moveToFinished(conf, filepath.Base(thumbnail))
+		}
+	}
+}
+
+// embedDomains returns the class's embed domains if it has any, otherwise the config's.
+func embedDomains(conf uploadConfig, class metadata.Class) []string {
+	if len(class.EmbedDomains) > 0 {
+		return class.EmbedDomains
+	}
+
+	return conf.VimeoSettings.EmbedDomains
+}
+
+// findSidecar returns the path of the first file in dir with the same base name as filename and one of the given
+// extensions, or an empty string if there isn't one.
+func findSidecar(dir, filename string, extensions ...string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	for _, ext := range extensions {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			p := filepath.Join(dir, base+e)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+	}
+
+	return ""
+}
+
+// saveUploadDetails adds what reports include about a finished upload that the uploaders don't save themselves. The
+// upload time is only set the first time the file finishes.
+func saveUploadDetails(db database.UploadDatastore, data destination.UploadData) error {
+	r, err := db.GetUpload(data.Key())
+	if err != nil || r.IsEmpty() {
+		return err
+	}
+
+	r.Class = data.Class.Name
+	r.Size = data.FileSize
+	if r.UploadedAt.IsZero() {
+		r.UploadedAt = time.Now()
+	}
+
+	d, dErr := metadata.Duration(data.FilePath)
+	if dErr != nil {
+		fmt.Printf("WARN: %v\n", dErr)
+	} else {
+		r.Duration = d
+	}
+
+	return db.PutUpload(r)
+}
+
+// moveToFinished moves the named file from the upload folder into the completed uploads folder, copying it if the
+// folders are on different filesystems.
+func moveToFinished(conf uploadConfig, filename string) {
+	rErr := filesystem.Move(filepath.Join(conf.UploadFolderPath, filename), filepath.Join(conf.FinishedFolderPath, uploadedFolder, filename))
+	if rErr != nil {
+		fmt.Printf("could not move file %v into completed uploads folder: %v\n", filename, rErr)
+	}
+}
+
+// videoDetails returns the template values for the given file using the current config. recorded is used to
+// calculate the week if the filename doesn't have one, and can be zero if it isn't known.
+func videoDetails(conf uploadConfig, filename string, recorded time.Time) metadata.VideoDetails {
+	class, _ := metadata.MatchClass(conf.Classes, filename)
+
+	return metadata.VideoDetails{
+		Filename: filename,
+		Name:     strings.TrimSuffix(filename, filepath.Ext(filename)),
+		Term:     metadata.Term(conf.SemesterStartDate),
+		Class:    class.Name,
+		Week:     metadata.WeekNumber(filename, conf.SemesterStartDate, recorded),
 	}
 }
 
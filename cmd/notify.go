@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/notify"
+)
+
+// uploadNotifier emails the link and password of finished uploads and records whether it could in their upload
+// records. In digest mode the videos are collected and sent once the upload run is done.
+type uploadNotifier struct {
+	notifier *notify.Notifier
+	db       database.UploadDatastore
+	// digests are the videos waiting to be sent, by recipient list, in the order their first video finished.
+	digests []pendingDigest
+}
+
+// pendingDigest is the videos one list of recipients will get in a digest.
+type pendingDigest struct {
+	recipients []string
+	keys       []string
+	uploads    []notify.Upload
+}
+
+// newUploadNotifier returns nil if notifications aren't configured. Every class's recipients are checked so mistakes
+// are found before anything is uploaded.
+func newUploadNotifier(cfg uploadConfig, db database.UploadDatastore) (*uploadNotifier, error) {
+	if !cfg.Notifications.Enabled() {
+		return nil, nil
+	}
+
+	n, err := notify.New(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, class := range cfg.Classes {
+		err = notify.CheckRecipients(class.NotifyRecipients)
+		if err != nil {
+			return nil, fmt.Errorf("class %v: %v", class.Name, err)
+		}
+	}
+
+	return &uploadNotifier{notifier: n, db: db}, nil
+}
+
+// uploaded sends or queues the notification for a finished upload. Uploads that were already notified about are
+// skipped.
+func (u *uploadNotifier) uploaded(data destination.UploadData) {
+	if u == nil {
+		return
+	}
+
+	r, err := u.db.GetUpload(data.Key())
+	if err != nil {
+		fmt.Printf("WARN: could not read the upload record of %v to email its link: %v\n", data.Filename, err)
+		return
+	}
+
+	if r.IsEmpty() || r.Notification != nil && r.Notification.Status == database.Complete {
+		return
+	}
+
+	// the record has the password the video was created with, which a resumed upload doesn't generate again.
+	upload := notify.Upload{
+		Name:     data.Details.Name,
+		Class:    data.Class.Name,
+		Term:     data.Term,
+		Week:     data.Details.Week,
+		VideoURI: r.VideoURI,
+		Password: r.Password,
+	}
+	u.notify(r.Key(), u.notifier.Recipients(data.Class.NotifyRecipients), upload)
+}
+
+// resendFailed tries the notifications that failed on earlier runs again, ex. because the mail server was down, so
+// they aren't lost once their files have been moved out of the upload folder. They go to the current recipients in
+// case a bad address was the problem.
+func (u *uploadNotifier) resendFailed(cfg uploadConfig) {
+	if u == nil {
+		return
+	}
+
+	records, err := u.db.ListUploads()
+	if err != nil {
+		fmt.Printf("WARN: could not read the upload records to resend failed emails: %v\n", err)
+		return
+	}
+
+	for _, r := range records {
+		if r.Notification == nil || r.Notification.Status != database.Error {
+			continue
+		}
+
+		class, _ := metadata.MatchClass(cfg.Classes, r.Name)
+		upload := notify.Upload{
+			Name:     r.Name,
+			Class:    class.Name,
+			Term:     r.Term,
+			Week:     metadata.WeekNumber(r.Name, cfg.SemesterStartDate, time.Time{}),
+			VideoURI: r.VideoURI,
+			Password: r.Password,
+		}
+		u.notify(r.Key(), u.notifier.Recipients(class.NotifyRecipients), upload)
+	}
+}
+
+// notify sends the email about an upload, or queues it for a digest.
+func (u *uploadNotifier) notify(key string, recipients []string, upload notify.Upload) {
+	if u.notifier.Digest() {
+		u.queue(recipients, key, upload)
+		return
+	}
+
+	attempts, err := u.notifier.Notify(recipients, upload)
+	u.record([]string{key}, recipients, attempts, err)
+	if err != nil {
+		fmt.Printf("WARN: could not email the link to %v: %v\n", upload.Name, err)
+		return
+	}
+
+	fmt.Printf("emailed the link to %v to %v\n", upload.Name, strings.Join(recipients, ", "))
+}
+
+// queue adds the upload to the digest for its recipients, unless it's queued already, ex. a failed email being resent
+// for a file that was uploaded again.
+func (u *uploadNotifier) queue(recipients []string, key string, upload notify.Upload) {
+	list := strings.Join(recipients, ",")
+	for i := range u.digests {
+		for _, k := range u.digests[i].keys {
+			if k == key {
+				return
+			}
+		}
+
+		if strings.Join(u.digests[i].recipients, ",") == list {
+			u.digests[i].keys = append(u.digests[i].keys, key)
+			u.digests[i].uploads = append(u.digests[i].uploads, upload)
+			return
+		}
+	}
+
+	u.digests = append(u.digests, pendingDigest{recipients: recipients, keys: []string{key}, uploads: []notify.Upload{upload}})
+}
+
+// sendDigests sends the queued digests.
+func (u *uploadNotifier) sendDigests() {
+	if u == nil {
+		return
+	}
+
+	for _, d := range u.digests {
+		attempts, err := u.notifier.NotifyDigest(d.recipients, d.uploads)
+		u.record(d.keys, d.recipients, attempts, err)
+		if err != nil {
+			fmt.Printf("WARN: could not email the links to %v videos to %v: %v\n", len(d.uploads), strings.Join(d.recipients, ", "), err)
+			continue
+		}
+
+		fmt.Printf("emailed the links to %v videos to %v\n", len(d.uploads), strings.Join(d.recipients, ", "))
+	}
+	u.digests = nil
+}
+
+// record saves whether the email was sent in each upload's record, adding up the attempts of earlier runs that
+// failed. Failing to save it only produces a warning since the email itself was already sent or failed.
+func (u *uploadNotifier) record(keys, recipients []string, attempts int, sendErr error) {
+	for _, key := range keys {
+		r, err := u.db.GetUpload(key)
+		if err == nil && !r.IsEmpty() {
+			n := &database.Notification{
+				Status:     database.Complete,
+				Recipients: recipients,
+				Attempts:   attempts,
+				At:         time.Now(),
+			}
+
+			if sendErr != nil {
+				n.Status = database.Error
+				n.Error = sendErr.Error()
+			}
+
+			if r.Notification != nil && r.Notification.Status == database.Error {
+				n.Attempts += r.Notification.Attempts
+			}
+
+			r.Notification = n
+			err = u.db.PutUpload(r)
+		}
+		if err != nil {
+			fmt.Printf("WARN: could not save the notification status of %v: %v\n", key, err)
+		}
+	}
+}
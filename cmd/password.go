@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+	"github.com/nmalensek/video-uploader/internal/app/vault"
+	"github.com/nmalensek/video-uploader/internal/app/vimeo"
+)
+
+const (
+	// passwordScopeVideo gives every video its own random password, the default.
+	passwordScopeVideo = "video"
+	// passwordScopeClassTerm shares a password between a class's videos from the same term.
+	passwordScopeClassTerm = "class_term"
+	// passwordScopeClassWeek shares a password between a class's videos from the same week of the term.
+	passwordScopeClassWeek = "class_week"
+)
+
+const passwordUsage = "usage: password show <name> or password rotate <name>, where name is the video's filename without extension or its ID, or password create-key"
+
+// runPassword shows a video's saved password, or rotates it by setting a new one on Vimeo. password create-key is run
+// by createPasswordKey instead, since the datastore can't be opened before the key exists.
+func runPassword(cfg uploadConfig, db database.UploadDatastore, cl, uploadCl *http.Client, args []string) error {
+	fs := flag.NewFlagSet("password", flag.ExitOnError)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return errors.New(passwordUsage)
+	}
+
+	name := fs.Arg(1)
+	switch fs.Arg(0) {
+	case "show":
+		return showPassword(db, name)
+	case "rotate":
+		vimeoUploader, vimeoDB, err := newVimeoUploader(cfg, db, cl, uploadCl)
+		if err != nil {
+			return err
+		}
+
+		return rotatePassword(cfg, vimeoUploader, db, vimeoDB, name)
+	default:
+		return errors.New(passwordUsage)
+	}
+}
+
+// createPasswordKey saves a new key that encrypts saved video passwords to password_vault.key_path.
+func createPasswordKey(cfg uploadConfig) error {
+	if cfg.PasswordVault.KeyPath == "" {
+		return errors.New("set password_vault.key_path to where the new key should be saved")
+	}
+
+	err := vault.CreateKey(cfg.PasswordVault.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created password key %v, keep a copy of it somewhere safe: saved passwords can't be read without it\n", cfg.PasswordVault.KeyPath)
+	if os.Getenv(vault.KeyEnv) != "" {
+		fmt.Printf("WARN: %v is set and is used instead of the new key file\n", vault.KeyEnv)
+	}
+
+	return nil
+}
+
+// showPassword prints the video's password, and the passwords of any destinations with a different one.
+func showPassword(db database.UploadDatastore, name string) error {
+	r, err := database.FindUpload(db, name)
+	if err != nil {
+		return fmt.Errorf("could not get upload record %v: %v", name, err)
+	}
+
+	if r.IsEmpty() {
+		return fmt.Errorf("no upload found for %v", name)
+	}
+
+	if r.EncryptedPassword != "" {
+		return fmt.Errorf("could not decrypt the password of %v, check that password_vault.key_path or %v has the key it was saved with", r.Name, vault.KeyEnv)
+	}
+
+	if r.Password == "" {
+		return fmt.Errorf("no password saved for %v", r.Name)
+	}
+
+	fmt.Printf("%v\nvideo link: %v\npassword: %v\n", r.Name, r.VideoURI, r.Password)
+
+	var names []string
+	for n := range r.Destinations {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		d := r.Destinations[n]
+		if d.Password != "" && d.Password != r.Password {
+			fmt.Printf("%v password: %v\n", n, d.Password)
+		}
+	}
+
+	return nil
+}
+
+// rotatePassword sets a new random password on the Vimeo video and saves it. The new password is printed before
+// it's saved so it isn't lost if saving fails.
+func rotatePassword(cfg uploadConfig, videoEditor editor, db, vimeoDB database.UploadDatastore, name string) error {
+	r, err := database.FindUpload(vimeoDB, name)
+	if err != nil {
+		return fmt.Errorf("could not get upload record %v: %v", name, err)
+	}
+
+	if r.IsEmpty() || r.VideoURI == "" {
+		return fmt.Errorf("no uploaded video found for %v", name)
+	}
+
+	if cfg.VimeoSettings.UploadSettings.Privacy.View != "password" {
+		fmt.Printf("WARN: vimeo_settings privacy view is %q, the password is only used if the video's view setting is password\n", cfg.VimeoSettings.UploadSettings.Privacy.View)
+	}
+
+	if cfg.PasswordScope != "" && cfg.PasswordScope != passwordScopeVideo {
+		fmt.Printf("WARN: password_scope is %v, %v will get its own random password instead of sharing one\n", cfg.PasswordScope, r.Name)
+	}
+
+	class, _ := metadata.MatchClass(cfg.Classes, r.Name)
+	password, err := cfg.passphraseOptions(class).Generate()
+	if err != nil {
+		return fmt.Errorf("could not generate password: %v", err)
+	}
+
+	err = videoEditor.Edit(r.VideoURI, vimeo.EditData{Password: password.Text})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v\nvideo link: %v\nnew password: %v (%v)\n", r.Name, r.VideoURI, password.Text, password.Description)
+
+	return savePassword(db, vimeoDB, r, password.Text)
+}
+
+// savePassword saves a new password for the Vimeo video's record. If files go to several destinations, the file's
+// overall password is updated too when it was Vimeo's.
+func savePassword(db, vimeoDB database.UploadDatastore, r database.UploadRecord, password string) error {
+	old := r.Password
+	r.Password = password
+	err := vimeoDB.PutUpload(r)
+	if err != nil {
+		return fmt.Errorf("could not save the new password of %v: %v", r.Name, err)
+	}
+
+	p, err := db.GetUpload(r.Key())
+	if err != nil {
+		return fmt.Errorf("could not save the new password of %v: %v", r.Name, err)
+	}
+
+	if p.Destinations == nil || (p.Password != old && p.Password != "") {
+		return nil
+	}
+
+	p.Password = password
+	err = db.PutUpload(p)
+	if err != nil {
+		return fmt.Errorf("could not save the new password of %v: %v", r.Name, err)
+	}
+
+	return nil
+}
+
+// passphraseOptions returns how the class's video passwords are generated, which can use a different mode than the
+// other classes.
+func (c uploadConfig) passphraseOptions(class metadata.Class) passphrase.Options {
+	o := c.Passphrase
+	if class.PasswordMode != "" {
+		o.Mode = passphrase.Mode(class.PasswordMode)
+	}
+
+	return o
+}
+
+// videoPassword returns the password for a new video. Videos in the same password_scope share a password derived
+// from key, so re-running an upload gives the same password without saving it; otherwise the password is random.
+func (c uploadConfig) videoPassword(key []byte, details metadata.VideoDetails, class metadata.Class) (passphrase.Passphrase, error) {
+	o := c.passphraseOptions(class)
+
+	var scope []string
+	switch c.PasswordScope {
+	case passwordScopeClassTerm:
+		scope = []string{c.PasswordScope, class.Name, details.Term}
+	case passwordScopeClassWeek:
+		scope = []string{c.PasswordScope, class.Name, details.Term, strconv.Itoa(details.Week)}
+	default:
+		return o.Generate()
+	}
+
+	if class.Name == "" {
+		fmt.Printf("WARN: %v doesn't match a class, it will get its own random password\n", details.Filename)
+		return o.Generate()
+	}
+
+	if c.PasswordScope == passwordScopeClassWeek && details.Week == 0 {
+		fmt.Printf("WARN: the week of %v isn't known, it will get its own random password\n", details.Filename)
+		return o.Generate()
+	}
+
+	// class names can't contain a NUL, so scopes can't run together.
+	return o.Derive(key, strings.Join(scope, "\x00"))
+}
+
+// checkPassphrases validates the password options of every class and prints how passwords are generated, with their
+// entropy.
+func checkPassphrases(cfg uploadConfig) error {
+	switch cfg.PasswordScope {
+	case "", passwordScopeVideo:
+	case passwordScopeClassTerm, passwordScopeClassWeek:
+		fmt.Printf("video passwords are shared with password_scope %v\n", cfg.PasswordScope)
+	default:
+		return fmt.Errorf("unknown password_scope %v, expected one of: video, class_term, class_week", cfg.PasswordScope)
+	}
+
+	err := cfg.Passphrase.Validate()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("video passwords: %v\n", cfg.Passphrase.Describe())
+
+	for _, class := range cfg.Classes {
+		if class.PasswordMode == "" {
+			continue
+		}
+
+		o := cfg.passphraseOptions(class)
+		err = o.Validate()
+		if err != nil {
+			return fmt.Errorf("class %v: %v", class.Name, err)
+		}
+		fmt.Printf("%v video passwords: %v\n", class.Name, o.Describe())
+	}
+
+	return nil
+}
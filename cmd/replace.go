@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// runReplace uploads a new file behind an existing video so the link shared with students keeps working.
+func runReplace(conf uploadConfig, videoReplacer replacer, args []string) error {
+	fs := flag.NewFlagSet("replace", flag.ExitOnError)
+	name := fs.String("name", "", "name of the upload record to replace (the video's filename without extension) or its ID.")
+	file := fs.String("file", "", "path to the new video file.")
+	fs.Parse(args)
+
+	if *name == "" || *file == "" {
+		return errors.New("replace requires -name and -file")
+	}
+
+	i, err := os.Stat(*file)
+	if err != nil {
+		return fmt.Errorf("could not read replacement file: %v", err)
+	}
+
+	return videoReplacer.Replace(*name, destination.UploadData{
+		Filename:  filepath.Base(*file),
+		FilePath:  *file,
+		FileSize:  i.Size(),
+		ChunkSize: conf.ChunkSizeMB,
+	})
+}
@@ -0,0 +1,164 @@
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultLanguage = "en"
+	DefaultKind     = "captions"
+)
+
+var (
+	// kinds are the text track types Vimeo accepts.
+	kinds = map[string]bool{
+		"captions":     true,
+		"subtitles":    true,
+		"chapters":     true,
+		"descriptions": true,
+		"metadata":     true,
+	}
+
+	// srtTiming matches an SRT cue timing line, ex. 00:01:02,500 --> 00:01:04,000
+	srtTiming = regexp.MustCompile(`^(\d{2,}:\d{2}:\d{2}),(\d{3}) --> (\d{2,}:\d{2}:\d{2}),(\d{3})(.*)$`)
+
+	// languageTag matches BCP 47 style language tags, ex. en, pt-BR, or zh-Hant-TW.
+	languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+)
+
+// TextTrack is a caption or subtitle file that belongs to a video.
+type TextTrack struct {
+	Path     string
+	Filename string
+	Language string
+	Kind     string
+}
+
+// FindTextTracks looks in dir for .vtt and .srt files named after videoFilename's base name, ex. lecture.mp4 and
+// lecture.en.captions.vtt. An optional language tag and kind, in that order, can come between the base name and
+// extension, using defaultLanguage and captions if they're missing. Files with anything else there, ex. the tracks of
+// "lecture.part2.mp4", aren't the video's.
+func FindTextTracks(dir, videoFilename, defaultLanguage string) ([]TextTrack, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %v for text tracks: %v", dir, err)
+	}
+
+	if defaultLanguage == "" {
+		defaultLanguage = DefaultLanguage
+	}
+
+	base := strings.TrimSuffix(videoFilename, filepath.Ext(videoFilename))
+
+	var tracks []TextTrack
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), base+".") {
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(f.Name()))
+		if ext != ".vtt" && ext != ".srt" {
+			continue
+		}
+
+		// ex. ".en.captions" -> en, captions
+		suffix := strings.TrimPrefix(strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())), base)
+		language, kind, ok := parseSuffix(suffix)
+		if !ok {
+			continue
+		}
+
+		t := TextTrack{
+			Path:     filepath.Join(dir, f.Name()),
+			Filename: f.Name(),
+			Language: defaultLanguage,
+			Kind:     DefaultKind,
+		}
+		if language != "" {
+			t.Language = language
+		}
+		if kind != "" {
+			t.Kind = kind
+		}
+
+		tracks = append(tracks, t)
+	}
+
+	return tracks, nil
+}
+
+// parseSuffix reads the language and kind from what's between a text track's base name and extension, either of
+// which may be empty. It returns false if the suffix isn't an optional language tag followed by an optional kind.
+func parseSuffix(suffix string) (language, kind string, ok bool) {
+	if suffix == "" {
+		return "", "", true
+	}
+
+	parts := strings.Split(strings.TrimPrefix(suffix, "."), ".")
+	if !strings.HasPrefix(suffix, ".") || len(parts) > 2 {
+		return "", "", false
+	}
+
+	if last := strings.ToLower(parts[len(parts)-1]); kinds[last] {
+		kind = last
+		parts = parts[:len(parts)-1]
+	}
+
+	switch {
+	case len(parts) == 0:
+		return "", kind, true
+	case len(parts) == 1 && languageTag.MatchString(parts[0]):
+		return parts[0], kind, true
+	}
+
+	return "", "", false
+}
+
+// WebVTT returns the track's contents in WebVTT format, converting from SRT if needed.
+func (t TextTrack) WebVTT() ([]byte, error) {
+	b, err := os.ReadFile(t.Path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read text track %v: %v", t.Path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(t.Path), ".srt") {
+		return SRTToVTT(b)
+	}
+
+	return b, nil
+}
+
+// SRTToVTT converts SubRip subtitles to WebVTT. Cue numbers are kept as cue identifiers and timestamps have their
+// comma decimal separators replaced.
+func SRTToVTT(srt []byte) ([]byte, error) {
+	srt = bytes.TrimPrefix(srt, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(srt), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	out := strings.Builder{}
+	out.WriteString("WEBVTT\n\n")
+
+	cues := 0
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if m := srtTiming.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			fmt.Fprintf(&out, "%v.%v --> %v.%v%v\n", m[1], m[2], m[3], m[4], m[5])
+			cues++
+			continue
+		}
+
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+
+	if cues == 0 {
+		return nil, errors.New("no SRT cue timings found")
+	}
+
+	return []byte(out.String()), nil
+}
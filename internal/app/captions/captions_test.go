@@ -0,0 +1,103 @@
+package captions_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/captions"
+)
+
+func TestSRTToVTT(t *testing.T) {
+	tests := []struct {
+		name    string
+		srt     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "converts timings and keeps cue numbers and text",
+			srt:  "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,500\r\nHello class\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nLine one\r\nLine two\r\n",
+			want: "WEBVTT\n\n1\n00:00:01.000 --> 00:00:02.500\nHello class\n\n2\n00:00:03.000 --> 00:00:04.000\nLine one\nLine two\n",
+		},
+		{
+			name:    "no cues is an error",
+			srt:     "not a subtitle file",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := captions.SRTToVTT([]byte(tt.srt))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SRTToVTT() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Errorf("SRTToVTT() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindTextTracks(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"Lecture 1.mp4",
+		"Lecture 1.vtt",
+		"Lecture 1.es.subtitles.srt",
+		"Lecture 1.captions.vtt",
+		"Lecture 1.pt-BR.vtt",
+		"Lecture 1.captions.es.vtt",
+		"Lecture 1.notes.vtt",
+		"Lecture 10.vtt",
+		"Lecture 1.jpg",
+		"Lecture 1.part2.mp4",
+		"Lecture 1.part2.vtt",
+		"Lecture 1.part2.de.srt",
+	} {
+		err := os.WriteFile(filepath.Join(dir, f), []byte{}, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	track := func(filename, language, kind string) captions.TextTrack {
+		return captions.TextTrack{Path: filepath.Join(dir, filename), Filename: filename, Language: language, Kind: kind}
+	}
+
+	tests := []struct {
+		video string
+		want  []captions.TextTrack
+	}{
+		{
+			video: "Lecture 1.mp4",
+			want: []captions.TextTrack{
+				track("Lecture 1.captions.vtt", "fr", "captions"),
+				track("Lecture 1.es.subtitles.srt", "es", "subtitles"),
+				track("Lecture 1.pt-BR.vtt", "pt-BR", "captions"),
+				track("Lecture 1.vtt", "fr", "captions"),
+			},
+		},
+		{
+			video: "Lecture 1.part2.mp4",
+			want: []captions.TextTrack{
+				track("Lecture 1.part2.de.srt", "de", "captions"),
+				track("Lecture 1.part2.vtt", "fr", "captions"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.video, func(t *testing.T) {
+			got, err := captions.FindTextTracks(dir, tt.video, "fr")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("FindTextTracks() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,26 +1,184 @@
 package database
 
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
 // UploadDatastore contains access patterns for upload datastores.
 type UploadDatastore interface {
+	// GetUpload gets the record saved under the key, see UploadRecord.Key.
 	GetUpload(key string) (UploadRecord, error)
+	// FindUploads gets every record with the given name, since files with different contents can share a name.
+	FindUploads(name string) ([]UploadRecord, error)
+	// PutUpload saves the record under its key. A record with an ID replaces the record saved under its name before
+	// it had one.
 	PutUpload(item UploadRecord) error
+	ListUploads() ([]UploadRecord, error)
+	AttemptLog
+}
+
+// AttemptLog is an append-only history of upload attempts. Attempts are kept apart from UploadRecords so failures
+// are logged even if they happen before a record is saved, and saving a record never changes its history.
+type AttemptLog interface {
+	// AddAttempt appends an attempt to the history of the upload with the given key.
+	AddAttempt(key string, a Attempt) error
+	// ListAttempts returns the upload's attempts, oldest first.
+	ListAttempts(key string) ([]Attempt, error)
+	// PruneAttempts deletes attempts that started before cutoff, then the oldest attempts of any upload with more
+	// than keep, and returns how many were deleted. A zero cutoff or keep skips that rule.
+	PruneAttempts(cutoff time.Time, keep int) (int, error)
+}
+
+// Attempt is one try at uploading a file to a destination.
+type Attempt struct {
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	// Destination is the destination's name when files are sent to several, otherwise empty.
+	Destination string       `json:"destination,omitempty"`
+	Status      UploadStatus `json:"status"`
+	// StartOffset and EndOffset are the byte offsets the upload resumed from and reached, if the destination
+	// reports them.
+	StartOffset int64  `json:"start_offset"`
+	EndOffset   int64  `json:"end_offset"`
+	BytesSent   int64  `json:"bytes_sent"`
+	Error       string `json:"error,omitempty"`
+	// HTTPStatus is the last HTTP status code received during the attempt, or 0 if there wasn't a response.
+	HTTPStatus int `json:"http_status,omitempty"`
+	// Host is the name of the machine that ran the attempt.
+	Host string `json:"host,omitempty"`
 }
 
 // UploadRecord is information about the status of a file upload attempt and the errors
-// that occurred, if any. If an upload fails but its tus URI is populated, the upload may be resumable
+// that occurred, if any. TusURI holds the destination's resumable upload URI, which for destinations other than
+// Vimeo may not use tus. If an upload fails but its tus URI is populated, the upload may be resumable
 // depending on upload implementation. If an error occurred, the status will be set correspondingly
 // and contain details about the error.
 type UploadRecord struct {
+	// ID identifies the file by its contents so renaming it doesn't lose its record, see FileID. Records saved
+	// before files had IDs don't have one until the migrate-keys command or the next upload of the file adds it.
+	ID             string       `json:"id,omitempty"`
 	Name           string       `json:"name"`
 	CalculatedName string       `json:"calculated_name"`
 	TusURI         string       `json:"tus_uri"`
 	VideoURI       string       `json:"video_uri"`
+	Term           string       `json:"term,omitempty"`
+	Class          string       `json:"class,omitempty"`
 	Status         UploadStatus `json:"status"`
-	ErrorDetails   error        `json:"errorDetails,omitempty"`
+	// ErrorDetails describes the last failure, and is cleared once the upload succeeds.
+	ErrorDetails *ErrorDetails `json:"errorDetails,omitempty"`
+	// Versions are replacement files uploaded behind VideoURI, oldest first.
+	Versions []VideoVersion `json:"versions,omitempty"`
+	// TextTracks are the caption and subtitle files already added to the video.
+	TextTracks []TextTrack `json:"text_tracks,omitempty"`
+	// PictureURI is the custom thumbnail set as the video's active picture, if any.
+	PictureURI string `json:"picture_uri,omitempty"`
+	// EmbedDomains are the domains last set on the video's embed whitelist.
+	EmbedDomains []string `json:"embed_domains,omitempty"`
+	// Playlists are the playlists the video has been added to.
+	Playlists []string `json:"playlists,omitempty"`
+	// UploadID, PartSize, and Parts track a multipart upload so it can resume from the last finished part.
+	UploadID string       `json:"upload_id,omitempty"`
+	PartSize int64        `json:"part_size,omitempty"`
+	Parts    []UploadPart `json:"parts,omitempty"`
+	// Checksum is the hex SHA-256 checksum of the file as verified at the destination, for destinations that check it.
+	Checksum string `json:"checksum,omitempty"`
+	// ContentHash is the hex SHA-256 checksum of the local file, saved once it's uploaded so copies of it can be
+	// recognized.
+	ContentHash string `json:"content_hash,omitempty"`
+	// Size and Duration describe the uploaded file, Duration is 0 if it couldn't be read.
+	Size     int64         `json:"size,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	// UploadedAt is when the upload finished.
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Password is the password viewers need to watch the video, if it has one. It's encrypted into EncryptedPassword
+	// before the record is saved, see the vault package; records saved before then may have it in plain text.
+	Password          string `json:"password,omitempty"`
+	EncryptedPassword string `json:"encrypted_password,omitempty"`
+	// Notification is the email sent about the finished upload, if notifications are configured.
+	Notification *Notification `json:"notification,omitempty"`
+	// Destinations holds each destination's own record when a file is sent to several destinations, keyed by
+	// destination name. The top-level Status is only Complete once every required destination is.
+	Destinations map[string]UploadRecord `json:"destinations,omitempty"`
+}
+
+// ErrorDetails describes why an upload failed.
+type ErrorDetails struct {
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+	// HTTPStatus is the last HTTP status code received before the failure, or 0 if there wasn't a response.
+	HTTPStatus int `json:"http_status,omitempty"`
+	// Offset is how many bytes the destination had received when the upload failed.
+	Offset     int64     `json:"offset,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// ErrorKind is the step of an upload that failed.
+type ErrorKind string
+
+const (
+	// ErrorKindCreate means the destination couldn't create the video or upload session, ex. an invalid name
+	// template, a rejected request, or a quota limit.
+	ErrorKindCreate ErrorKind = "create"
+	// ErrorKindResume means the state of an earlier upload couldn't be read from the destination.
+	ErrorKindResume ErrorKind = "resume"
+	// ErrorKindTransfer means sending the file's contents failed partway through.
+	ErrorKindTransfer ErrorKind = "transfer"
+	// ErrorKindFinish means the file was sent but a later step such as adding captions, a thumbnail, or a playlist
+	// failed. The video exists, so the upload's status stays complete.
+	ErrorKindFinish ErrorKind = "finish"
+)
+
+// Notification records whether the email about an upload was sent.
+type Notification struct {
+	// Status is Complete once the email was sent, or Error if it couldn't be.
+	Status     UploadStatus `json:"status"`
+	Recipients []string     `json:"recipients"`
+	// Attempts is how many times sending was tried.
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// At is when the email was sent or the last attempt failed.
+	At time.Time `json:"at"`
+}
+
+// UploadPart is a finished part of a multipart upload.
+type UploadPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// TextTrack is a caption or subtitle file uploaded alongside a video.
+type TextTrack struct {
+	Filename string `json:"filename"`
+	Language string `json:"language"`
+	Kind     string `json:"kind"`
+	URI      string `json:"uri"`
+}
+
+// VideoVersion is a replacement file uploaded for an existing video so its link and password stay the same.
+// Like UploadRecord, an in-progress version with a tus URI may be resumable.
+type VideoVersion struct {
+	Filename  string       `json:"filename"`
+	URI       string       `json:"uri"`
+	TusURI    string       `json:"tus_uri"`
+	Status    UploadStatus `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Key returns the key the record is saved under: its ID, or its name if it doesn't have one yet.
+func (u UploadRecord) Key() string {
+	if u.ID != "" {
+		return u.ID
+	}
+
+	return u.Name
 }
 
 // IsEmpty checks relevant UploadRecord properties and returns whether it contains data.
-// Name is used as the key so it must not be empty if the record exists.
+// Name must not be empty if the record exists.
 func (u UploadRecord) IsEmpty() bool {
 	if u.Name != "" {
 		return false
@@ -37,3 +195,106 @@ const (
 	InProgress UploadStatus = "IN_PROGRESS"
 	Error      UploadStatus = "ERROR"
 )
+
+// Copy saves every record in from to to, replacing records with the same name, and copies each record's attempts
+// if to has no history for it yet. It returns how many records were copied. Used to move uploads between datastore types.
+func Copy(from, to UploadDatastore) (int, error) {
+	records, err := from.ListUploads()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, r := range records {
+		err = to.PutUpload(r)
+		if err != nil {
+			return i, err
+		}
+
+		// attempts from before the record had an ID are saved under its name.
+		keys := []string{r.Key()}
+		if r.ID != "" {
+			keys = append(keys, r.Name)
+		}
+
+		for _, key := range keys {
+			err = copyAttempts(from, to, key)
+			if err != nil {
+				return i, err
+			}
+		}
+	}
+
+	return len(records), nil
+}
+
+// copyAttempts copies the attempts saved under key, skipping histories that were already copied so copying again
+// doesn't duplicate them.
+func copyAttempts(from, to AttemptLog, key string) error {
+	existing, err := to.ListAttempts(key)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	attempts, err := from.ListAttempts(key)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attempts {
+		err = to.AddAttempt(key, a)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PruneAttemptList applies the PruneAttempts rules to one upload's attempts, oldest first, and returns the attempts
+// to keep.
+func PruneAttemptList(attempts []Attempt, cutoff time.Time, keep int) []Attempt {
+	kept := attempts[:0:0]
+	for _, a := range attempts {
+		if cutoff.IsZero() || !a.StartedAt.Before(cutoff) {
+			kept = append(kept, a)
+		}
+	}
+
+	if keep > 0 && len(kept) > keep {
+		kept = kept[len(kept)-keep:]
+	}
+
+	return kept
+}
+
+// NameFromFilename returns the record name for a video file, its filename without the extension.
+func NameFromFilename(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// FindUpload returns the record saved under the given key, or else the only record with the given name, or an empty
+// record if there isn't one. It's an error if several files have the name, the caller should use one of their IDs.
+func FindUpload(db UploadDatastore, nameOrKey string) (UploadRecord, error) {
+	r, err := db.GetUpload(nameOrKey)
+	if err != nil || !r.IsEmpty() {
+		return r, err
+	}
+
+	records, err := db.FindUploads(nameOrKey)
+	if err != nil {
+		return UploadRecord{}, err
+	}
+
+	switch len(records) {
+	case 0:
+		return UploadRecord{}, nil
+	case 1:
+		return records[0], nil
+	default:
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.Key())
+		}
+		return UploadRecord{}, fmt.Errorf("%v files are named %v, use one of their IDs instead: %v", len(records), nameOrKey, strings.Join(ids, ", "))
+	}
+}
@@ -2,20 +2,34 @@ package filedb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/lock"
 )
 
 type FileDB struct {
-	uploadsFile string
+	uploadsFile  string
+	attemptsFile string
 }
 
 const (
-	uploadsFilename = "uploads.json"
+	uploadsFilename  = "uploads.json"
+	attemptsFilename = "attempts.json"
+	// backupSuffix is added to the uploads filename for the backup of its previous version.
+	backupSuffix = ".bak"
+	// lockSuffix is added to the uploads filename for the file locked while it's being read or written. The
+	// uploads file itself can't be locked since it's replaced on every write.
+	lockSuffix = ".lock"
+	// lockTimeout is how long to wait for another process to finish with the uploads file.
+	lockTimeout = 30 * time.Second
 )
 
 func New(outputFolder string) (FileDB, error) {
@@ -29,89 +43,406 @@ func New(outputFolder string) (FileDB, error) {
 	}
 
 	return FileDB{
-		uploadsFile: fmt.Sprintf("%v%v", outputFolder, uploadsFilename),
+		uploadsFile:  fmt.Sprintf("%v%v", outputFolder, uploadsFilename),
+		attemptsFile: fmt.Sprintf("%v%v", outputFolder, attemptsFilename),
 	}, nil
 }
 
 // GetUpload reads the uploadsFile and gets the record if it exists or returns an empty UploadRecord.
 func (f FileDB) GetUpload(key string) (database.UploadRecord, error) {
-	file, err := os.OpenFile(f.uploadsFile, os.O_CREATE|os.O_RDONLY, 0644)
+	l, err := f.lock()
 	if err != nil {
-		return database.UploadRecord{}, fmt.Errorf("error opening uploads file: %v", err)
+		return database.UploadRecord{}, err
 	}
-	defer file.Close()
+	defer l.Release()
 
-	s, err := file.Stat()
+	uploadRecords, err := f.readRecords()
 	if err != nil {
-		return database.UploadRecord{}, fmt.Errorf("error checking uploads file length: %v", err)
+		return database.UploadRecord{}, err
 	}
 
-	if s.Size() == 0 {
-		return database.UploadRecord{}, nil
+	return uploadRecords[key], nil
+}
+
+// FindUploads reads the uploadsFile and returns the records with the given name.
+func (f FileDB) FindUploads(name string) ([]database.UploadRecord, error) {
+	records, err := f.ListUploads()
+	if err != nil {
+		return nil, err
 	}
 
-	// bad practice: read in the whole file. however, file should only grow by ~200kb max per year if a new
-	// file is not generated per year.
-	bytes, err := io.ReadAll(file)
+	var found []database.UploadRecord
+	for _, r := range records {
+		if r.Name == name {
+			found = append(found, r)
+		}
+	}
+
+	return found, nil
+}
+
+// ListUploads reads the uploadsFile and returns every record in it sorted by name.
+func (f FileDB) ListUploads() ([]database.UploadRecord, error) {
+	l, err := f.lock()
 	if err != nil {
-		return database.UploadRecord{}, fmt.Errorf("error reading uploads file: %v", err)
+		return nil, err
 	}
+	defer l.Release()
 
-	var uploadRecords map[string]database.UploadRecord
-	err = json.Unmarshal(bytes, &uploadRecords)
+	uploadRecords, err := f.readRecords()
 	if err != nil {
-		return database.UploadRecord{}, fmt.Errorf("error unmarshaling uploads file: %v", err)
+		return nil, err
 	}
 
-	return uploadRecords[key], nil
+	if len(uploadRecords) == 0 {
+		return nil, nil
+	}
+
+	records := make([]database.UploadRecord, 0, len(uploadRecords))
+	for _, r := range uploadRecords {
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].Key() < records[j].Key()
+	})
+
+	return records, nil
 }
 
-// PutUpload writes the given UploadRecord to the uploadFile, overwriting the current item if it exists.
+// PutUpload writes the given UploadRecord to the uploadFile under its key, overwriting the current item if it exists.
+// A record with an ID replaces the one saved under its name before it had an ID.
 func (f FileDB) PutUpload(item database.UploadRecord) error {
 	if item.Name == "" {
 		return fmt.Errorf("cannnot save item %+v, name is empty", item)
 	}
 
-	file, err := os.OpenFile(f.uploadsFile, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	l, err := f.lock()
 	if err != nil {
-		return fmt.Errorf("error opening uploads file: %v", err)
+		return err
 	}
-	defer file.Close()
+	defer l.Release()
 
-	s, err := file.Stat()
+	uploadRecords, err := f.readRecords()
 	if err != nil {
-		return fmt.Errorf("error checking uploads file length: %v", err)
+		return err
 	}
 
-	var uploadRecords map[string]database.UploadRecord
+	if legacy, ok := uploadRecords[item.Name]; ok && item.ID != "" && legacy.ID == "" {
+		delete(uploadRecords, item.Name)
+	}
+	uploadRecords[item.Key()] = item
 
-	if s.Size() == 0 {
-		uploadRecords = make(map[string]database.UploadRecord)
-	} else {
-		// bad practice: read in the whole file. however, file should only grow by ~200kb max per year if a new
-		// file is not generated per year.
-		bytes, err := io.ReadAll(file)
-		if err != nil {
-			return fmt.Errorf("error reading uploads file: %v", err)
+	newBytes, err := json.Marshal(&uploadRecords)
+	if err != nil {
+		return fmt.Errorf("error marshaling uploads data: %v", err)
+	}
+
+	err = writeFile(f.uploadsFile, newBytes)
+	if err != nil {
+		return fmt.Errorf("error writing updated upload records: %v", err)
+	}
+
+	return nil
+}
+
+// AddAttempt appends the attempt to the upload's history in the attemptsFile.
+func (f FileDB) AddAttempt(key string, a database.Attempt) error {
+	l, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+
+	attempts, err := f.readAttempts()
+	if err != nil {
+		return err
+	}
+
+	attempts[key] = append(attempts[key], a)
+	return f.writeAttempts(attempts)
+}
+
+// ListAttempts returns the upload's attempts from the attemptsFile, oldest first.
+func (f FileDB) ListAttempts(key string) ([]database.Attempt, error) {
+	l, err := f.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.Release()
+
+	attempts, err := f.readAttempts()
+	if err != nil {
+		return nil, err
+	}
+
+	return attempts[key], nil
+}
+
+// PruneAttempts removes old attempts from the attemptsFile.
+func (f FileDB) PruneAttempts(cutoff time.Time, keep int) (int, error) {
+	l, err := f.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer l.Release()
+
+	attempts, err := f.readAttempts()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for key, a := range attempts {
+		kept := database.PruneAttemptList(a, cutoff, keep)
+		pruned += len(a) - len(kept)
+
+		if len(kept) == 0 {
+			delete(attempts, key)
+		} else {
+			attempts[key] = kept
 		}
+	}
+
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	return pruned, f.writeAttempts(attempts)
+}
 
-		err = json.Unmarshal(bytes, &uploadRecords)
+func (f FileDB) readAttempts() (map[string][]database.Attempt, error) {
+	var attempts map[string][]database.Attempt
+	err := readFile(f.attemptsFile, func(bytes []byte) error {
+		attempts = make(map[string][]database.Attempt)
+		if len(bytes) == 0 {
+			return nil
+		}
+
+		err := json.Unmarshal(bytes, &attempts)
 		if err != nil {
-			return fmt.Errorf("error unmarshaling uploads file: %v", err)
+			return fmt.Errorf("error unmarshaling attempts file: %v", err)
 		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	uploadRecords[item.Name] = item
+	return attempts, nil
+}
 
-	newBytes, err := json.Marshal(&uploadRecords)
+func (f FileDB) writeAttempts(attempts map[string][]database.Attempt) error {
+	newBytes, err := json.Marshal(attempts)
 	if err != nil {
-		return fmt.Errorf("error marshaling uploads data: %v", err)
+		return fmt.Errorf("error marshaling attempts: %v", err)
 	}
 
-	err = os.WriteFile(f.uploadsFile, newBytes, 0666)
+	err = writeFile(f.attemptsFile, newBytes)
 	if err != nil {
-		return fmt.Errorf("error writing updated upload records: %v", err)
+		return fmt.Errorf("error writing attempts: %v", err)
 	}
 
 	return nil
 }
+
+// readRecords reads every record in the uploadsFile.
+func (f FileDB) readRecords() (map[string]database.UploadRecord, error) {
+	// bad practice: read in the whole file. however, file should only grow by ~200kb max per year if a new
+	// file is not generated per year.
+	var records map[string]database.UploadRecord
+	err := readFile(f.uploadsFile, func(bytes []byte) error {
+		var pErr error
+		records, pErr = parseRecords(bytes)
+		return pErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// readFile reads a file written by writeFile and passes its contents to parse. If the file is missing or can't be
+// parsed, for example because a write was interrupted, it's recovered from the backup of the previous version. A
+// missing file without a backup is created empty.
+func readFile(name string, parse func(bytes []byte) error) error {
+	bytes, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading %v: %v", filepath.Base(name), err)
+	}
+
+	if err == nil {
+		pErr := parse(bytes)
+		if pErr == nil {
+			return nil
+		}
+
+		fmt.Printf("WARN: %v is corrupt (%v), recovering from backup...\n", name, pErr)
+		return recoverFile(name, bytes, parse)
+	}
+
+	// the file is missing but has a backup, ex. an older version was interrupted between backing up and replacing it.
+	if _, bErr := os.Stat(name + backupSuffix); bErr == nil {
+		fmt.Printf("WARN: %v is missing, recovering from backup...\n", name)
+		return recoverFile(name, nil, parse)
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening %v: %v", filepath.Base(name), err)
+	}
+	file.Close()
+
+	return parse(nil)
+}
+
+// recoverFile restores a file from its backup, which is passed to parse. The unreadable contents, if any, are kept
+// next to the file so they can be inspected.
+func recoverFile(name string, corrupt []byte, parse func(bytes []byte) error) error {
+	backup, err := os.ReadFile(name + backupSuffix)
+	if err != nil {
+		return fmt.Errorf("%v could not be read and there is no usable backup: %v", filepath.Base(name), err)
+	}
+
+	err = parse(backup)
+	if err != nil {
+		return fmt.Errorf("%v could not be read and neither could the backup: %v", filepath.Base(name), err)
+	}
+
+	if len(corrupt) > 0 {
+		corruptFile := fmt.Sprintf("%v.corrupt-%v", name, time.Now().Format("20060102T150405"))
+		wErr := os.WriteFile(corruptFile, corrupt, 0644)
+		if wErr != nil {
+			fmt.Printf("WARN: could not save corrupt file for inspection: %v\n", wErr)
+		} else {
+			fmt.Printf("WARN: saved corrupt file as %v\n", corruptFile)
+		}
+	}
+
+	err = writeFileAtomic(name, backup)
+	if err != nil {
+		return fmt.Errorf("could not restore %v from backup: %v", filepath.Base(name), err)
+	}
+
+	return nil
+}
+
+// writeFile replaces a file with newBytes without ever leaving a partially written or missing file in its place. The
+// previous version is kept as a backup.
+func writeFile(name string, newBytes []byte) error {
+	err := backUp(name)
+	if err != nil {
+		return fmt.Errorf("could not back up %v: %v", filepath.Base(name), err)
+	}
+
+	return writeFileAtomic(name, newBytes)
+}
+
+// backUp replaces the backup of a file with its current version. The backup is a hard link to the file where the
+// filesystem supports it, which stays pointed at the current version once a new one is renamed over the file.
+func backUp(name string) error {
+	backup := name + backupSuffix
+
+	err := os.Remove(backup)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.Link(name, backup)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(backup, data)
+}
+
+// lock takes the uploads file's lock so other processes don't read or write it at the same time.
+func (f FileDB) lock() (*lock.File, error) {
+	l, err := lock.Acquire(f.uploadsFile+lockSuffix, lockTimeout)
+	if errors.Is(err, lock.ErrLocked) {
+		return nil, fmt.Errorf("uploads file is still in use by another process after %v", lockTimeout)
+	}
+
+	return l, err
+}
+
+func parseRecords(bytes []byte) (map[string]database.UploadRecord, error) {
+	uploadRecords := make(map[string]database.UploadRecord)
+	if len(bytes) == 0 {
+		return uploadRecords, nil
+	}
+
+	err := json.Unmarshal(bytes, &uploadRecords)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling uploads file: %v", err)
+	}
+
+	return uploadRecords, nil
+}
+
+// writeFileAtomic replaces name with data by renaming a synced temp file over it.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := writeTemp(name, data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp, name)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	syncDir(filepath.Dir(name))
+	return nil
+}
+
+// writeTemp writes data to a temp file next to name and syncs it to disk, returning the temp file's path.
+func writeTemp(name string, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create temp file: %v", err)
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	cErr := tmp.Close()
+	if err == nil {
+		err = cErr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("could not write temp file: %v", err)
+	}
+
+	return tmp.Name(), nil
+}
+
+// syncDir makes renames in dir durable. Not every platform supports syncing directories, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	d.Sync()
+}
@@ -1,10 +1,16 @@
 package filedb_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/nmalensek/video-uploader/internal/app/database"
@@ -16,6 +22,13 @@ func removeTestFile() {
 	if err != nil {
 		log.Fatal("unable to delete test uploads file")
 	}
+
+	for _, f := range []string{"./uploads.json.bak", "./uploads.json.lock"} {
+		err = os.Remove(f)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("unable to delete test file %v", f)
+		}
+	}
 }
 
 func TestFileDB_GetUpload(t *testing.T) {
@@ -136,8 +149,14 @@ func TestFileDB_GetPutEndToEnd(t *testing.T) {
 		CalculatedName: "test item 2",
 		TusURI:         "https://test.com",
 		VideoURI:       "/videos/1234",
-		Status:         database.InProgress,
-		ErrorDetails:   nil,
+		Status:         database.Error,
+		ErrorDetails: &database.ErrorDetails{
+			Kind:       database.ErrorKindTransfer,
+			Message:    "received error status code 500",
+			HTTPStatus: 500,
+			Offset:     1000000,
+			OccurredAt: time.Date(2023, 2, 1, 9, 30, 0, 0, time.UTC),
+		},
 	}
 
 	err = fdb.PutUpload(testItemTwo)
@@ -181,3 +200,336 @@ func TestFileDB_GetPutEndToEnd(t *testing.T) {
 	}
 
 }
+
+func TestFileDB_ListUploads(t *testing.T) {
+	defer removeTestFile()
+	fdb, err := filedb.New(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := fdb.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 0 {
+		t.Fatalf("TestFileDB_ListUploads() expected no records, got: %+v", records)
+	}
+
+	want := []database.UploadRecord{
+		{
+			Name:     "a lecture",
+			VideoURI: "https://vimeo.com/1",
+			Term:     "2023 Spring",
+			Status:   database.Complete,
+		},
+		{
+			Name:     "b lecture",
+			VideoURI: "https://vimeo.com/2",
+			Term:     "2023 Summer",
+			Status:   database.InProgress,
+		},
+	}
+
+	// put out of order to check sorting.
+	for i := len(want) - 1; i >= 0; i-- {
+		err = fdb.PutUpload(want[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := fdb.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("TestFileDB_ListUploads() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileDB_Recovery(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakFile   func(t *testing.T, uploadsFile string)
+		wantCorrupt bool
+	}{
+		{
+			name: "write interrupted partway through",
+			breakFile: func(t *testing.T, uploadsFile string) {
+				err := os.WriteFile(uploadsFile, []byte(`{"a lecture":{"name":"a lec`), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCorrupt: true,
+		},
+		{
+			name: "valid JSON that isn't upload records",
+			breakFile: func(t *testing.T, uploadsFile string) {
+				err := os.WriteFile(uploadsFile, []byte(`{"a lecture":"a lecture"}`), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCorrupt: true,
+		},
+		{
+			name: "file deleted",
+			breakFile: func(t *testing.T, uploadsFile string) {
+				err := os.Remove(uploadsFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fdb, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			first := database.UploadRecord{Name: "a lecture", Status: database.Complete}
+			err = fdb.PutUpload(first)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the second write backs up the first version.
+			err = fdb.PutUpload(database.UploadRecord{Name: "b lecture", Status: database.InProgress})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uploadsFile := filepath.Join(dir, "uploads.json")
+			tt.breakFile(t, uploadsFile)
+
+			got, err := fdb.GetUpload("a lecture")
+			if err != nil {
+				t.Fatalf("GetUpload() did not recover from backup: %v", err)
+			}
+
+			if diff := cmp.Diff(first, got); diff != "" {
+				t.Errorf("GetUpload() mismatch (-want +got):\n%s", diff)
+			}
+
+			// the primary file was restored so it can be written to again.
+			err = fdb.PutUpload(database.UploadRecord{Name: "c lecture", Status: database.InProgress})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := fdb.ListUploads()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(records) != 2 {
+				t.Errorf("ListUploads() = %+v, want the backed up record and the new one", records)
+			}
+
+			corrupt, _ := filepath.Glob(uploadsFile + ".corrupt-*")
+			if (len(corrupt) == 1) != tt.wantCorrupt {
+				t.Errorf("corrupt copies = %v, want one: %v", corrupt, tt.wantCorrupt)
+			}
+		})
+	}
+}
+
+func TestFileDB_PutUploadLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a lecture", "b lecture", "c lecture"} {
+		err = fdb.PutUpload(database.UploadRecord{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	if diff := cmp.Diff([]string{"uploads.json", "uploads.json.bak", "uploads.json.lock"}, names); diff != "" {
+		t.Errorf("files after PutUpload() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the backup is the version before the last write.
+	backup, err := os.ReadFile(filepath.Join(dir, "uploads.json.bak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records map[string]database.UploadRecord
+	err = json.Unmarshal(backup, &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records["c lecture"].Name != "" {
+		t.Errorf("backup = %+v, want the first two records", records)
+	}
+}
+
+// writerEnv tells a test binary started by TestFileDB_ConcurrentProcesses to write records instead of running tests.
+const writerEnv = "FILEDB_TEST_WRITER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(writerEnv) != "" {
+		os.Exit(writeRecords())
+	}
+
+	os.Exit(m.Run())
+}
+
+// writeRecords writes records named after this writer to the uploads file in FILEDB_TEST_DIR.
+func writeRecords() int {
+	fdb, err := filedb.New(os.Getenv("FILEDB_TEST_DIR"))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	count, _ := strconv.Atoi(os.Getenv("FILEDB_TEST_COUNT"))
+	for i := 0; i < count; i++ {
+		err = fdb.PutUpload(database.UploadRecord{
+			Name:   fmt.Sprintf("%v-%v", os.Getenv(writerEnv), i),
+			Status: database.Complete,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func TestFileDB_ConcurrentProcesses(t *testing.T) {
+	const writers = 4
+	const perWriter = 25
+
+	dir := t.TempDir()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cmds []*exec.Cmd
+	for w := 0; w < writers; w++ {
+		cmd := exec.Command(exe)
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("%v=writer%v", writerEnv, w),
+			"FILEDB_TEST_DIR="+dir,
+			fmt.Sprintf("FILEDB_TEST_COUNT=%v", perWriter),
+		)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		err = cmd.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	for _, cmd := range cmds {
+		err = cmd.Wait()
+		if err != nil {
+			t.Errorf("writer process failed: %v", err)
+		}
+	}
+
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := fdb.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without locking, writers overwrite each other's changes and records go missing.
+	if len(records) != writers*perWriter {
+		t.Errorf("ListUploads() returned %v records, want %v", len(records), writers*perWriter)
+	}
+}
+
+func TestFileDB_Attempts(t *testing.T) {
+	f, err := filedb.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2023, 2, 1, 9, 0, 0, 0, time.UTC)
+	var want []database.Attempt
+	for i := 0; i < 4; i++ {
+		a := database.Attempt{
+			StartedAt:   start.Add(time.Duration(i) * 24 * time.Hour),
+			EndedAt:     start.Add(time.Duration(i)*24*time.Hour + time.Minute),
+			Status:      database.Error,
+			StartOffset: int64(i) * 100,
+			EndOffset:   int64(i+1) * 100,
+			BytesSent:   100,
+			Error:       "connection reset",
+			HTTPStatus:  500,
+			Host:        "lab-pc",
+		}
+		want = append(want, a)
+
+		err = f.AddAttempt("a lecture", a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = f.AddAttempt("another lecture", database.Attempt{StartedAt: start.Add(96 * time.Hour), Status: database.Complete})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := f.ListAttempts("a lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListAttempts() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the first attempt is too old and only the newest two of the rest are kept.
+	n, err := f.PruneAttempts(start.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("PruneAttempts() = %v, want 2", n)
+	}
+
+	got, _ = f.ListAttempts("a lecture")
+	if diff := cmp.Diff(want[2:], got); diff != "" {
+		t.Errorf("ListAttempts() after pruning mismatch (-want +got):\n%s", diff)
+	}
+
+	got, _ = f.ListAttempts("another lecture")
+	if len(got) != 1 {
+		t.Errorf("PruneAttempts() removed another upload's attempt, got %+v", got)
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import "time"
+
+// ScopedDatastore stores one destination's records inside the Destinations map of another datastore's records, so
+// uploaders written for a single destination can share a datastore with others.
+type ScopedDatastore struct {
+	parent      UploadDatastore
+	destination string
+	// legacyDestination owns records saved before files had several destinations.
+	legacyDestination string
+}
+
+// Scoped returns a datastore for the named destination. Records saved without any destinations are treated as
+// belonging to legacyDestination so their uploads aren't repeated; it can be empty if there aren't any.
+func Scoped(parent UploadDatastore, destination, legacyDestination string) ScopedDatastore {
+	return ScopedDatastore{
+		parent:            parent,
+		destination:       destination,
+		legacyDestination: legacyDestination,
+	}
+}
+
+// GetUpload returns the destination's record for the key or an empty UploadRecord.
+func (s ScopedDatastore) GetUpload(key string) (UploadRecord, error) {
+	p, err := s.parent.GetUpload(key)
+	if err != nil {
+		return UploadRecord{}, err
+	}
+
+	return s.scope(p), nil
+}
+
+// FindUploads returns the destination's record from every parent record with the given name that has one.
+func (s ScopedDatastore) FindUploads(name string) ([]UploadRecord, error) {
+	parents, err := s.parent.FindUploads(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []UploadRecord
+	for _, p := range parents {
+		r := s.scope(p)
+		if !r.IsEmpty() {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+// PutUpload saves the destination's record inside its parent record, creating the parent if needed. A parent saved
+// under the record's name before the file had an ID is given the record's ID.
+func (s ScopedDatastore) PutUpload(item UploadRecord) error {
+	p, err := s.parent.GetUpload(item.Key())
+	if err != nil {
+		return err
+	}
+
+	if p.IsEmpty() && item.ID != "" {
+		p, err = s.parent.GetUpload(item.Name)
+		if err != nil {
+			return err
+		}
+
+		if p.ID != "" {
+			p = UploadRecord{}
+		}
+	}
+
+	if p.IsEmpty() {
+		p = UploadRecord{
+			ID:             item.ID,
+			Name:           item.Name,
+			CalculatedName: item.CalculatedName,
+			Term:           item.Term,
+			Status:         InProgress,
+			Destinations:   make(map[string]UploadRecord),
+		}
+	}
+
+	// records saved before files had several destinations keep their state under the legacy destination.
+	if p.Destinations == nil {
+		legacy := p
+		p.Destinations = make(map[string]UploadRecord)
+		if s.legacyDestination != "" {
+			p.Destinations[s.legacyDestination] = legacy
+		}
+	}
+
+	if item.ID != "" {
+		p.ID = item.ID
+	}
+	p.Name = item.Name
+	item.Destinations = nil
+	p.Destinations[s.destination] = item
+
+	return s.parent.PutUpload(p)
+}
+
+// ListUploads returns the destination's record from every parent record that has one.
+func (s ScopedDatastore) ListUploads() ([]UploadRecord, error) {
+	parents, err := s.parent.ListUploads()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []UploadRecord
+	for _, p := range parents {
+		r := s.scope(p)
+		if !r.IsEmpty() {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+// AddAttempt adds the attempt to the parent's history, since attempts are already labeled with their destination.
+func (s ScopedDatastore) AddAttempt(key string, a Attempt) error {
+	if a.Destination == "" {
+		a.Destination = s.destination
+	}
+
+	return s.parent.AddAttempt(key, a)
+}
+
+// ListAttempts returns the destination's attempts for the upload.
+func (s ScopedDatastore) ListAttempts(key string) ([]Attempt, error) {
+	attempts, err := s.parent.ListAttempts(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var scoped []Attempt
+	for _, a := range attempts {
+		if a.Destination == s.destination {
+			scoped = append(scoped, a)
+		}
+	}
+
+	return scoped, nil
+}
+
+// PruneAttempts prunes every destination's attempts in the parent.
+func (s ScopedDatastore) PruneAttempts(cutoff time.Time, keep int) (int, error) {
+	return s.parent.PruneAttempts(cutoff, keep)
+}
+
+// scope returns the destination's part of a parent record, which has the parent's ID so it's saved back to the same
+// parent.
+func (s ScopedDatastore) scope(p UploadRecord) UploadRecord {
+	if r, ok := p.Destinations[s.destination]; ok {
+		r.ID = p.ID
+		return r
+	}
+
+	if p.Destinations == nil && s.destination == s.legacyDestination {
+		return p
+	}
+
+	return UploadRecord{}
+}
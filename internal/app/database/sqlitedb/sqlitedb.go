@@ -0,0 +1,415 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+
+	// registers the pure-Go "sqlite" driver.
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDB stores upload records in an SQLite database. Fields that are searched on have their own columns and the
+// rest of each record is stored as JSON, so new UploadRecord fields don't need a migration.
+type SQLiteDB struct {
+	db *sql.DB
+}
+
+const (
+	// DefaultFilename is the database's name in the upload status folder if no path is configured.
+	DefaultFilename = "uploads.db"
+	// busyTimeoutMS is how long to wait for another process's write to finish before failing.
+	busyTimeoutMS = 30000
+)
+
+// migrations are applied in order to bring the schema up to date. The number applied is kept in the database's
+// user_version, so existing migrations must never change; add a new one instead.
+var migrations = []string{
+	`CREATE TABLE uploads (
+		name TEXT PRIMARY KEY,
+		calculated_name TEXT NOT NULL DEFAULT '',
+		term TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		video_uri TEXT NOT NULL DEFAULT '',
+		record TEXT NOT NULL
+	);
+	CREATE INDEX uploads_status ON uploads (status);
+	CREATE INDEX uploads_term ON uploads (term);
+
+	CREATE TABLE destinations (
+		upload_name TEXT NOT NULL REFERENCES uploads (name) ON DELETE CASCADE,
+		destination TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT '',
+		video_uri TEXT NOT NULL DEFAULT '',
+		record TEXT NOT NULL,
+		PRIMARY KEY (upload_name, destination)
+	);
+	CREATE INDEX destinations_status ON destinations (status);`,
+
+	// attempts are logged before an upload has a record, so they can't reference uploads.
+	`CREATE TABLE attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		upload_name TEXT NOT NULL,
+		destination TEXT NOT NULL DEFAULT '',
+		started_at TEXT NOT NULL,
+		ended_at TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		start_offset INTEGER NOT NULL DEFAULT 0,
+		end_offset INTEGER NOT NULL DEFAULT 0,
+		bytes_sent INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		http_status INTEGER NOT NULL DEFAULT 0,
+		host TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX attempts_upload_name ON attempts (upload_name, started_at);
+	CREATE INDEX attempts_started_at ON attempts (started_at);`,
+
+	// records are keyed by the file's ID, or its name if it doesn't have one, and the name becomes an index.
+	`ALTER TABLE uploads RENAME COLUMN name TO record_key;
+	ALTER TABLE uploads ADD COLUMN name TEXT NOT NULL DEFAULT '';
+	UPDATE uploads SET name = record_key;
+	CREATE INDEX uploads_name ON uploads (name);
+	ALTER TABLE destinations RENAME COLUMN upload_name TO upload_key;
+	ALTER TABLE attempts RENAME COLUMN upload_name TO upload_key;`,
+}
+
+// timeFormat is used for attempt times so they sort correctly as text.
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// New opens or creates the database at path and applies any migrations it's missing.
+func New(path string) (SQLiteDB, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%v?_pragma=busy_timeout(%v)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)", path, busyTimeoutMS))
+	if err != nil {
+		return SQLiteDB{}, fmt.Errorf("could not open database %v: %v", path, err)
+	}
+
+	s := SQLiteDB{db: db}
+	err = s.migrate()
+	if err != nil {
+		db.Close()
+		return SQLiteDB{}, fmt.Errorf("could not update database %v schema: %v", path, err)
+	}
+
+	return s, nil
+}
+
+// Close closes the database.
+func (s SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies the migrations the database doesn't have yet, each in its own transaction.
+func (s SQLiteDB) migrate() error {
+	var version int
+	err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %v is newer than this program supports (%v)", version, len(migrations))
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(migrations[i])
+		if err == nil {
+			// PRAGMA doesn't accept parameters.
+			_, err = tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %v failed: %v", i+1, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUpload gets the record if it exists or returns an empty UploadRecord.
+func (s SQLiteDB) GetUpload(key string) (database.UploadRecord, error) {
+	var recordJSON string
+	err := s.db.QueryRow(`SELECT record FROM uploads WHERE record_key = ?`, key).Scan(&recordJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.UploadRecord{}, nil
+	}
+	if err != nil {
+		return database.UploadRecord{}, fmt.Errorf("error getting upload %v: %v", key, err)
+	}
+
+	r, err := unmarshalRecord(recordJSON)
+	if err != nil {
+		return database.UploadRecord{}, err
+	}
+
+	r.Destinations, err = s.destinations(key)
+	if err != nil {
+		return database.UploadRecord{}, err
+	}
+
+	return r, nil
+}
+
+// FindUploads returns the records with the given name.
+func (s SQLiteDB) FindUploads(name string) ([]database.UploadRecord, error) {
+	return s.queryUploads(`SELECT record FROM uploads WHERE name = ? ORDER BY record_key`, name)
+}
+
+// ListUploads returns every record sorted by name.
+func (s SQLiteDB) ListUploads() ([]database.UploadRecord, error) {
+	return s.queryUploads(`SELECT record FROM uploads ORDER BY name, record_key`)
+}
+
+// queryUploads returns the records selected by query along with their destinations.
+func (s SQLiteDB) queryUploads(query string, args ...interface{}) ([]database.UploadRecord, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing uploads: %v", err)
+	}
+	defer rows.Close()
+
+	var records []database.UploadRecord
+	for rows.Next() {
+		var recordJSON string
+		err = rows.Scan(&recordJSON)
+		if err != nil {
+			return nil, fmt.Errorf("error reading upload: %v", err)
+		}
+
+		r, err := unmarshalRecord(recordJSON)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error listing uploads: %v", err)
+	}
+
+	// read destinations after the rows are closed, the connection pool may only have one connection.
+	rows.Close()
+	for i := range records {
+		records[i].Destinations, err = s.destinations(records[i].Key())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// PutUpload saves the given UploadRecord under its key, overwriting the current item and its destinations if it
+// exists. A record with an ID replaces the one saved under its name before it had an ID.
+func (s SQLiteDB) PutUpload(item database.UploadRecord) error {
+	if item.Name == "" {
+		return fmt.Errorf("cannnot save item %+v, name is empty", item)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	recordJSON, err := marshalRecord(item)
+	if err != nil {
+		return err
+	}
+
+	if item.ID != "" {
+		// IDs are never names, so a record keyed by the name was saved before the file had an ID.
+		_, err = tx.Exec(`DELETE FROM uploads WHERE record_key = ? AND record_key != ?`, item.Name, item.ID)
+		if err != nil {
+			return fmt.Errorf("error replacing upload %v saved without an ID: %v", item.Name, err)
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO uploads (record_key, name, calculated_name, term, status, video_uri, record) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (record_key) DO UPDATE SET name = excluded.name, calculated_name = excluded.calculated_name,
+		term = excluded.term, status = excluded.status, video_uri = excluded.video_uri, record = excluded.record`,
+		item.Key(), item.Name, item.CalculatedName, item.Term, string(item.Status), item.VideoURI, recordJSON)
+	if err != nil {
+		return fmt.Errorf("error saving upload %v: %v", item.Name, err)
+	}
+
+	_, err = tx.Exec(`DELETE FROM destinations WHERE upload_key = ?`, item.Key())
+	if err != nil {
+		return fmt.Errorf("error saving upload %v destinations: %v", item.Name, err)
+	}
+
+	for name, d := range item.Destinations {
+		destJSON, err := marshalRecord(d)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO destinations (upload_key, destination, status, video_uri, record) VALUES (?, ?, ?, ?, ?)`,
+			item.Key(), name, string(d.Status), d.VideoURI, destJSON)
+		if err != nil {
+			return fmt.Errorf("error saving upload %v destination %v: %v", item.Name, name, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error saving upload %v: %v", item.Name, err)
+	}
+
+	return nil
+}
+
+// AddAttempt appends the attempt to the upload's history.
+func (s SQLiteDB) AddAttempt(key string, a database.Attempt) error {
+	_, err := s.db.Exec(`INSERT INTO attempts (upload_key, destination, started_at, ended_at, status, start_offset,
+		end_offset, bytes_sent, error, http_status, host) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key, a.Destination, formatTime(a.StartedAt), formatTime(a.EndedAt), string(a.Status), a.StartOffset,
+		a.EndOffset, a.BytesSent, a.Error, a.HTTPStatus, a.Host)
+	if err != nil {
+		return fmt.Errorf("error saving attempt for %v: %v", key, err)
+	}
+
+	return nil
+}
+
+// ListAttempts returns the upload's attempts, oldest first.
+func (s SQLiteDB) ListAttempts(key string) ([]database.Attempt, error) {
+	rows, err := s.db.Query(`SELECT destination, started_at, ended_at, status, start_offset, end_offset, bytes_sent,
+		error, http_status, host FROM attempts WHERE upload_key = ? ORDER BY started_at, id`, key)
+	if err != nil {
+		return nil, fmt.Errorf("error getting attempts for %v: %v", key, err)
+	}
+	defer rows.Close()
+
+	var attempts []database.Attempt
+	for rows.Next() {
+		var a database.Attempt
+		var started, ended, status string
+		err = rows.Scan(&a.Destination, &started, &ended, &status, &a.StartOffset, &a.EndOffset, &a.BytesSent,
+			&a.Error, &a.HTTPStatus, &a.Host)
+		if err != nil {
+			return nil, fmt.Errorf("error reading attempt for %v: %v", key, err)
+		}
+
+		a.Status = database.UploadStatus(status)
+		a.StartedAt = parseTime(started)
+		a.EndedAt = parseTime(ended)
+		attempts = append(attempts, a)
+	}
+
+	return attempts, rows.Err()
+}
+
+// PruneAttempts deletes old attempts.
+func (s SQLiteDB) PruneAttempts(cutoff time.Time, keep int) (int, error) {
+	var pruned int64
+
+	if !cutoff.IsZero() {
+		res, err := s.db.Exec(`DELETE FROM attempts WHERE started_at < ?`, formatTime(cutoff))
+		if err != nil {
+			return 0, fmt.Errorf("error pruning attempts: %v", err)
+		}
+
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	if keep > 0 {
+		res, err := s.db.Exec(`DELETE FROM attempts WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY upload_key ORDER BY started_at DESC, id DESC) AS newest
+				FROM attempts
+			) WHERE newest > ?
+		)`, keep)
+		if err != nil {
+			return int(pruned), fmt.Errorf("error pruning attempts: %v", err)
+		}
+
+		n, _ := res.RowsAffected()
+		pruned += n
+	}
+
+	return int(pruned), nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(timeFormat)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(timeFormat, s)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// destinations returns the upload's destination records, or nil if it doesn't have any.
+func (s SQLiteDB) destinations(key string) (map[string]database.UploadRecord, error) {
+	rows, err := s.db.Query(`SELECT destination, record FROM destinations WHERE upload_key = ?`, key)
+	if err != nil {
+		return nil, fmt.Errorf("error getting upload %v destinations: %v", key, err)
+	}
+	defer rows.Close()
+
+	var destinations map[string]database.UploadRecord
+	for rows.Next() {
+		var dest, recordJSON string
+		err = rows.Scan(&dest, &recordJSON)
+		if err != nil {
+			return nil, fmt.Errorf("error reading upload %v destination: %v", key, err)
+		}
+
+		r, err := unmarshalRecord(recordJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		if destinations == nil {
+			destinations = make(map[string]database.UploadRecord)
+		}
+		destinations[dest] = r
+	}
+
+	return destinations, rows.Err()
+}
+
+// marshalRecord returns the record's JSON without its destinations, which are stored in their own table.
+func marshalRecord(r database.UploadRecord) (string, error) {
+	r.Destinations = nil
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling upload %v: %v", r.Name, err)
+	}
+
+	return string(b), nil
+}
+
+func unmarshalRecord(recordJSON string) (database.UploadRecord, error) {
+	var r database.UploadRecord
+	err := json.Unmarshal([]byte(recordJSON), &r)
+	if err != nil {
+		return database.UploadRecord{}, fmt.Errorf("error unmarshaling upload: %v", err)
+	}
+
+	return r, nil
+}
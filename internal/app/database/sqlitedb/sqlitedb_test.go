@@ -0,0 +1,316 @@
+package sqlitedb_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/database/sqlitedb"
+)
+
+func newTestDB(t *testing.T, path string) sqlitedb.SQLiteDB {
+	t.Helper()
+
+	db, err := sqlitedb.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestSQLiteDB_GetPutEndToEnd(t *testing.T) {
+	db := newTestDB(t, filepath.Join(t.TempDir(), "uploads.db"))
+
+	got, err := db.GetUpload("doesnt_exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.IsEmpty() {
+		t.Fatalf("GetUpload() = %+v, want an empty record", got)
+	}
+
+	want := database.UploadRecord{
+		Name:     "a lecture",
+		VideoURI: "/videos/1",
+		Term:     "2023 Spring",
+		Status:   database.InProgress,
+		Versions: []database.VideoVersion{
+			{Filename: "a lecture v2.mp4", URI: "/videos/1/versions/2", Status: database.Complete, CreatedAt: time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		TextTracks: []database.TextTrack{{Filename: "a lecture.en.vtt", Language: "en", Kind: "captions"}},
+		Destinations: map[string]database.UploadRecord{
+			"vimeo": {Name: "a lecture", VideoURI: "/videos/1", Status: database.Complete},
+			"archive": {
+				Name: "a lecture", Status: database.Error, UploadID: "upload-1", Parts: []database.UploadPart{{Number: 1, ETag: `"abc"`, Size: 5}},
+				ErrorDetails: &database.ErrorDetails{Kind: database.ErrorKindTransfer, Message: "part 2 failed", HTTPStatus: 503, Offset: 5, OccurredAt: time.Date(2023, 2, 1, 9, 30, 0, 0, time.UTC)},
+			},
+		},
+	}
+
+	err = db.PutUpload(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = db.GetUpload("a lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetUpload() mismatch (-want +got):\n%s", diff)
+	}
+
+	// overwriting replaces the record and its destinations.
+	want.Status = database.Complete
+	want.Destinations = map[string]database.UploadRecord{
+		"vimeo": {Name: "a lecture", VideoURI: "/videos/1", Status: database.Complete},
+	}
+
+	err = db.PutUpload(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = db.GetUpload("a lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetUpload() after overwrite mismatch (-want +got):\n%s", diff)
+	}
+
+	err = db.PutUpload(database.UploadRecord{})
+	if err == nil {
+		t.Error("PutUpload() expected an error for a record without a name")
+	}
+}
+
+func TestSQLiteDB_ListUploads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uploads.db")
+	db := newTestDB(t, path)
+
+	want := []database.UploadRecord{
+		{Name: "a lecture", Term: "2023 Spring", Status: database.Complete},
+		{Name: "b lecture", Term: "2023 Summer", Status: database.InProgress, Destinations: map[string]database.UploadRecord{
+			"vimeo": {Name: "b lecture", Status: database.InProgress},
+		}},
+	}
+
+	// put out of order to check sorting.
+	for i := len(want) - 1; i >= 0; i-- {
+		err := db.PutUpload(want[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// reopening an up to date database doesn't re-run migrations or lose data.
+	db.Close()
+	db = newTestDB(t, path)
+
+	got, err := db.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListUploads() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCopy_fromFileDB(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []database.UploadRecord{
+		{Name: "a lecture", VideoURI: "/videos/1", Status: database.Complete},
+		{Name: "b lecture", TusURI: "https://files.tus.vimeo.com/2", Status: database.InProgress},
+		{ID: "100-abc", Name: "c lecture", VideoURI: "/videos/3", Status: database.Complete},
+	}
+	for _, r := range want {
+		err = fdb.PutUpload(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// history from before the record had an ID is saved under its name.
+	attempts := map[string][]database.Attempt{
+		"100-abc":   {{StartedAt: time.Date(2023, 2, 2, 9, 0, 0, 0, time.UTC), Status: database.Complete}},
+		"c lecture": {{StartedAt: time.Date(2023, 2, 1, 9, 0, 0, 0, time.UTC), Status: database.Error}},
+	}
+	for key, list := range attempts {
+		for _, a := range list {
+			err = fdb.AddAttempt(key, a)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	db := newTestDB(t, filepath.Join(dir, "uploads.db"))
+
+	// copying twice is safe, records are replaced.
+	for i := 0; i < 2; i++ {
+		n, err := database.Copy(fdb, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != len(want) {
+			t.Errorf("Copy() = %v, want %v", n, len(want))
+		}
+	}
+
+	got, err := db.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListUploads() after Copy() mismatch (-want +got):\n%s", diff)
+	}
+
+	for key, want := range attempts {
+		got, err := db.ListAttempts(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("ListAttempts(%v) after Copy() mismatch (-want +got):\n%s", key, diff)
+		}
+	}
+}
+
+func TestSQLiteDB_Attempts(t *testing.T) {
+	db := newTestDB(t, filepath.Join(t.TempDir(), "uploads.db"))
+
+	start := time.Date(2023, 2, 1, 9, 0, 0, 0, time.UTC)
+	var want []database.Attempt
+	for i := 0; i < 4; i++ {
+		a := database.Attempt{
+			StartedAt:   start.Add(time.Duration(i) * 24 * time.Hour),
+			EndedAt:     start.Add(time.Duration(i)*24*time.Hour + time.Minute),
+			Destination: "vimeo",
+			Status:      database.Error,
+			StartOffset: int64(i) * 100,
+			EndOffset:   int64(i+1) * 100,
+			BytesSent:   100,
+			Error:       "connection reset",
+			HTTPStatus:  500,
+			Host:        "lab-pc",
+		}
+		want = append(want, a)
+
+		// attempts are logged even if the upload has no record yet.
+		err := db.AddAttempt("a lecture", a)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := db.AddAttempt("another lecture", database.Attempt{StartedAt: start.Add(96 * time.Hour), Status: database.Complete})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.ListAttempts("a lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ListAttempts() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the first attempt is too old and only the newest two of the rest are kept.
+	n, err := db.PruneAttempts(start.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("PruneAttempts() = %v, want 2", n)
+	}
+
+	got, _ = db.ListAttempts("a lecture")
+	if diff := cmp.Diff(want[2:], got); diff != "" {
+		t.Errorf("ListAttempts() after pruning mismatch (-want +got):\n%s", diff)
+	}
+
+	got, _ = db.ListAttempts("another lecture")
+	if len(got) != 1 {
+		t.Errorf("PruneAttempts() removed another upload's attempt, got %+v", got)
+	}
+}
+
+func TestSQLiteDB_PutUploadWithID(t *testing.T) {
+	db := newTestDB(t, filepath.Join(t.TempDir(), "uploads.db"))
+
+	// saved before files had IDs.
+	legacy := database.UploadRecord{
+		Name:         "Tap Week 1",
+		Status:       database.Complete,
+		Destinations: map[string]database.UploadRecord{"vimeo": {Name: "Tap Week 1", Status: database.Complete}},
+	}
+	err := db.PutUpload(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy.ID = "100-abc"
+	err = db.PutUpload(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.GetUpload("100-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(legacy, got); diff != "" {
+		t.Errorf("GetUpload() mismatch (-want +got):\n%s", diff)
+	}
+
+	got, err = db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.IsEmpty() {
+		t.Errorf("GetUpload() by name = %+v, want the record saved without an ID to be replaced", got)
+	}
+
+	// a different file with the same name.
+	err = db.PutUpload(database.UploadRecord{ID: "200-def", Name: "Tap Week 1", Status: database.InProgress})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := db.FindUploads("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 2 || found[0].ID != "100-abc" || found[1].ID != "200-def" {
+		t.Errorf("FindUploads() = %+v, want both files named Tap Week 1", found)
+	}
+
+	_, err = database.FindUpload(db, "Tap Week 1")
+	if err == nil {
+		t.Error("FindUpload() expected an error for a name shared by several files")
+	}
+}
@@ -0,0 +1,189 @@
+package destination
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// Progress is how far an upload attempt got. Uploaders update it as they send data so a failed attempt still records
+// where it stopped. A nil Progress ignores updates.
+type Progress struct {
+	mu          sync.Mutex
+	started     bool
+	startOffset int64
+	offset      int64
+	// statuses provides the attempt's last HTTP status, if set.
+	statuses *StatusRecorder
+}
+
+// Start records the offset the upload resumes from. Only the first call has an effect.
+func (p *Progress) Start(offset int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started {
+		return
+	}
+
+	p.started = true
+	p.startOffset = offset
+	p.offset = offset
+}
+
+// Sent records the offset the destination has confirmed receiving.
+func (p *Progress) Sent(offset int64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.started {
+		p.started = true
+	}
+
+	if offset > p.offset {
+		p.offset = offset
+	}
+}
+
+// Offsets returns the offset the upload started from and the last offset it reached.
+func (p *Progress) Offsets() (start, end int64) {
+	if p == nil {
+		return 0, 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.startOffset, p.offset
+}
+
+// HTTPStatus returns the last HTTP status code the attempt received, or 0 if it isn't known.
+func (p *Progress) HTTPStatus() int {
+	if p == nil {
+		return 0
+	}
+
+	return p.statuses.Last()
+}
+
+// StatusRecorder is an http.RoundTripper that remembers the status code of the last response it saw, so attempts can
+// record it without each destination reporting it.
+type StatusRecorder struct {
+	Transport http.RoundTripper
+
+	mu   sync.Mutex
+	last int
+}
+
+// NewStatusRecorder wraps transport, or http.DefaultTransport if it's nil.
+func NewStatusRecorder(transport http.RoundTripper) *StatusRecorder {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	return &StatusRecorder{Transport: transport}
+}
+
+func (s *StatusRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := s.Transport.RoundTrip(req)
+	if err == nil {
+		s.mu.Lock()
+		s.last = resp.StatusCode
+		s.mu.Unlock()
+	}
+
+	return resp, err
+}
+
+// Reset forgets the last status code.
+func (s *StatusRecorder) Reset() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.last = 0
+	s.mu.Unlock()
+}
+
+// Last returns the last status code received since Reset, or 0 if there wasn't a response.
+func (s *StatusRecorder) Last() int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// AttemptRecorder is an Uploader that adds an entry to the attempt history every time it uploads a file.
+type AttemptRecorder struct {
+	uploader    Uploader
+	log         database.AttemptLog
+	destination string
+	statuses    *StatusRecorder
+	host        string
+	now         func() time.Time
+}
+
+// RecordAttempts wraps u so each upload is logged to log under the destination's name, which can be empty if files
+// only go to one destination. statuses is optional and provides the attempt's last HTTP status.
+func RecordAttempts(u Uploader, log database.AttemptLog, destination string, statuses *StatusRecorder) AttemptRecorder {
+	host, _ := os.Hostname()
+
+	return AttemptRecorder{
+		uploader:    u,
+		log:         log,
+		destination: destination,
+		statuses:    statuses,
+		host:        host,
+		now:         time.Now,
+	}
+}
+
+// Upload uploads the file and records the attempt. Failing to record it only produces a warning.
+func (a AttemptRecorder) Upload(data UploadData) error {
+	data.Progress = &Progress{statuses: a.statuses}
+	a.statuses.Reset()
+
+	started := a.now()
+	err := a.uploader.Upload(data)
+
+	attempt := database.Attempt{
+		StartedAt:   started,
+		EndedAt:     a.now(),
+		Destination: a.destination,
+		Status:      database.Complete,
+		HTTPStatus:  data.Progress.HTTPStatus(),
+		Host:        a.host,
+	}
+
+	attempt.StartOffset, attempt.EndOffset = data.Progress.Offsets()
+	attempt.BytesSent = attempt.EndOffset - attempt.StartOffset
+
+	if err != nil {
+		attempt.Status = database.Error
+		attempt.Error = err.Error()
+	}
+
+	logErr := a.log.AddAttempt(data.Key(), attempt)
+	if logErr != nil {
+		fmt.Printf("WARN: could not record upload attempt for %v: %v\n", data.Filename, logErr)
+	}
+
+	return err
+}
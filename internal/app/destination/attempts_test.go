@@ -0,0 +1,85 @@
+package destination_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// partialUploader sends half the file, then fails with the server's response.
+type partialUploader struct {
+	url string
+	cl  *http.Client
+}
+
+func (p partialUploader) Upload(data destination.UploadData) error {
+	data.Progress.Start(100)
+	data.Progress.Sent(data.FileSize / 2)
+
+	resp, err := p.cl.Get(p.url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return errors.New("upload interrupted")
+}
+
+func TestAttemptRecorder_Upload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	statuses := destination.NewStatusRecorder(nil)
+	cl := &http.Client{Transport: statuses}
+
+	db, err := filedb.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := destination.UploadData{
+		VideoName: "Tap Week 1",
+		Filename:  "Tap Week 1.mp4",
+		FileSize:  1000,
+	}
+
+	u := destination.RecordAttempts(partialUploader{url: server.URL, cl: cl}, db, "archive", statuses)
+	err = u.Upload(data)
+	if err == nil {
+		t.Fatal("Upload() expected the uploader's error")
+	}
+
+	u = destination.RecordAttempts(fakeUploader{db: db, uri: "/videos/1"}, db, "archive", statuses)
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts, err := db.ListAttempts("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("ListAttempts() returned %v attempts, want 2", len(attempts))
+	}
+
+	failed := attempts[0]
+	if failed.Status != database.Error || failed.Error != "upload interrupted" || failed.Destination != "archive" ||
+		failed.StartOffset != 100 || failed.EndOffset != 500 || failed.BytesSent != 400 ||
+		failed.HTTPStatus != http.StatusServiceUnavailable || failed.EndedAt.Before(failed.StartedAt) {
+		t.Errorf("failed attempt = %+v", failed)
+	}
+
+	// the status recorder was reset, so the second attempt doesn't report the first one's response.
+	if attempts[1].Status != database.Complete || attempts[1].Error != "" || attempts[1].HTTPStatus != 0 {
+		t.Errorf("successful attempt = %+v", attempts[1])
+	}
+}
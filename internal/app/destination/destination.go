@@ -0,0 +1,123 @@
+package destination
+
+import (
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/captions"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// Uploader sends a video to a destination such as Vimeo or YouTube, tracking its progress so an interrupted upload
+// can be resumed.
+type Uploader interface {
+	Upload(data UploadData) error
+}
+
+// UploadData holds everything needed for an upload.
+type UploadData struct {
+	VideoName        string // May be redundant if using the filename as video name
+	VideoTitle       string // Name shown on the destination, defaults to Filename if empty
+	VideoDescription string
+	// Details are the values destinations use to render their own name and description templates, falling back to
+	// VideoTitle and VideoDescription when they don't have one.
+	Details metadata.VideoDetails
+	// Class is the class the video belongs to, if known. Destinations read their per-class settings from it.
+	Class metadata.Class
+	Term  string
+	// ID identifies the file by its contents, see filesystem.FileID. If it's empty, the file's record is keyed by its
+	// name instead.
+	ID        string
+	Filename  string
+	FilePath  string
+	Password  string
+	FileSize  int64
+	ChunkSize int
+	// TextTracks are caption and subtitle files added to the video once the upload finishes.
+	TextTracks []captions.TextTrack
+	// ThumbnailPath is an image uploaded as the video's thumbnail. If empty and ThumbnailOffset is set, the
+	// thumbnail is generated from the frame at that offset instead.
+	ThumbnailPath   string
+	ThumbnailOffset time.Duration
+	// EmbedDomains are the domains allowed to embed the video if its embed privacy setting is whitelist.
+	EmbedDomains []string
+	// Progress is updated with how much of the file the destination has received. It may be nil.
+	Progress *Progress
+}
+
+// Title renders the name template for the upload, using VideoTitle or Filename if the template is empty.
+func (d UploadData) Title(tmpl string) (string, error) {
+	fallback := d.VideoTitle
+	if fallback == "" {
+		fallback = d.Filename
+	}
+
+	return metadata.ApplyTemplate(tmpl, fallback, d.Details)
+}
+
+// Description renders the description template for the upload, using VideoDescription if the template is empty.
+func (d UploadData) Description(tmpl string) (string, error) {
+	return metadata.ApplyTemplate(tmpl, d.VideoDescription, d.Details)
+}
+
+// Name returns the name of the file's record, its filename without the extension.
+func (d UploadData) Name() string {
+	return database.NameFromFilename(d.Filename)
+}
+
+// Key returns the key the file's record is saved under.
+func (d UploadData) Key() string {
+	if d.ID != "" {
+		return d.ID
+	}
+
+	return d.Name()
+}
+
+// FindRecord returns the file's record, or an empty record with the file's ID if it doesn't have one yet. A record
+// saved under the file's name before files had IDs is returned with the ID added, so saving it re-keys it; .mov
+// records that were saved with their extension are re-keyed right away. The record is given the file's current name
+// in case it was renamed.
+func FindRecord(db database.UploadDatastore, data UploadData) (database.UploadRecord, error) {
+	r, err := db.GetUpload(data.Key())
+	if err != nil {
+		return database.UploadRecord{ID: data.ID}, err
+	}
+
+	if r.IsEmpty() && data.ID != "" {
+		// .mov records used to keep their extension.
+		for _, name := range []string{data.Name(), data.Filename} {
+			legacy, err := db.GetUpload(name)
+			if err != nil {
+				return database.UploadRecord{ID: data.ID}, err
+			}
+
+			if legacy.IsEmpty() || legacy.ID != "" {
+				continue
+			}
+
+			// the datastore replaces the record saved under the name being saved, so re-key it before renaming it.
+			if legacy.Name != data.Name() {
+				legacy.ID = data.ID
+				err = db.PutUpload(legacy)
+				if err != nil {
+					return database.UploadRecord{ID: data.ID}, err
+				}
+			}
+
+			r = legacy
+			break
+		}
+	}
+
+	if r.IsEmpty() {
+		return database.UploadRecord{ID: data.ID}, nil
+	}
+
+	if data.ID != "" {
+		r.ID = data.ID
+		r.Name = data.Name()
+	}
+
+	return r, nil
+}
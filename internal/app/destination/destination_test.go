@@ -0,0 +1,87 @@
+package destination_test
+
+import (
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+func TestFindRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		saved    database.UploadRecord
+		data     destination.UploadData
+		wantName string
+		wantURI  string
+	}{
+		{
+			name:     "record saved under its name before files had IDs",
+			saved:    database.UploadRecord{Name: "Tap Week 1", VideoURI: "/videos/1", Status: database.Complete},
+			data:     destination.UploadData{ID: "100-abc", Filename: "Tap Week 1.mp4"},
+			wantName: "Tap Week 1",
+			wantURI:  "/videos/1",
+		},
+		{
+			name:     ".mov record saved with its extension",
+			saved:    database.UploadRecord{Name: "Tap Week 1.mov", VideoURI: "/videos/1", Status: database.InProgress},
+			data:     destination.UploadData{ID: "100-abc", Filename: "Tap Week 1.mov"},
+			wantName: "Tap Week 1",
+			wantURI:  "/videos/1",
+		},
+		{
+			name:     "renamed file",
+			saved:    database.UploadRecord{ID: "100-abc", Name: "Tap Week 1", VideoURI: "/videos/1", Status: database.Complete},
+			data:     destination.UploadData{ID: "100-abc", Filename: "Tap Week 1 (final).mp4"},
+			wantName: "Tap Week 1 (final)",
+			wantURI:  "/videos/1",
+		},
+		{
+			name:  "different file with a name that already has an ID",
+			saved: database.UploadRecord{ID: "200-def", Name: "Tap Week 1", VideoURI: "/videos/2", Status: database.Complete},
+			data:  destination.UploadData{ID: "100-abc", Filename: "Tap Week 1.mp4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := filedb.New(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = db.PutUpload(tt.saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := destination.FindRecord(db, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.ID != tt.data.ID || r.Name != tt.wantName || r.VideoURI != tt.wantURI {
+				t.Fatalf("FindRecord() = %+v, want ID %v, name %q, and URI %q", r, tt.data.ID, tt.wantName, tt.wantURI)
+			}
+
+			if r.IsEmpty() {
+				return
+			}
+
+			// saving the record keys it by ID and replaces the record saved under the name.
+			err = db.PutUpload(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records, err := db.ListUploads()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(records) != 1 || records[0].Key() != tt.data.ID {
+				t.Errorf("records after saving = %+v, want one keyed by %v", records, tt.data.ID)
+			}
+		})
+	}
+}
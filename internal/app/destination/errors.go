@@ -0,0 +1,46 @@
+package destination
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// ErrorDetails describes err as a failure of the given kind, using the upload's Progress for the offset it reached and
+// the last HTTP status it received.
+func ErrorDetails(data UploadData, kind database.ErrorKind, err error) *database.ErrorDetails {
+	_, offset := data.Progress.Offsets()
+
+	return &database.ErrorDetails{
+		Kind:       kind,
+		Message:    err.Error(),
+		HTTPStatus: data.Progress.HTTPStatus(),
+		Offset:     offset,
+		OccurredAt: time.Now(),
+	}
+}
+
+// SaveError records err on the upload's record and returns it, so failure paths can end with
+// return destination.SaveError(...). The status is set to Error unless the failure is ErrorKindFinish, since the video
+// already exists then. A record that hasn't been saved yet is created so the failure isn't lost.
+func SaveError(db database.UploadDatastore, r database.UploadRecord, data UploadData, kind database.ErrorKind, err error) error {
+	if r.IsEmpty() {
+		r.ID = data.ID
+		r.Name = data.Name()
+		r.CalculatedName = data.VideoName
+		r.Term = data.Term
+	}
+
+	if kind != database.ErrorKindFinish {
+		r.Status = database.Error
+	}
+	r.ErrorDetails = ErrorDetails(data, kind, err)
+
+	pErr := db.PutUpload(r)
+	if pErr != nil {
+		fmt.Printf("WARN: could not save error details for %v: %v\n", data.Filename, pErr)
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package destination
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// Target is one of the destinations a FanOut sends files to.
+type Target struct {
+	Name     string
+	Uploader Uploader
+	// Optional targets only produce a warning when they fail, so the file still counts as uploaded.
+	Optional bool
+}
+
+// FanOut uploads each file to several destinations. Each destination's uploader should save its state with
+// database.Scoped so it ends up in the file's record under the destination's name.
+type FanOut struct {
+	targets  []Target
+	uploadDB database.UploadDatastore
+}
+
+// NewFanOut creates a FanOut that sends files to targets in order and summarizes their status in db.
+func NewFanOut(db database.UploadDatastore, targets []Target) FanOut {
+	return FanOut{
+		targets:  targets,
+		uploadDB: db,
+	}
+}
+
+// Upload sends the file to every target. It returns an error if any required target fails, leaving the file to be
+// retried; targets that already finished skip the file on the next run.
+func (f FanOut) Upload(data UploadData) error {
+	var failed []string
+	for _, t := range f.targets {
+		err := t.Uploader.Upload(data)
+		if err == nil {
+			continue
+		}
+
+		if t.Optional {
+			fmt.Printf("WARN: optional destination %v failed for %v: %v\n", t.Name, data.Filename, err)
+			continue
+		}
+
+		fmt.Printf("destination %v failed for %v: %v\n", t.Name, data.Filename, err)
+		failed = append(failed, t.Name)
+	}
+
+	sErr := f.updateStatus(data.Key())
+	if sErr != nil {
+		fmt.Printf("WARN: could not update overall status of %v: %v\n", data.Filename, sErr)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("required destinations failed: %v", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// updateStatus sets the record's overall status, video URI, and password from its destinations. The file is complete
+// once every required destination is, the video URI is the first destination's, and the password is the first one a
+// destination set. If a required destination failed, the file's status is Error with that destination's error
+// details.
+func (f FanOut) updateStatus(key string) error {
+	r, err := f.uploadDB.GetUpload(key)
+	if err != nil {
+		return err
+	}
+
+	if r.IsEmpty() {
+		return nil
+	}
+
+	status := database.Complete
+	r.ErrorDetails = nil
+	r.Password = ""
+	for i, t := range f.targets {
+		d := r.Destinations[t.Name]
+		if i == 0 {
+			r.VideoURI = d.VideoURI
+		}
+
+		if r.Password == "" {
+			r.Password = d.Password
+		}
+
+		if t.Optional {
+			continue
+		}
+
+		if d.Status == database.Error && r.ErrorDetails == nil {
+			status = database.Error
+			r.ErrorDetails = d.ErrorDetails
+		} else if d.Status != database.Complete && status == database.Complete {
+			status = database.InProgress
+		}
+	}
+
+	r.Status = status
+	return f.uploadDB.PutUpload(r)
+}
@@ -0,0 +1,172 @@
+package destination_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// fakeUploader records an upload in its datastore the way the real uploaders do.
+type fakeUploader struct {
+	db  database.UploadDatastore
+	uri string
+	// password is saved when the video is created, like destinations with password privacy do.
+	password string
+	err      error
+}
+
+func (f fakeUploader) Upload(data destination.UploadData) error {
+	r, err := destination.FindRecord(f.db, data)
+	if err != nil {
+		return err
+	}
+
+	if r.Status == database.Complete {
+		return nil
+	}
+
+	r.Name = data.Name()
+	r.Password = f.password
+	r.Status = database.InProgress
+	if f.err == nil {
+		r.Status = database.Complete
+		r.VideoURI = f.uri
+	}
+
+	pErr := f.db.PutUpload(r)
+	if pErr != nil {
+		return pErr
+	}
+
+	if f.err != nil {
+		return destination.SaveError(f.db, r, data, database.ErrorKindTransfer, f.err)
+	}
+
+	return nil
+}
+
+func TestFanOut_Upload(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		optional   bool
+		wantErr    bool
+		wantStatus database.UploadStatus
+	}{
+		{
+			name:       "complete when every destination succeeds",
+			wantStatus: database.Complete,
+		},
+		{
+			name:       "complete when an optional destination fails",
+			err:        errors.New("unavailable"),
+			optional:   true,
+			wantStatus: database.Complete,
+		},
+		{
+			name:       "error when a required destination fails",
+			err:        errors.New("unavailable"),
+			wantErr:    true,
+			wantStatus: database.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := filedb.New(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := destination.NewFanOut(db, []destination.Target{
+				{
+					Name:     "vimeo",
+					Uploader: fakeUploader{db: database.Scoped(db, "vimeo", "vimeo"), uri: "/videos/1"},
+				},
+				{
+					Name:     "archive",
+					Uploader: fakeUploader{db: database.Scoped(db, "archive", "vimeo"), uri: "s3://bucket/a.mp4", password: "apple_banana", err: tt.err},
+					Optional: tt.optional,
+				},
+			})
+
+			err = f.Upload(destination.UploadData{VideoName: "a", Filename: "a.mp4"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FanOut.Upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			r, err := db.GetUpload("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Status != tt.wantStatus {
+				t.Errorf("status = %v, want %v", r.Status, tt.wantStatus)
+			}
+
+			// the failed destination's error is copied to the file's record.
+			if tt.wantStatus == database.Error && (r.ErrorDetails == nil || r.ErrorDetails.Message != "unavailable") {
+				t.Errorf("error details = %+v, want the archive destination's", r.ErrorDetails)
+			}
+
+			if r.VideoURI != "/videos/1" {
+				t.Errorf("video URI = %v, want the first destination's", r.VideoURI)
+			}
+
+			if r.Password != "apple_banana" {
+				t.Errorf("password = %v, want the archive destination's", r.Password)
+			}
+
+			if r.Destinations["vimeo"].Status != database.Complete {
+				t.Errorf("vimeo status = %v, want %v", r.Destinations["vimeo"].Status, database.Complete)
+			}
+		})
+	}
+}
+
+func TestFanOut_UploadLegacyRecord(t *testing.T) {
+	db, err := filedb.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a record saved before there were several destinations.
+	err = db.PutUpload(database.UploadRecord{Name: "a", Status: database.Complete, VideoURI: "/videos/1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := destination.NewFanOut(db, []destination.Target{
+		{Name: "vimeo", Uploader: fakeUploader{db: database.Scoped(db, "vimeo", "vimeo"), uri: "/videos/2"}},
+		{Name: "archive", Uploader: fakeUploader{db: database.Scoped(db, "archive", "vimeo"), uri: "s3://bucket/a.mp4"}},
+	})
+
+	// the file's ID is new, the record is found by name and re-keyed.
+	err = f.Upload(destination.UploadData{ID: "100-abc", VideoName: "a", Filename: "a.mp4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.GetUpload("100-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if legacy, _ := db.GetUpload("a"); !legacy.IsEmpty() {
+		t.Errorf("record saved under the name = %+v, want it re-keyed", legacy)
+	}
+
+	if got := r.Destinations["vimeo"].VideoURI; got != "/videos/1" {
+		t.Errorf("legacy video URI = %v, want /videos/1", got)
+	}
+
+	if got := r.Destinations["archive"].VideoURI; got != "s3://bucket/a.mp4" {
+		t.Errorf("archive video URI = %v, want s3://bucket/a.mp4", got)
+	}
+
+	if r.Status != database.Complete {
+		t.Errorf("status = %v, want %v", r.Status, database.Complete)
+	}
+}
@@ -0,0 +1,80 @@
+package destination
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// Complete marks the record as uploaded to videoURI and saves it. Failing to save it only produces a warning since the
+// upload itself succeeded.
+func Complete(db database.UploadDatastore, r *database.UploadRecord, data UploadData, videoURI string) {
+	r.Status = database.Complete
+	r.VideoURI = videoURI
+	r.ErrorDetails = nil
+
+	pErr := db.PutUpload(*r)
+	if pErr != nil {
+		fmt.Printf("error updating file %v status locally but the upload succeeded: %v\n", data.Filename, pErr)
+	}
+
+	fmt.Println("------------------------------")
+	fmt.Printf("finished uploading file: \n%v\nvideo link: %v\n", data.Filename, r.VideoURI)
+	fmt.Println("------------------------------")
+}
+
+// Finish runs the steps that happen after a video's file is fully uploaded, ex. adding it to a playlist. Their
+// failures are recorded on the record as ErrorKindFinish, or an earlier error is cleared once they all succeed. Each
+// step should skip work that's already recorded as done, so it's safe to finish videos again on later runs.
+func Finish(db database.UploadDatastore, r database.UploadRecord, data UploadData, steps ...func(*database.UploadRecord, UploadData) error) error {
+	var errs []string
+	for _, step := range steps {
+		err := step(&r, data)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return SaveError(db, r, data, database.ErrorKindFinish, errors.New(strings.Join(errs, "; ")))
+	}
+
+	if r.ErrorDetails != nil {
+		r.ErrorDetails = nil
+		pErr := db.PutUpload(r)
+		if pErr != nil {
+			fmt.Printf("WARN: could not clear the earlier error of %v: %v\n", data.Filename, pErr)
+		}
+	}
+
+	return nil
+}
+
+// AddToPlaylist adds the record's video to playlistID with add and saves that it was added. Nothing is done if there's
+// no playlist or the record shows the video is in it already.
+func AddToPlaylist(db database.UploadDatastore, r *database.UploadRecord, data UploadData, playlistID string, add func() error) error {
+	if playlistID == "" || r.VideoURI == "" {
+		return nil
+	}
+
+	for _, p := range r.Playlists {
+		if p == playlistID {
+			return nil
+		}
+	}
+
+	err := add()
+	if err != nil {
+		return fmt.Errorf("could not add %v to playlist %v: %v", data.Filename, playlistID, err)
+	}
+
+	r.Playlists = append(r.Playlists, playlistID)
+	pErr := db.PutUpload(*r)
+	if pErr != nil {
+		fmt.Printf("error saving %v playlist locally but it was added to the playlist: %v\n", data.Filename, pErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package destination
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// statusResumeIncomplete is returned for every chunk of a resumable upload except the last.
+const statusResumeIncomplete = 308
+
+// HTTPCaller sends HTTP requests, ex. an *http.Client.
+type HTTPCaller interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// ResumableSession is an upload session of the resumable upload protocol YouTube and PeerTube use. The file is PUT in
+// chunks with a Content-Range header, and every response except the last is a 308 with a Range header saying how much
+// of the file has been received.
+type ResumableSession struct {
+	URI string
+	// Client is used to check the session's status and UploadClient to send chunks, so it has a long timeout.
+	Client       HTTPCaller
+	UploadClient HTTPCaller
+	// Prepare adds headers such as authorization to each request. It may be nil.
+	Prepare     func(req *http.Request) error
+	ContentType string
+	ChunkSize   int64
+	// Destination names the destination in errors, ex. YouTube.
+	Destination string
+	// VideoID reads the finished video's ID from the body of the session's last response, returning "" if it's not
+	// there.
+	VideoID func(body []byte) string
+}
+
+// Offset asks the session how many bytes it has received. If the upload already finished, the video ID is returned
+// instead.
+func (s ResumableSession) Offset(fileSize int64) (int64, string, error) {
+	resp, err := s.put(s.Client, nil, fmt.Sprintf("bytes */%v", fileSize))
+	if err != nil {
+		return -1, "", fmt.Errorf("error checking upload status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return s.result(resp)
+}
+
+// Upload uploads the rest of the file in chunks, starting at offset, and returns the video ID.
+func (s ResumableSession) Upload(offset int64, data UploadData) (string, error) {
+	f, err := os.Open(data.FilePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file to upload: %v", err)
+	}
+	defer f.Close()
+
+	fmt.Printf("Uploading %v....\n", f.Name())
+	data.Progress.Start(offset)
+	for offset < data.FileSize {
+		payloadSize := s.ChunkSize
+		if data.FileSize-offset < payloadSize {
+			payloadSize = data.FileSize - offset
+		}
+
+		fileBytes := make([]byte, payloadSize)
+		_, err = f.ReadAt(fileBytes, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("error reading file %v bytes at offset %v: %v", data.FilePath, offset, err)
+		}
+
+		resp, err := s.put(s.UploadClient, fileBytes, fmt.Sprintf("bytes %v-%v/%v", offset, offset+payloadSize-1, data.FileSize))
+		if err != nil {
+			return "", fmt.Errorf("error uploading chunk at offset %v: %v", offset, err)
+		}
+
+		newOffset, videoID, err := s.result(resp)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		if videoID != "" {
+			data.Progress.Sent(data.FileSize)
+			fmt.Println()
+			return videoID, nil
+		}
+
+		if newOffset <= offset {
+			return "", fmt.Errorf("upload did not progress past offset %v, please retry or troubleshoot", offset)
+		}
+
+		offset = newOffset
+		data.Progress.Sent(offset)
+		fmt.Printf("%v%% uploaded...", math.Floor(float64(offset)/float64(data.FileSize)*100))
+	}
+
+	// every byte was sent but the session never returned the video, ask for the final status.
+	_, videoID, err := s.Offset(data.FileSize)
+	if err != nil {
+		return "", err
+	}
+
+	if videoID == "" {
+		return "", fmt.Errorf("upload finished but %v did not return a video ID", s.Destination)
+	}
+
+	return videoID, nil
+}
+
+// put sends a chunk, or an empty body to check the upload's status, to the session.
+func (s ResumableSession) put(c HTTPCaller, body []byte, contentRange string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPut, s.URI, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	if s.Prepare != nil {
+		err = s.Prepare(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req.Header.Add("Content-Type", s.ContentType)
+	req.Header.Add("Content-Range", contentRange)
+
+	return c.Do(req)
+}
+
+// result reads a session response. A 308 returns the number of bytes received, a 200 or 201 returns the finished
+// video's ID.
+func (s ResumableSession) result(resp *http.Response) (int64, string, error) {
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, "", fmt.Errorf("could not read upload response bytes: %v", err)
+	}
+
+	switch resp.StatusCode {
+	case statusResumeIncomplete:
+		// ex. Range: bytes=0-999999, missing if nothing has been received yet.
+		rng := resp.Header.Get("Range")
+		if rng == "" {
+			return 0, "", nil
+		}
+
+		last, err := strconv.ParseInt(rng[strings.LastIndex(rng, "-")+1:], 10, 64)
+		if err != nil {
+			return -1, "", fmt.Errorf("could not convert range %v to a valid byte offset: %v", rng, err)
+		}
+
+		return last + 1, "", nil
+	case http.StatusOK, http.StatusCreated:
+		videoID := s.VideoID(respBytes)
+		if videoID == "" {
+			return -1, "", fmt.Errorf("could not read video ID from upload response: %v", string(respBytes))
+		}
+
+		return -1, videoID, nil
+	default:
+		return -1, "", fmt.Errorf("received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+	}
+}
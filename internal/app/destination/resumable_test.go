@@ -0,0 +1,197 @@
+package destination_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// fakeSession is a resumable upload session that finishes with a video ID once it has received size bytes.
+type fakeSession struct {
+	size int64
+	// stall keeps the session from accepting chunks, replying as if nothing more was received.
+	stall bool
+
+	mu       sync.Mutex
+	received []byte
+	ranges   []string
+}
+
+func (f *fakeSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer tok" || r.Header.Get("Content-Type") != "video/mp4" {
+		http.Error(w, "bad headers", http.StatusBadRequest)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	rng := r.Header.Get("Content-Range")
+	f.ranges = append(f.ranges, rng)
+
+	if !strings.HasPrefix(rng, "bytes */") && !f.stall {
+		f.received = append(f.received, body...)
+	}
+
+	if int64(len(f.received)) == f.size {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"abc"}`))
+		return
+	}
+
+	if len(f.received) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%v", len(f.received)-1))
+	}
+	w.WriteHeader(308)
+}
+
+func TestResumableSession(t *testing.T) {
+	video := []byte("0123456789")
+	videoPath := filepath.Join(t.TempDir(), "Tap Week 1.mp4")
+	err := os.WriteFile(videoPath, video, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := destination.UploadData{Filename: "Tap Week 1.mp4", FilePath: videoPath, FileSize: int64(len(video))}
+
+	tests := []struct {
+		name       string
+		received   []byte
+		stall      bool
+		wantOffset int64
+		wantRanges []string
+		wantErr    bool
+	}{
+		{
+			name:       "new upload",
+			wantRanges: []string{"bytes */10", "bytes 0-3/10", "bytes 4-7/10", "bytes 8-9/10"},
+		},
+		{
+			name:       "resumed upload",
+			received:   video[:6],
+			wantOffset: 6,
+			wantRanges: []string{"bytes */10", "bytes 6-9/10"},
+		},
+		{
+			name:       "finished upload",
+			received:   video,
+			wantRanges: []string{"bytes */10"},
+		},
+		{
+			name:       "upload that doesn't progress",
+			received:   video[:4],
+			stall:      true,
+			wantOffset: 4,
+			wantRanges: []string{"bytes */10", "bytes 4-7/10"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSession{size: data.FileSize, received: append([]byte{}, tt.received...), stall: tt.stall}
+			srv := httptest.NewServer(fake)
+			defer srv.Close()
+
+			s := destination.ResumableSession{
+				URI:          srv.URL + "/upload?id=1",
+				Client:       srv.Client(),
+				UploadClient: srv.Client(),
+				Prepare: func(req *http.Request) error {
+					req.Header.Add("Authorization", "Bearer tok")
+					return nil
+				},
+				ContentType: "video/mp4",
+				ChunkSize:   4,
+				Destination: "Test",
+				VideoID: func(body []byte) string {
+					return strings.TrimSuffix(strings.TrimPrefix(string(body), `{"id":"`), `"}`)
+				},
+			}
+
+			offset, videoID, err := s.Offset(data.FileSize)
+			if err != nil {
+				t.Fatalf("Offset() error = %v", err)
+			}
+
+			if videoID == "" {
+				if offset != tt.wantOffset {
+					t.Errorf("Offset() = %v, want %v", offset, tt.wantOffset)
+				}
+
+				videoID, err = s.Upload(offset, data)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Upload() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+
+			if diff := cmp.Diff(tt.wantRanges, fake.ranges); diff != "" {
+				t.Errorf("session received ranges mismatch (-want +got):\n%s", diff)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if videoID != "abc" || !bytes.Equal(fake.received, video) {
+				t.Errorf("session returned video %q after receiving %q", videoID, fake.received)
+			}
+		})
+	}
+}
+
+func TestResumableSession_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "backend error", http.StatusServiceUnavailable)
+			},
+		},
+		{
+			name: "invalid range",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Range", "bytes=0-x")
+				w.WriteHeader(308)
+			},
+		},
+		{
+			name: "finished without a video ID",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{}`))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			s := destination.ResumableSession{
+				URI:     srv.URL,
+				Client:  srv.Client(),
+				VideoID: func(body []byte) string { return "" },
+			}
+
+			_, _, err := s.Offset(10)
+			if err == nil {
+				t.Error("Offset() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package duplicates recognizes files that are copies of recordings that were already uploaded, ex. the same lecture
+// saved twice under different names or copied from an SD card again.
+package duplicates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+)
+
+// Finder looks up files in the datastore to see whether they were already uploaded.
+type Finder struct {
+	uploadDB database.UploadDatastore
+	// uploadedFolder is where uploaded files are moved, used to find the checksums of files uploaded before
+	// checksums were saved.
+	uploadedFolder string
+}
+
+// NewFinder creates a Finder for the uploads in db, whose files are moved to uploadedFolder once they're uploaded.
+func NewFinder(db database.UploadDatastore, uploadedFolder string) Finder {
+	return Finder{
+		uploadDB:       db,
+		uploadedFolder: uploadedFolder,
+	}
+}
+
+// Find returns the finished upload the file at path is a copy of, or an empty record if it isn't one. Files with the
+// same ID, their size and a sampled hash, are compared by their full checksum. If the IDs match but the contents
+// don't, the file is identified by its full checksum instead and the ID to upload it under is returned. A file that
+// is the upload itself, left in the upload folder because moving it failed, isn't a copy so it can be finished.
+func (f Finder) Find(id, path string) (database.UploadRecord, string, error) {
+	r, err := f.uploadDB.GetUpload(id)
+	if err != nil || !Finished(r) {
+		return database.UploadRecord{}, id, err
+	}
+
+	want, err := f.checksum(r)
+	if err != nil || want == "" {
+		// without the original's checksum the copy can't be confirmed, the uploaders skip it as already uploaded.
+		return database.UploadRecord{}, id, err
+	}
+
+	sum, err := filesystem.Checksum(filesystem.Local{}, path)
+	if err != nil {
+		return database.UploadRecord{}, id, err
+	}
+
+	if sum == want {
+		if f.isOriginal(r, path) {
+			return database.UploadRecord{}, id, nil
+		}
+		return r, id, nil
+	}
+
+	i, err := os.Stat(path)
+	if err != nil {
+		return database.UploadRecord{}, id, err
+	}
+
+	id = filesystem.ChecksumID(i.Size(), sum)
+	fmt.Printf("WARN: %v has the same ID as %v but different contents, tracking it as %v\n", filepath.Base(path), r.Name, id)
+
+	// copies of this file have the same checksum, so a finished record under the checksum ID is the original.
+	r, err = f.uploadDB.GetUpload(id)
+	if err != nil || !Finished(r) || f.isOriginal(r, path) {
+		return database.UploadRecord{}, id, err
+	}
+
+	return r, id, nil
+}
+
+// isOriginal returns whether the file at path is the one uploaded for the record rather than a copy of it: it has the
+// record's name and no file with that name was moved to the uploaded folder.
+func (f Finder) isOriginal(r database.UploadRecord, path string) bool {
+	if database.NameFromFilename(filepath.Base(path)) != r.Name {
+		return false
+	}
+
+	for _, ext := range []string{".mp4", ".mov"} {
+		if _, err := os.Stat(filepath.Join(f.uploadedFolder, r.Name+ext)); err == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SaveChecksum saves the checksum of an uploaded file on its record so copies of it can be recognized later.
+func (f Finder) SaveChecksum(id, path string) error {
+	r, err := f.uploadDB.GetUpload(id)
+	if err != nil || r.IsEmpty() || r.ContentHash != "" {
+		return err
+	}
+
+	r.ContentHash, err = filesystem.Checksum(filesystem.Local{}, path)
+	if err != nil {
+		return err
+	}
+
+	return f.uploadDB.PutUpload(r)
+}
+
+// Finished returns whether the record's upload completed without errors. A complete upload whose later steps, such
+// as adding captions, failed at any destination isn't finished so the uploaders can retry them.
+func Finished(r database.UploadRecord) bool {
+	if r.IsEmpty() || r.Status != database.Complete || r.ErrorDetails != nil {
+		return false
+	}
+
+	for _, d := range r.Destinations {
+		if d.ErrorDetails != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checksum returns the checksum of the record's file. Records from before checksums were saved use the checksum
+// their destination verified or, if the file is still in the uploaded folder, its checksum, which is saved for next
+// time. It returns an empty string if the checksum isn't known.
+func (f Finder) checksum(r database.UploadRecord) (string, error) {
+	if r.ContentHash != "" {
+		return r.ContentHash, nil
+	}
+
+	if r.Checksum != "" {
+		return r.Checksum, nil
+	}
+
+	for _, ext := range []string{".mp4", ".mov"} {
+		original := filepath.Join(f.uploadedFolder, r.Name+ext)
+		if _, err := os.Stat(original); err != nil {
+			continue
+		}
+
+		sum, err := filesystem.Checksum(filesystem.Local{}, original)
+		if err != nil {
+			return "", err
+		}
+
+		r.ContentHash = sum
+		pErr := f.uploadDB.PutUpload(r)
+		if pErr != nil {
+			fmt.Printf("WARN: could not save the checksum of %v: %v\n", r.Name, pErr)
+		}
+
+		return sum, nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,243 @@
+package duplicates_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/duplicates"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+)
+
+func sum(contents string) string {
+	h := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(h[:])
+}
+
+func TestFinder_Find(t *testing.T) {
+	const id = "5-abc"
+	otherID := filesystem.ChecksumID(5, sum("other"))
+
+	tests := []struct {
+		name string
+		// records are saved before the file is checked.
+		records []database.UploadRecord
+		// uploaded is a file in the uploaded folder, keyed by name.
+		uploaded     map[string]string
+		contents     string
+		wantOriginal string
+		wantID       string
+		// wantSaved is the checksum that should be saved on the original's record.
+		wantSaved string
+	}{
+		{
+			name:     "new file isn't a duplicate",
+			contents: "video",
+			wantID:   id,
+		},
+		{
+			name: "copy of a finished upload is a duplicate",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete, ContentHash: sum("video")},
+			},
+			contents:     "video",
+			wantOriginal: "lecture",
+			wantID:       id,
+			wantSaved:    sum("video"),
+		},
+		{
+			name: "copy of an unfinished upload is uploaded",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.InProgress, ContentHash: sum("video")},
+			},
+			contents:  "video",
+			wantID:    id,
+			wantSaved: sum("video"),
+		},
+		{
+			name: "copy of an upload whose finish steps failed is uploaded",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete, ContentHash: sum("video"),
+					ErrorDetails: &database.ErrorDetails{Kind: database.ErrorKindFinish}},
+			},
+			contents:  "video",
+			wantID:    id,
+			wantSaved: sum("video"),
+		},
+		{
+			name: "original left in the upload folder after a failed move isn't a copy of itself",
+			records: []database.UploadRecord{
+				{ID: id, Name: "copy", Status: database.Complete, ContentHash: sum("video")},
+			},
+			contents:  "video",
+			wantID:    id,
+			wantSaved: sum("video"),
+		},
+		{
+			name: "file with the original's name is a copy once the original was moved",
+			records: []database.UploadRecord{
+				{ID: id, Name: "copy", Status: database.Complete, ContentHash: sum("video")},
+			},
+			uploaded:     map[string]string{"copy.mp4": "video"},
+			contents:     "video",
+			wantOriginal: "copy",
+			wantID:       id,
+			wantSaved:    sum("video"),
+		},
+		{
+			name: "destination checksum is used for older records",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete, Checksum: sum("video")},
+			},
+			contents:     "video",
+			wantOriginal: "lecture",
+			wantID:       id,
+		},
+		{
+			name: "uploaded file is hashed for older records and its checksum saved",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete},
+			},
+			uploaded:     map[string]string{"lecture.mp4": "video"},
+			contents:     "video",
+			wantOriginal: "lecture",
+			wantID:       id,
+			wantSaved:    sum("video"),
+		},
+		{
+			name: "unknown checksum isn't a duplicate",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete},
+			},
+			contents: "video",
+			wantID:   id,
+		},
+		{
+			name: "same ID with different contents is tracked by checksum",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete, ContentHash: sum("video")},
+			},
+			contents:  "other",
+			wantID:    otherID,
+			wantSaved: sum("video"),
+		},
+		{
+			name: "copy of a file tracked by checksum is a duplicate",
+			records: []database.UploadRecord{
+				{ID: id, Name: "lecture", Status: database.Complete, ContentHash: sum("video")},
+				{ID: otherID, Name: "seminar", Status: database.Complete, ContentHash: sum("other")},
+			},
+			contents:     "other",
+			wantOriginal: "seminar",
+			wantID:       otherID,
+			wantSaved:    sum("video"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, r := range tt.records {
+				err = db.PutUpload(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			uploadedFolder := filepath.Join(dir, "uploaded")
+			err = os.Mkdir(uploadedFolder, 0750)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, contents := range tt.uploaded {
+				err = os.WriteFile(filepath.Join(uploadedFolder, name), []byte(contents), 0640)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			path := filepath.Join(dir, "copy.mp4")
+			err = os.WriteFile(path, []byte(tt.contents), 0640)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			original, gotID, err := duplicates.NewFinder(db, uploadedFolder).Find(id, path)
+			if err != nil {
+				t.Fatalf("Finder.Find() error = %v", err)
+			}
+
+			if original.Name != tt.wantOriginal {
+				t.Errorf("Finder.Find() original = %q, want %q", original.Name, tt.wantOriginal)
+			}
+
+			if gotID != tt.wantID {
+				t.Errorf("Finder.Find() id = %v, want %v", gotID, tt.wantID)
+			}
+
+			r, err := db.GetUpload(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.ContentHash != tt.wantSaved {
+				t.Errorf("saved checksum = %v, want %v", r.ContentHash, tt.wantSaved)
+			}
+		})
+	}
+}
+
+func TestFinder_SaveChecksum(t *testing.T) {
+	dir := t.TempDir()
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "lecture.mp4")
+	err = os.WriteFile(path, []byte("video"), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := duplicates.NewFinder(db, dir)
+
+	// files without a record, ex. ones that failed to upload, are ignored.
+	err = f.SaveChecksum("5-abc", path)
+	if err != nil {
+		t.Fatalf("Finder.SaveChecksum() error = %v", err)
+	}
+
+	r, _ := db.GetUpload("5-abc")
+	if !r.IsEmpty() {
+		t.Errorf("Finder.SaveChecksum() created record %+v", r)
+	}
+
+	err = db.PutUpload(database.UploadRecord{ID: "5-abc", Name: "lecture", Status: database.Complete})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.SaveChecksum("5-abc", path)
+	if err != nil {
+		t.Fatalf("Finder.SaveChecksum() error = %v", err)
+	}
+
+	r, err = db.GetUpload("5-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.ContentHash != sum("video") {
+		t.Errorf("Finder.SaveChecksum() saved %v, want %v", r.ContentHash, sum("video"))
+	}
+}
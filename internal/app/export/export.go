@@ -0,0 +1,273 @@
+// Package export writes upload records as reports, ex. a spreadsheet of the week's videos with their links and
+// passwords.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// Format is a report file format.
+type Format string
+
+const (
+	CSV Format = "csv"
+	// JSONL writes one JSON object per record.
+	JSONL    Format = "jsonl"
+	Markdown Format = "markdown"
+)
+
+// timeLayout is how times are written in CSV and Markdown reports, in local time.
+const timeLayout = "2006-01-02 15:04:05"
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case CSV, JSONL, Markdown:
+		return f, nil
+	case "md":
+		return Markdown, nil
+	default:
+		return "", fmt.Errorf("unknown export format %v, expected one of: csv, jsonl, markdown", name)
+	}
+}
+
+// Filter selects which records are exported. Empty fields match every record.
+type Filter struct {
+	Term  string
+	Class string
+	// Status matches the record's overall status.
+	Status database.UploadStatus
+	// From and To select uploads that finished at or after From and before To. Records without an upload time don't
+	// match either.
+	From time.Time
+	To   time.Time
+}
+
+// Match returns whether the record passes the filter. Term and class are compared ignoring case.
+func (f Filter) Match(r database.UploadRecord) bool {
+	if f.Term != "" && !strings.EqualFold(f.Term, r.Term) {
+		return false
+	}
+
+	if f.Class != "" && !strings.EqualFold(f.Class, r.Class) {
+		return false
+	}
+
+	if f.Status != "" && f.Status != r.Status {
+		return false
+	}
+
+	if !f.From.IsZero() && (r.UploadedAt.IsZero() || r.UploadedAt.Before(f.From)) {
+		return false
+	}
+
+	if !f.To.IsZero() && (r.UploadedAt.IsZero() || !r.UploadedAt.Before(f.To)) {
+		return false
+	}
+
+	return true
+}
+
+// Column is a field of the report.
+type Column struct {
+	Name  string
+	value func(r database.UploadRecord) interface{}
+}
+
+var columns = []Column{
+	{Name: "id", value: func(r database.UploadRecord) interface{} { return r.ID }},
+	{Name: "name", value: func(r database.UploadRecord) interface{} { return r.Name }},
+	{Name: "calculated_name", value: func(r database.UploadRecord) interface{} { return r.CalculatedName }},
+	{Name: "term", value: func(r database.UploadRecord) interface{} { return r.Term }},
+	{Name: "class", value: func(r database.UploadRecord) interface{} { return r.Class }},
+	{Name: "status", value: func(r database.UploadRecord) interface{} { return r.Status }},
+	{Name: "video_uri", value: func(r database.UploadRecord) interface{} { return r.VideoURI }},
+	{Name: "password", value: func(r database.UploadRecord) interface{} { return r.Password }},
+	{Name: "size", value: func(r database.UploadRecord) interface{} { return r.Size }},
+	{Name: "duration", value: func(r database.UploadRecord) interface{} { return r.Duration }},
+	{Name: "uploaded_at", value: func(r database.UploadRecord) interface{} { return r.UploadedAt }},
+	{Name: "notification", value: func(r database.UploadRecord) interface{} {
+		if r.Notification == nil {
+			return ""
+		}
+		return r.Notification.Status
+	}},
+}
+
+// DefaultColumns are the columns exported when none are chosen.
+var DefaultColumns = []string{"name", "calculated_name", "video_uri", "password", "size", "duration", "uploaded_at"}
+
+// ColumnNames returns the name of every column that can be exported.
+func ColumnNames() []string {
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+
+	return names
+}
+
+// Columns returns the named columns in order.
+func Columns(names []string) ([]Column, error) {
+	var cols []Column
+	for _, name := range names {
+		name = strings.TrimSpace(strings.ToLower(name))
+		found := false
+		for _, c := range columns {
+			if c.Name == name {
+				cols = append(cols, c)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown column %v, expected one of: %v", name, strings.Join(ColumnNames(), ", "))
+		}
+	}
+
+	return cols, nil
+}
+
+// Write writes the records that pass the filter to w.
+func Write(w io.Writer, format Format, records []database.UploadRecord, cols []Column, filter Filter) error {
+	var matched []database.UploadRecord
+	for _, r := range records {
+		if filter.Match(r) {
+			matched = append(matched, r)
+		}
+	}
+
+	switch format {
+	case CSV:
+		return writeCSV(w, matched, cols)
+	case JSONL:
+		return writeJSONL(w, matched, cols)
+	case Markdown:
+		return writeMarkdown(w, matched, cols)
+	default:
+		return fmt.Errorf("unknown export format %v", format)
+	}
+}
+
+func writeCSV(w io.Writer, records []database.UploadRecord, cols []Column) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Name
+	}
+	cw.Write(header)
+
+	for _, r := range records {
+		cw.Write(row(r, cols))
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONL writes sizes as bytes, durations as seconds, and times in RFC 3339 format. Zero times are null.
+func writeJSONL(w io.Writer, records []database.UploadRecord, cols []Column) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		// encoding/json sorts map keys, so the object is built by hand to keep the columns in order.
+		var b strings.Builder
+		b.WriteString("{")
+		for i, c := range cols {
+			if i > 0 {
+				b.WriteString(",")
+			}
+
+			v := c.value(r)
+			switch t := v.(type) {
+			case time.Duration:
+				v = t.Seconds()
+			case time.Time:
+				if t.IsZero() {
+					v = nil
+				}
+			}
+
+			key, _ := json.Marshal(c.Name)
+			value, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("could not encode %v of %v: %v", c.Name, r.Name, err)
+			}
+
+			b.Write(key)
+			b.WriteString(":")
+			b.Write(value)
+		}
+		b.WriteString("}")
+
+		err := enc.Encode(json.RawMessage(b.String()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeMarkdown(w io.Writer, records []database.UploadRecord, cols []Column) error {
+	var b strings.Builder
+
+	header := make([]string, len(cols))
+	divider := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.Name
+		divider[i] = "---"
+	}
+	writeMarkdownRow(&b, header)
+	writeMarkdownRow(&b, divider)
+
+	for _, r := range records {
+		writeMarkdownRow(&b, row(r, cols))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdownRow(b *strings.Builder, cells []string) {
+	b.WriteString("|")
+	for _, c := range cells {
+		c = strings.ReplaceAll(c, "|", "\\|")
+		c = strings.ReplaceAll(c, "\n", " ")
+		b.WriteString(" " + c + " |")
+	}
+	b.WriteString("\n")
+}
+
+// row formats the record's columns as text. Zero sizes, durations, and times are left empty.
+func row(r database.UploadRecord, cols []Column) []string {
+	cells := make([]string, len(cols))
+	for i, c := range cols {
+		switch v := c.value(r).(type) {
+		case int64:
+			if v != 0 {
+				cells[i] = fmt.Sprint(v)
+			}
+		case time.Duration:
+			if v != 0 {
+				cells[i] = v.Round(time.Second).String()
+			}
+		case time.Time:
+			if !v.IsZero() {
+				cells[i] = v.Local().Format(timeLayout)
+			}
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+
+	return cells
+}
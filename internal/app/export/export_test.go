@@ -0,0 +1,163 @@
+package export_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/export"
+)
+
+var uploaded = time.Date(2023, 2, 6, 18, 30, 0, 0, time.Local)
+
+var records = []database.UploadRecord{
+	{
+		ID:         "100-abc",
+		Name:       "2023-02-06 Tap",
+		Term:       "2023 Spring",
+		Class:      "Tap",
+		Status:     database.Complete,
+		VideoURI:   "/videos/1",
+		Password:   "apple_banana",
+		Size:       1048576,
+		Duration:   time.Hour + 90*time.Second,
+		UploadedAt: uploaded,
+		Notification: &database.Notification{
+			Status:     database.Complete,
+			Recipients: []string{"tap@example.com"},
+			Attempts:   1,
+			At:         uploaded,
+		},
+	},
+	{
+		Name:       "2023-02-08 Jazz | Level 2",
+		Term:       "2023 Spring",
+		Class:      "Jazz",
+		Status:     database.Complete,
+		VideoURI:   "/videos/2",
+		UploadedAt: uploaded.Add(48 * time.Hour),
+	},
+	{
+		Name:   "2023-02-13 Tap",
+		Term:   "2023 Spring",
+		Class:  "Tap",
+		Status: database.InProgress,
+	},
+	{
+		Name:       "2022-10-03 Tap",
+		Term:       "2022 Fall",
+		Class:      "Tap",
+		Status:     database.Complete,
+		VideoURI:   "/videos/0",
+		UploadedAt: uploaded.AddDate(0, -4, 0),
+	},
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  export.Format
+		columns []string
+		filter  export.Filter
+		want    string
+	}{
+		{
+			name:    "csv of the term's finished uploads",
+			format:  export.CSV,
+			columns: export.DefaultColumns,
+			filter:  export.Filter{Term: "2023 spring", Status: database.Complete},
+			want: "name,calculated_name,video_uri,password,size,duration,uploaded_at\n" +
+				"2023-02-06 Tap,,/videos/1,apple_banana,1048576,1h1m30s,2023-02-06 18:30:00\n" +
+				"2023-02-08 Jazz | Level 2,,/videos/2,,,,2023-02-08 18:30:00\n",
+		},
+		{
+			name:    "markdown of one class escapes pipes",
+			format:  export.Markdown,
+			columns: []string{"name", "status", "video_uri"},
+			filter:  export.Filter{Class: "jazz"},
+			want: "| name | status | video_uri |\n" +
+				"| --- | --- | --- |\n" +
+				"| 2023-02-08 Jazz \\| Level 2 | COMPLETE | /videos/2 |\n",
+		},
+		{
+			name:    "jsonl of a date range keeps column order",
+			format:  export.JSONL,
+			columns: []string{"name", "size", "duration", "uploaded_at", "password"},
+			filter:  export.Filter{From: uploaded.Add(-time.Hour), To: uploaded.Add(time.Hour)},
+			want: fmt.Sprintf(`{"name":"2023-02-06 Tap","size":1048576,"duration":3690,"uploaded_at":%q,"password":"apple_banana"}`+"\n",
+				uploaded.Format(time.RFC3339Nano)),
+		},
+		{
+			name:    "csv of notifications",
+			format:  export.CSV,
+			columns: []string{"name", "notification"},
+			filter:  export.Filter{Class: "tap", Status: database.Complete},
+			want:    "name,notification\n2023-02-06 Tap,COMPLETE\n2022-10-03 Tap,\n",
+		},
+		{
+			name:    "jsonl writes missing times as null",
+			format:  export.JSONL,
+			columns: []string{"name", "uploaded_at"},
+			filter:  export.Filter{Status: database.InProgress},
+			want:    `{"name":"2023-02-13 Tap","uploaded_at":null}` + "\n",
+		},
+		{
+			name:    "no matches writes only the header",
+			format:  export.CSV,
+			columns: []string{"name"},
+			filter:  export.Filter{Class: "Ballet"},
+			want:    "name\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cols, err := export.Columns(tt.columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b bytes.Buffer
+			err = export.Write(&b, tt.format, records, cols, tt.filter)
+			if err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("Write() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	_, err := export.Columns([]string{"name", "views"})
+	if err == nil {
+		t.Error("Columns() with an unknown column error = nil, want an error")
+	}
+
+	cols, err := export.Columns([]string{" Video_URI", "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cols) != 2 || cols[0].Name != "video_uri" || cols[1].Name != "name" {
+		t.Errorf("Columns() = %+v, want video_uri and name", cols)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]export.Format{"CSV": export.CSV, "jsonl": export.JSONL, "md": export.Markdown, "markdown": export.Markdown} {
+		got, err := export.ParseFormat(name)
+		if err != nil || got != want {
+			t.Errorf("ParseFormat(%v) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	_, err := export.ParseFormat("xlsx")
+	if err == nil {
+		t.Error("ParseFormat(xlsx) error = nil, want an error")
+	}
+}
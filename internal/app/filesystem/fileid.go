@@ -0,0 +1,55 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// idSampleSize is how much of the file is read from each of its start, middle, and end for its ID.
+const idSampleSize = 1 << 20
+
+// FileID identifies a local file by its contents: its size and a SHA-256 hash of samples from its start, middle, and
+// end, so large videos don't have to be read completely. Files smaller than the samples are hashed completely.
+// Renaming or moving the file doesn't change its ID, ex. 1048576000-3f2a... Files that only differ outside the samples
+// have the same ID, ChecksumID tells them apart.
+func FileID(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("could not open %v: %v", name, err)
+	}
+	defer f.Close()
+
+	i, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("could not read %v: %v", name, err)
+	}
+	size := i.Size()
+
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, size)
+
+	if size <= 3*idSampleSize {
+		_, err = io.Copy(h, f)
+	} else {
+		for _, offset := range []int64{0, size/2 - idSampleSize/2, size - idSampleSize} {
+			_, err = io.Copy(h, io.NewSectionReader(f, offset, idSampleSize))
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read %v: %v", name, err)
+	}
+
+	return fmt.Sprintf("%d-%x", size, h.Sum(nil)[:16]), nil
+}
+
+// ChecksumID identifies a file by its size and full hex SHA-256 checksum, see Checksum. It's used instead of FileID
+// for a file whose FileID matches a different file's.
+func ChecksumID(size int64, checksum string) string {
+	return fmt.Sprintf("%d-%v", size, checksum)
+}
@@ -0,0 +1,200 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// FileSystem is somewhere files can be copied to, either a local path or an SFTP server. Paths use forward slashes.
+type FileSystem interface {
+	MkdirAll(dir string) error
+	Stat(name string) (fs.FileInfo, error)
+	Open(name string) (File, error)
+	// OpenFile opens a file for writing with os.O_* flags, creating it if needed.
+	OpenFile(name string, flag int) (File, error)
+	// Rename moves a file, replacing the destination if it exists.
+	Rename(oldname, newname string) error
+	Remove(name string) error
+}
+
+// File is an open file on a FileSystem.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// partialSuffix is added to files while they're being copied so incomplete copies aren't mistaken for finished ones.
+const partialSuffix = ".partial"
+
+// Local is the local filesystem.
+type Local struct{}
+
+func (Local) MkdirAll(dir string) error {
+	return os.MkdirAll(filepath.FromSlash(dir), 0750)
+}
+
+func (Local) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(name))
+}
+
+func (Local) Open(name string) (File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+func (Local) OpenFile(name string, flag int) (File, error) {
+	return os.OpenFile(filepath.FromSlash(name), flag|os.O_CREATE, 0640)
+}
+
+func (Local) Rename(oldname, newname string) error {
+	return os.Rename(filepath.FromSlash(oldname), filepath.FromSlash(newname))
+}
+
+func (Local) Remove(name string) error {
+	return os.Remove(filepath.FromSlash(name))
+}
+
+// Copy copies the local file at src to dst on fsys and returns the file's SHA-256 checksum. The copy is written to
+// dst.partial first; if a previous copy was interrupted, it continues from the end of the partial file. The copy is
+// read back and compared to src's checksum before it's renamed to dst, and a partial file that doesn't match is
+// removed so the next attempt starts over.
+func Copy(src string, fsys FileSystem, dst string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", fmt.Errorf("error opening file to copy: %v", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return "", fmt.Errorf("could not get %v size: %v", src, err)
+	}
+
+	err = fsys.MkdirAll(path.Dir(dst))
+	if err != nil {
+		return "", fmt.Errorf("could not create directory for %v: %v", dst, err)
+	}
+
+	partial := dst + partialSuffix
+
+	var offset int64
+	pInfo, err := fsys.Stat(partial)
+	if err == nil && pInfo.Size() <= info.Size() {
+		offset = pInfo.Size()
+	}
+
+	flag := os.O_WRONLY
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+
+	out, err := fsys.OpenFile(partial, flag)
+	if err != nil {
+		return "", fmt.Errorf("could not open %v: %v", partial, err)
+	}
+
+	if offset > 0 {
+		fmt.Printf("resuming copy of %v at byte %v\n", src, offset)
+	}
+
+	_, err = out.Seek(offset, io.SeekStart)
+	if err == nil {
+		_, err = in.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+
+	cErr := out.Close()
+	if err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error copying %v to %v: %v", src, partial, err)
+	}
+
+	want, err := checksumLocal(src)
+	if err != nil {
+		return "", err
+	}
+
+	got, err := Checksum(fsys, partial)
+	if err != nil {
+		return "", err
+	}
+
+	if got != want {
+		rErr := fsys.Remove(partial)
+		if rErr != nil {
+			fmt.Printf("WARN: could not remove mismatched copy %v: %v\n", partial, rErr)
+		}
+
+		return "", fmt.Errorf("checksum of copy %v does not match %v, the next attempt will copy it again", got, want)
+	}
+
+	err = fsys.Rename(partial, dst)
+	if err != nil {
+		return "", fmt.Errorf("could not rename %v to %v: %v", partial, dst, err)
+	}
+
+	return want, nil
+}
+
+// Checksum returns the hex-encoded SHA-256 checksum of a file on fsys.
+func Checksum(fsys FileSystem, name string) (string, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("could not open %v to verify it: %v", name, err)
+	}
+	defer f.Close()
+
+	return checksum(f, name)
+}
+
+func checksumLocal(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("could not open %v to verify it: %v", name, err)
+	}
+	defer f.Close()
+
+	return checksum(f, name)
+}
+
+func checksum(r io.Reader, name string) (string, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", fmt.Errorf("could not read %v to verify it: %v", name, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Move moves a local file, copying and then deleting it if it can't be renamed because the destination is on another
+// filesystem, ex. a different mount. Other rename errors are returned.
+func Move(src, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0750)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil || !crossDevice(err) {
+		return err
+	}
+
+	_, err = Copy(src, Local{}, filepath.ToSlash(dst))
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,233 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+	"github.com/pkg/sftp"
+)
+
+func writeRandomFile(t *testing.T, path string, size int) []byte {
+	t.Helper()
+
+	b := make([]byte, size)
+	rand.Read(b)
+	err := os.WriteFile(path, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// newTestSFTP serves the local filesystem over SFTP in-process and returns a client for it.
+func newTestSFTP(t *testing.T) *filesystem.SFTP {
+	t.Helper()
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := filesystem.NewSFTP(client)
+	t.Cleanup(func() {
+		// closing the server ends the pipes, which the client waits for.
+		server.Close()
+		s.Close()
+	})
+
+	return s
+}
+
+func TestCopy(t *testing.T) {
+	targets := map[string]func(t *testing.T) filesystem.FileSystem{
+		"local": func(t *testing.T) filesystem.FileSystem { return filesystem.Local{} },
+		"sftp":  func(t *testing.T) filesystem.FileSystem { return newTestSFTP(t) },
+	}
+
+	for name, newFS := range targets {
+		t.Run(name, func(t *testing.T) {
+			fsys := newFS(t)
+			dir := t.TempDir()
+			src := filepath.Join(dir, "Tap Week 1.mp4")
+			video := writeRandomFile(t, src, 300*1024)
+			dst := filepath.ToSlash(filepath.Join(dir, "archive", "2023 Spring", "Tap Week 1.mp4"))
+
+			// an interrupted copy left the first part of the file behind.
+			err := os.MkdirAll(filepath.Dir(filepath.FromSlash(dst)), 0750)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(filepath.FromSlash(dst)+".partial", video[:100*1024], 0640)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sum, err := filesystem.Copy(src, fsys, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(filepath.FromSlash(dst))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, video) {
+				t.Errorf("Copy() wrote %v bytes that don't match the %v byte file", len(got), len(video))
+			}
+
+			want, err := filesystem.Checksum(filesystem.Local{}, src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sum != want {
+				t.Errorf("Copy() checksum = %v, want %v", sum, want)
+			}
+
+			if _, err := os.Stat(filepath.FromSlash(dst) + ".partial"); !os.IsNotExist(err) {
+				t.Errorf("Copy() left the partial file behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestCopy_corruptPartial(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Tap Week 1.mp4")
+	video := writeRandomFile(t, src, 64*1024)
+	dst := filepath.ToSlash(filepath.Join(dir, "archive", "Tap Week 1.mp4"))
+
+	// a partial file that doesn't match the start of the source.
+	os.MkdirAll(filepath.Join(dir, "archive"), 0750)
+	err := os.WriteFile(filepath.FromSlash(dst)+".partial", make([]byte, 1024), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = filesystem.Copy(src, filesystem.Local{}, dst)
+	if err == nil {
+		t.Fatal("Copy() expected a checksum mismatch")
+	}
+
+	if _, err := os.Stat(filepath.FromSlash(dst)); !os.IsNotExist(err) {
+		t.Errorf("Copy() renamed a mismatched copy into place: %v", err)
+	}
+
+	// the mismatched partial was removed so the next attempt starts over.
+	_, err = filesystem.Copy(src, filesystem.Local{}, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(filepath.FromSlash(dst))
+	if !bytes.Equal(got, video) {
+		t.Errorf("Copy() retry wrote %v bytes that don't match the %v byte file", len(got), len(video))
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "upload", "Tap Week 1.mp4")
+	os.MkdirAll(filepath.Dir(src), 0750)
+	video := writeRandomFile(t, src, 1024)
+	dst := filepath.Join(dir, "finished", "uploaded", "Tap Week 1.mp4")
+
+	err := filesystem.Move(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, video) {
+		t.Error("Move() contents don't match the original file")
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("Move() left the original file behind: %v", err)
+	}
+}
+
+func TestMove_renameError(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Tap Week 1.mp4")
+	writeRandomFile(t, src, 1024)
+
+	// a file can't replace a directory, which isn't a cross-device error so the file isn't copied instead.
+	dst := filepath.Join(dir, "finished")
+	os.MkdirAll(dst, 0750)
+	writeRandomFile(t, filepath.Join(dst, "Ballet Week 1.mp4"), 1024)
+
+	err := filesystem.Move(src, dst)
+	if err == nil {
+		t.Fatal("Move() succeeded")
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("Move() removed the original file: %v", err)
+	}
+}
+
+func TestFileID(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, size := range []int{64 * 1024, 5 * 1024 * 1024} {
+		path := filepath.Join(dir, "Tap Week 1.mp4")
+		video := writeRandomFile(t, path, size)
+
+		id, err := filesystem.FileID(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// renaming the file keeps its ID.
+		renamed := filepath.Join(dir, "Tap Week 1 (copy).mp4")
+		err = os.Rename(path, renamed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := filesystem.FileID(renamed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != id {
+			t.Errorf("FileID() of renamed %v byte file = %v, want %v", size, got, id)
+		}
+
+		// changing the start of the file, which is always sampled, changes it.
+		video[0]++
+		os.WriteFile(renamed, video, 0644)
+		got, err = filesystem.FileID(renamed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got == id {
+			t.Errorf("FileID() of changed %v byte file = %v, want a different ID", size, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPSettings contains the server and credentials used to copy files over SFTP.
+type SFTPSettings struct {
+	Host string `yaml:"host"`
+	// Port defaults to 22.
+	Port int    `yaml:"port"`
+	User string `yaml:"user"`
+	// Password can be left empty and set with the SFTP_PASSWORD environment variable instead. Unused if a private
+	// key is configured.
+	Password       string `yaml:"password"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	// KnownHostsPath is used to verify the server's host key, defaults to ~/.ssh/known_hosts.
+	KnownHostsPath string `yaml:"known_hosts_path"`
+}
+
+const (
+	defaultSFTPPort = 22
+	sftpPasswordEnv = "SFTP_PASSWORD"
+)
+
+// SFTP is a FileSystem on an SFTP server.
+type SFTP struct {
+	client *sftp.Client
+	conn   *ssh.Client
+}
+
+// DialSFTP connects to the SFTP server. The connection should be closed when it's no longer needed.
+func DialSFTP(s SFTPSettings) (*SFTP, error) {
+	if s.Host == "" || s.User == "" {
+		return nil, errors.New("sftp host and user are required")
+	}
+
+	auth, err := s.authMethod()
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeys, err := s.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.Port
+	if port == 0 {
+		port = defaultSFTPPort
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(s.Host, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %v: %v", s.Host, err)
+	}
+
+	c, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not start sftp session with %v: %v", s.Host, err)
+	}
+
+	return &SFTP{client: c, conn: conn}, nil
+}
+
+// NewSFTP wraps an existing SFTP client.
+func NewSFTP(c *sftp.Client) *SFTP {
+	return &SFTP{client: c}
+}
+
+func (s SFTPSettings) authMethod() (ssh.AuthMethod, error) {
+	if s.PrivateKeyPath != "" {
+		key, err := os.ReadFile(s.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read sftp private key: %v", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse sftp private key: %v", err)
+		}
+
+		return ssh.PublicKeys(signer), nil
+	}
+
+	password := s.Password
+	if password == "" {
+		password = os.Getenv(sftpPasswordEnv)
+	}
+
+	if password == "" {
+		return nil, errors.New("sftp requires a private_key_path or password")
+	}
+
+	return ssh.Password(password), nil
+}
+
+func (s SFTPSettings) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := s.KnownHostsPath
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not find known_hosts, set known_hosts_path: %v", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	cb, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts %v: %v", path, err)
+	}
+
+	return cb, nil
+}
+
+func (s *SFTP) MkdirAll(dir string) error {
+	return s.client.MkdirAll(dir)
+}
+
+func (s *SFTP) Stat(name string) (fs.FileInfo, error) {
+	return s.client.Stat(name)
+}
+
+func (s *SFTP) Open(name string) (File, error) {
+	return s.client.Open(name)
+}
+
+func (s *SFTP) OpenFile(name string, flag int) (File, error) {
+	return s.client.OpenFile(name, flag|os.O_CREATE)
+}
+
+// Rename uses the posix-rename extension when the server supports it, since plain SFTP renames fail if the
+// destination exists.
+func (s *SFTP) Rename(oldname, newname string) error {
+	err := s.client.PosixRename(oldname, newname)
+	if err == nil {
+		return nil
+	}
+
+	s.client.Remove(newname)
+	return s.client.Rename(oldname, newname)
+}
+
+func (s *SFTP) Remove(name string) error {
+	return s.client.Remove(name)
+}
+
+// Close ends the SFTP session and its connection.
+func (s *SFTP) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+
+	return err
+}
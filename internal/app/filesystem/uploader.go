@@ -0,0 +1,128 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// Settings contains where recordings are archived.
+type Settings struct {
+	// Path is the folder files are copied into, on the SFTP server if a host is configured.
+	Path string `yaml:"path"`
+	// Layout is the folder structure under Path, see metadata.ExpandLayout. Defaults to {term}/{class}/Week {week}.
+	Layout string       `yaml:"layout"`
+	SFTP   SFTPSettings `yaml:"sftp"`
+}
+
+const defaultLayout = "{term}/{class}/Week {week}"
+
+// Uploader copies videos to a local folder or SFTP server.
+type Uploader struct {
+	settings Settings
+	uploadDB database.UploadDatastore
+}
+
+// New creates an uploader that copies files to the configured folder and tracks them in db.
+func New(db database.UploadDatastore, s Settings) (Uploader, error) {
+	if s.Path == "" {
+		return Uploader{}, errors.New("filesystem_settings.path is required")
+	}
+
+	s.Path = filepath.ToSlash(s.Path)
+	if s.Layout == "" {
+		s.Layout = defaultLayout
+	}
+
+	return Uploader{
+		settings: s,
+		uploadDB: db,
+	}, nil
+}
+
+func (u Uploader) Upload(data destination.UploadData) error {
+	r, err := destination.FindRecord(u.uploadDB, data)
+	if err != nil {
+		fmt.Printf("WARN: error checking for prior upload, attempting upload. error: %v\n", err)
+	}
+
+	if r.Status == database.Complete {
+		fmt.Printf("file %v was already copied, skipping...\n", data.Filename)
+		return nil
+	}
+
+	dir, err := metadata.ExpandLayout(u.settings.Layout, data.Details)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+	}
+
+	dst := path.Join(u.settings.Path, dir, data.Filename)
+
+	r.Name = data.Name()
+	r.CalculatedName = data.VideoName
+	r.Term = data.Term
+	r.Status = database.InProgress
+	r.VideoURI = u.location(dst)
+
+	saveErr := u.uploadDB.PutUpload(r)
+	if saveErr != nil {
+		return fmt.Errorf("error saving initial data for %v: %v", data.Filename, saveErr)
+	}
+
+	fsys, closeFS, err := u.open()
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+	}
+	defer closeFS()
+
+	fmt.Printf("Copying %v to %v....\n", data.Filename, r.VideoURI)
+	sum, err := Copy(data.FilePath, fsys, dst)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error copying file %v: %v", data.Filename, err))
+	}
+
+	data.Progress.Sent(data.FileSize)
+	r.Status = database.Complete
+	r.Checksum = sum
+	r.ErrorDetails = nil
+
+	pErr := u.uploadDB.PutUpload(r)
+	if pErr != nil {
+		fmt.Printf("error updating file %v status locally but the copy succeeded: %v\n", data.Filename, pErr)
+	}
+
+	fmt.Println("------------------------------")
+	fmt.Printf("finished copying file: \n%v\nlocation: %v\n", data.Filename, r.VideoURI)
+	fmt.Println("------------------------------")
+
+	return nil
+}
+
+// open returns the configured FileSystem and a function that closes it.
+func (u Uploader) open() (FileSystem, func(), error) {
+	if u.settings.SFTP.Host == "" {
+		return Local{}, func() {}, nil
+	}
+
+	s, err := DialSFTP(u.settings.SFTP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s, func() { s.Close() }, nil
+}
+
+// location describes where a file was copied for the upload record, ex. sftp://archive@nas.example.edu/videos/a.mp4.
+func (u Uploader) location(p string) string {
+	if u.settings.SFTP.Host == "" {
+		return p
+	}
+
+	return fmt.Sprintf("sftp://%v@%v%v", u.settings.SFTP.User, u.settings.SFTP.Host, path.Join("/", p))
+}
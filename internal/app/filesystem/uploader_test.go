@@ -0,0 +1,68 @@
+package filesystem_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/filesystem"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+func TestUploader_Upload(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "Tap Week 3.mp4")
+	writeRandomFile(t, src, 4096)
+	archive := filepath.Join(dir, "archive")
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := filesystem.New(db, filesystem.Settings{Path: archive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := destination.UploadData{
+		Filename: "Tap Week 3.mp4",
+		Details:  metadata.VideoDetails{Filename: "Tap Week 3.mp4", Term: "2023 Spring", Class: "Tap", Week: 3},
+		Term:     "2023 Spring",
+		FilePath: src,
+		FileSize: 4096,
+	}
+
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(archive, "2023 Spring", "Tap", "Week 3", "Tap Week 3.mp4")
+	if _, err := os.Stat(want); err != nil {
+		t.Fatalf("Upload() did not copy the file to the layout's folder: %v", err)
+	}
+
+	r, err := db.GetUpload("Tap Week 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Complete || r.VideoURI != filepath.ToSlash(want) || len(r.Checksum) != 64 {
+		t.Errorf("Upload() record = %+v", r)
+	}
+
+	// a finished copy is skipped even if the archive copy goes away.
+	os.Remove(want)
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(want); !os.IsNotExist(err) {
+		t.Errorf("Upload() copied a finished file again: %v", err)
+	}
+}
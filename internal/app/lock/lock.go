@@ -0,0 +1,88 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when another process holds the lock and the timeout passed.
+var ErrLocked = errors.New("locked by another process")
+
+// retryInterval is how often a held lock is checked while waiting for it.
+const retryInterval = 100 * time.Millisecond
+
+// File is an advisory lock held on a file. The lock is released automatically if the process exits.
+type File struct {
+	f *os.File
+}
+
+// Acquire takes an exclusive lock on path, creating the file if needed. If another process holds the lock, it waits
+// up to timeout for it to be released; a timeout of 0 only tries once. ErrLocked is returned if the lock wasn't
+// acquired.
+func Acquire(path string, timeout time.Duration) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file %v: %v", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %v: %v", path, err)
+		}
+
+		if locked {
+			return &File{f: f}, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+
+		time.Sleep(retryInterval)
+	}
+}
+
+// Release unlocks and closes the file.
+func (l *File) Release() error {
+	err := unlock(l.f)
+	cErr := l.f.Close()
+	if err != nil {
+		return err
+	}
+
+	return cErr
+}
+
+// WriteOwner records the current process's ID in the lock file so other instances can report who holds it.
+func (l *File) WriteOwner() error {
+	err := l.f.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	return err
+}
+
+// Owner returns the process ID written to a lock file by WriteOwner, or 0 if it isn't known.
+func Owner(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+
+	return pid
+}
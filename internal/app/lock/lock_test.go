@@ -0,0 +1,56 @@
+package lock_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/lock"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.lock")
+
+	held, err := lock.Acquire(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = held.WriteOwner()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lock.Owner(path); got != os.Getpid() {
+		t.Errorf("Owner() = %v, want %v", got, os.Getpid())
+	}
+
+	_, err = lock.Acquire(path, 0)
+	if !errors.Is(err, lock.ErrLocked) {
+		t.Fatalf("Acquire() of a held lock error = %v, want ErrLocked", err)
+	}
+
+	start := time.Now()
+	_, err = lock.Acquire(path, 300*time.Millisecond)
+	if !errors.Is(err, lock.ErrLocked) || time.Since(start) < 300*time.Millisecond {
+		t.Fatalf("Acquire() with a timeout error = %v after %v, want ErrLocked after the timeout", err, time.Since(start))
+	}
+
+	// a waiting caller gets the lock once it's released.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		held.Release()
+	}()
+
+	l, err := lock.Acquire(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("Acquire() after release error = %v", err)
+	}
+
+	err = l.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Duration reads a video's length from the movie header of an MP4 or QuickTime file.
+func Duration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not open %v: %v", path, err)
+	}
+	defer f.Close()
+
+	i, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("could not read %v: %v", path, err)
+	}
+
+	d, err := readDuration(f, 0, i.Size())
+	if err != nil {
+		return 0, fmt.Errorf("could not read the duration of %v: %v", path, err)
+	}
+
+	return d, nil
+}
+
+// readDuration looks for the moov box between start and end, and reads the duration from its mvhd box.
+func readDuration(f io.ReadSeeker, start, end int64) (time.Duration, error) {
+	for offset := start; offset < end; {
+		_, err := f.Seek(offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+
+		var header [8]byte
+		_, err = io.ReadFull(f, header[:])
+		if err != nil {
+			return 0, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// the box extends to the end of the file.
+			size = end - offset
+		case 1:
+			var large [8]byte
+			_, err = io.ReadFull(f, large[:])
+			if err != nil {
+				return 0, err
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerSize = 16
+		}
+
+		if size < headerSize || offset+size > end {
+			return 0, fmt.Errorf("invalid %q box size %v at offset %v", boxType, size, offset)
+		}
+
+		switch boxType {
+		case "moov":
+			return readDuration(f, offset+headerSize, offset+size)
+		case "mvhd":
+			return readMovieHeader(f)
+		}
+
+		offset += size
+	}
+
+	return 0, errors.New("no movie header found")
+}
+
+// readMovieHeader reads the duration from an mvhd box's contents.
+func readMovieHeader(r io.Reader) (time.Duration, error) {
+	var version [4]byte
+	_, err := io.ReadFull(r, version[:])
+	if err != nil {
+		return 0, err
+	}
+
+	var timescale uint32
+	var duration uint64
+	switch version[0] {
+	case 0:
+		var h struct {
+			Created, Modified, Timescale, Duration uint32
+		}
+		err = binary.Read(r, binary.BigEndian, &h)
+		timescale, duration = h.Timescale, uint64(h.Duration)
+	case 1:
+		var h struct {
+			Created, Modified uint64
+			Timescale         uint32
+			Duration          uint64
+		}
+		err = binary.Read(r, binary.BigEndian, &h)
+		timescale, duration = h.Timescale, h.Duration
+	default:
+		return 0, fmt.Errorf("unsupported movie header version %v", version[0])
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if timescale == 0 {
+		return 0, errors.New("movie header has no timescale")
+	}
+
+	seconds := duration / uint64(timescale)
+	remainder := duration % uint64(timescale)
+
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(timescale), nil
+}
@@ -0,0 +1,101 @@
+package metadata_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// box returns an MP4 box of the given type containing the given contents.
+func box(boxType string, contents ...[]byte) []byte {
+	body := bytes.Join(contents, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	b = append(b, boxType...)
+	return append(b, body...)
+}
+
+// largeBox returns a box that uses a 64-bit size.
+func largeBox(boxType string, contents []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = append(b, boxType...)
+	b = binary.BigEndian.AppendUint64(b, uint64(16+len(contents)))
+	return append(b, contents...)
+}
+
+func movieHeaderV0(timescale, duration uint32) []byte {
+	b := []byte{0, 0, 0, 0}
+	for _, v := range []uint32{1, 2, timescale, duration} {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return box("mvhd", b, make([]byte, 80))
+}
+
+func movieHeaderV1(timescale uint32, duration uint64) []byte {
+	b := []byte{1, 0, 0, 0}
+	b = binary.BigEndian.AppendUint64(b, 1)
+	b = binary.BigEndian.AppendUint64(b, 2)
+	b = binary.BigEndian.AppendUint32(b, timescale)
+	b = binary.BigEndian.AppendUint64(b, duration)
+	return box("mvhd", b, make([]byte, 80))
+}
+
+func TestDuration(t *testing.T) {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41"))
+	mdat := box("mdat", make([]byte, 1024))
+
+	tests := []struct {
+		name     string
+		contents []byte
+		want     time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "movie header after media data",
+			contents: bytes.Join([][]byte{ftyp, mdat, box("moov", movieHeaderV0(1000, 3723500))}, nil),
+			want:     time.Hour + 2*time.Minute + 3*time.Second + 500*time.Millisecond,
+		},
+		{
+			name:     "movie header before media data with a 64-bit size",
+			contents: bytes.Join([][]byte{ftyp, box("moov", box("udta"), movieHeaderV0(600, 5400)), largeBox("mdat", make([]byte, 64))}, nil),
+			want:     9 * time.Second,
+		},
+		{
+			name:     "version 1 movie header",
+			contents: bytes.Join([][]byte{ftyp, box("moov", movieHeaderV1(90000, 90000*3600*3))}, nil),
+			want:     3 * time.Hour,
+		},
+		{
+			name:     "no movie header",
+			contents: bytes.Join([][]byte{ftyp, mdat}, nil),
+			wantErr:  true,
+		},
+		{
+			name:     "truncated file",
+			contents: bytes.Join([][]byte{ftyp, mdat[:100]}, nil),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "lecture.mp4")
+			err := os.WriteFile(path, tt.contents, 0640)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := metadata.Duration(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Duration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Duration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -17,6 +20,41 @@ type Class struct {
 	Name      string    `yaml:"name"`
 	DayOfWeek string    `yaml:"day_of_week"`
 	StartTime time.Time `yaml:"start_time"`
+	// ThumbnailOffset is how far into the class's videos to take the thumbnail from, ex. 1m30s. Unused if empty.
+	ThumbnailOffset time.Duration `yaml:"thumbnail_offset"`
+	// EmbedDomains overrides vimeo_settings.embed_domains for this class's videos if set.
+	EmbedDomains []string `yaml:"embed_domains"`
+	// YouTubePlaylistID overrides youtube_settings.playlist_id for this class's videos if set.
+	YouTubePlaylistID string `yaml:"youtube_playlist_id"`
+	// PeerTubeChannelID and PeerTubePlaylistID override peertube_settings.channel_id and playlist_id if set.
+	PeerTubeChannelID  int    `yaml:"peertube_channel_id"`
+	PeerTubePlaylistID string `yaml:"peertube_playlist_id"`
+	// PasswordMode overrides passphrase.mode for this class's video passwords if set, ex. pin for a class that reads
+	// them aloud.
+	PasswordMode string `yaml:"password_mode"`
+	// NotifyRecipients overrides notifications.recipients for this class's videos if set.
+	NotifyRecipients []string `yaml:"notify_recipients"`
+}
+
+// MatchClass returns the class whose name appears in the filename, ignoring case. If several match, the class with
+// the longest name is used so "Advanced Tap" is preferred over "Tap".
+func MatchClass(classes []Class, filename string) (Class, bool) {
+	lowerName := strings.ToLower(filename)
+
+	var match Class
+	found := false
+	for _, c := range classes {
+		if c.Name == "" || !strings.Contains(lowerName, strings.ToLower(c.Name)) {
+			continue
+		}
+
+		if !found || len(c.Name) > len(match.Name) {
+			match = c
+			found = true
+		}
+	}
+
+	return match, found
 }
 
 // CreationDateFromMDLS attempts to derive a file's creation date using the mdls command.
@@ -90,14 +128,14 @@ func ClassNameWeek(classes []Class, semesterStartDate time.Time, videoCreationDa
 	// 168 hours per week
 	weekNumber := time.Since(semesterStartDate).Hours() / 168
 
-	season := yearSeason(semesterStartDate)
+	season := Term(semesterStartDate)
 
 	// ex. Advanced Tap 2023 Spring - Week 10; season and year added to make video names unique
 	return fmt.Sprintf("%v %v - Week %v", className, season, weekNumber), nil
 }
 
-// yearSeason returns the year and season of the given date.
-func yearSeason(d time.Time) string {
+// Term returns the year and season of the given date, ex. 2023 Spring. Used to group uploads by semester.
+func Term(d time.Time) string {
 	year := d.Year()
 	season := ""
 
@@ -112,3 +150,87 @@ func yearSeason(d time.Time) string {
 
 	return fmt.Sprintf("%v %v", year, season)
 }
+
+// VideoDetails are the values available to video name and description templates.
+type VideoDetails struct {
+	Filename       string
+	Name           string
+	CalculatedName string
+	Term           string
+	Class          string
+	// Week is the week of the semester the video is from, starting at 1. Zero if it's unknown.
+	Week int
+}
+
+var weekPattern = regexp.MustCompile(`(?i)\bweek\s*(\d+)`)
+
+// WeekNumber returns the week of the semester a video is from, starting at 1. A week in the filename such as
+// "Tap Week 3" is used if there is one, otherwise the week is calculated from when the video was recorded.
+func WeekNumber(filename string, semesterStartDate, recorded time.Time) int {
+	if m := weekPattern.FindStringSubmatch(filename); m != nil {
+		w, err := strconv.Atoi(m[1])
+		if err == nil {
+			return w
+		}
+	}
+
+	if semesterStartDate.IsZero() || recorded.Before(semesterStartDate) {
+		return 0
+	}
+
+	// 168 hours per week
+	return int(recorded.Sub(semesterStartDate).Hours()/168) + 1
+}
+
+var layoutPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// ExpandLayout fills in a directory layout such as "{term}/{class}/Week {week}" with the video's details. The
+// placeholders are {term}, {class}, {week}, {name}, and {filename}; any others are an error.
+func ExpandLayout(layout string, d VideoDetails) (string, error) {
+	values := map[string]string{
+		"term":     d.Term,
+		"class":    d.Class,
+		"week":     strconv.Itoa(d.Week),
+		"name":     d.Name,
+		"filename": d.Filename,
+	}
+
+	var unknown []string
+	expanded := layoutPattern.ReplaceAllStringFunc(layout, func(p string) string {
+		v, ok := values[strings.Trim(p, "{}")]
+		if !ok {
+			unknown = append(unknown, p)
+			return p
+		}
+
+		// values are single path segments.
+		return strings.ReplaceAll(v, "/", "-")
+	})
+
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholders %v in layout %q", strings.Join(unknown, ", "), layout)
+	}
+
+	return expanded, nil
+}
+
+// ApplyTemplate renders tmpl using the given video details, ex. "{{.Name}} ({{.Term}})".
+// If tmpl is empty, fallback is returned unchanged.
+func ApplyTemplate(tmpl, fallback string, d VideoDetails) (string, error) {
+	if tmpl == "" {
+		return fallback, nil
+	}
+
+	t, err := template.New("video").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template %q: %v", tmpl, err)
+	}
+
+	sb := strings.Builder{}
+	err = t.Execute(&sb, d)
+	if err != nil {
+		return "", fmt.Errorf("could not apply template %q: %v", tmpl, err)
+	}
+
+	return sb.String(), nil
+}
@@ -3,6 +3,8 @@ package metadata_test
 import (
 	"testing"
 	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
 )
 
 func TestCalculateUTCOffset(t *testing.T) {
@@ -18,3 +20,158 @@ func TestCalculateUTCOffset(t *testing.T) {
 		t.Errorf("TestCalculateUTCOffset() = got %v want %v", got, want)
 	}
 }
+
+func TestApplyTemplate(t *testing.T) {
+	details := metadata.VideoDetails{
+		Filename: "Advanced Tap.mp4",
+		Name:     "Advanced Tap",
+		Term:     "2023 Spring",
+	}
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		fallback string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "empty template uses fallback",
+			tmpl:     "",
+			fallback: "Advanced Tap.mp4",
+			want:     "Advanced Tap.mp4",
+		},
+		{
+			name: "template fields are rendered",
+			tmpl: "{{.Name}} ({{.Term}})",
+			want: "Advanced Tap (2023 Spring)",
+		},
+		{
+			name:    "unknown field is an error",
+			tmpl:    "{{.Instructor}}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := metadata.ApplyTemplate(tt.tmpl, tt.fallback, details)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ApplyTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ApplyTemplate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchClass(t *testing.T) {
+	classes := []metadata.Class{
+		{Name: "Tap"},
+		{Name: "Advanced Tap"},
+		{Name: "Ballet"},
+	}
+
+	tests := []struct {
+		name      string
+		filename  string
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "longest matching name wins",
+			filename:  "2023-01-01 advanced tap.mp4",
+			want:      "Advanced Tap",
+			wantFound: true,
+		},
+		{
+			name:      "single match",
+			filename:  "Ballet week 2.mov",
+			want:      "Ballet",
+			wantFound: true,
+		},
+		{
+			name:     "no match",
+			filename: "Jazz.mp4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := metadata.MatchClass(classes, tt.filename)
+			if found != tt.wantFound {
+				t.Errorf("MatchClass() found = %v, want %v", found, tt.wantFound)
+			}
+			if got.Name != tt.want {
+				t.Errorf("MatchClass() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeekNumber(t *testing.T) {
+	start := time.Date(2023, time.January, 9, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filename string
+		recorded time.Time
+		want     int
+	}{
+		{
+			name:     "week in filename is used",
+			filename: "Tap Week 12.mp4",
+			recorded: start,
+			want:     12,
+		},
+		{
+			name:     "first week of the semester",
+			filename: "Tap.mp4",
+			recorded: start.Add(time.Hour * 50),
+			want:     1,
+		},
+		{
+			name:     "later week of the semester",
+			filename: "Tap.mp4",
+			recorded: start.AddDate(0, 0, 22),
+			want:     4,
+		},
+		{
+			name:     "recorded before the semester is unknown",
+			filename: "Tap.mp4",
+			recorded: start.AddDate(0, 0, -1),
+			want:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadata.WeekNumber(tt.filename, start, tt.recorded); got != tt.want {
+				t.Errorf("WeekNumber() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandLayout(t *testing.T) {
+	details := metadata.VideoDetails{
+		Filename: "Tap Week 3.mp4",
+		Name:     "Tap Week 3",
+		Term:     "2023 Spring",
+		Class:    "Tap/Jazz",
+		Week:     3,
+	}
+
+	got, err := metadata.ExpandLayout("{term}/{class}/Week {week}", details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "2023 Spring/Tap-Jazz/Week 3"; got != want {
+		t.Errorf("ExpandLayout() = %v, want %v", got, want)
+	}
+
+	_, err = metadata.ExpandLayout("{term}/{teacher}", details)
+	if err == nil {
+		t.Error("ExpandLayout() expected an error for an unknown placeholder")
+	}
+}
@@ -0,0 +1,296 @@
+// Package notify emails the link and password of uploaded videos to the people who share them with students, either
+// one email per video or a digest of every video from an upload run.
+package notify
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// SecuritySTARTTLS upgrades a plain connection to TLS before authenticating, usually on port 587. It's the
+	// default.
+	SecuritySTARTTLS = "starttls"
+	// SecurityTLS connects with TLS from the start, usually on port 465.
+	SecurityTLS = "tls"
+	// SecurityNone doesn't encrypt the connection, only for mail servers on the same machine.
+	SecurityNone = "none"
+
+	// ModeEach sends an email for every uploaded video, the default.
+	ModeEach = "each"
+	// ModeDigest sends one email listing every video uploaded in a run to each list of recipients.
+	ModeDigest = "digest"
+
+	defaultRetries    = 2
+	defaultRetryDelay = 10 * time.Second
+	// sessionTimeout limits how long sending one email can take, including connecting.
+	sessionTimeout = time.Minute
+
+	smtpPasswordEnv = "SMTP_PASSWORD"
+)
+
+const (
+	defaultSubject = "New video: {{.Name}}"
+	defaultBody    = `{{.Name}} has been uploaded.
+
+Link: {{.VideoURI}}
+{{if .Password}}Password: {{.Password}}
+{{end}}`
+	defaultDigestSubject = "{{len .Uploads}} new videos"
+	defaultDigestBody    = `{{range .Uploads}}{{.Name}}
+Link: {{.VideoURI}}
+{{if .Password}}Password: {{.Password}}
+{{end}}
+{{end}}`
+)
+
+// Settings configure the mail server notifications are sent through and what they say.
+type Settings struct {
+	Host string `yaml:"host"`
+	// Port defaults to 465 with tls security, otherwise 587.
+	Port int `yaml:"port"`
+	// Security is starttls, tls, or none, see SecuritySTARTTLS.
+	Security string `yaml:"security"`
+	// Username and Password log in to the server if a username is set. Password can be left empty and set with the
+	// SMTP_PASSWORD environment variable instead.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// RootCAPath is a PEM file of certificates to trust instead of the system's, for servers with their own
+	// certificate authority.
+	RootCAPath string `yaml:"root_ca_path"`
+	From       string `yaml:"from"`
+	// Recipients get every notification unless a class has its own.
+	Recipients []string `yaml:"recipients"`
+	// Mode is each or digest, see ModeEach.
+	Mode string `yaml:"mode"`
+	// Subject and Body are text/template templates for the email about one video, see Upload for their values.
+	// DigestSubject and DigestBody are used for digests, with the videos in .Uploads.
+	Subject       string `yaml:"subject"`
+	Body          string `yaml:"body"`
+	DigestSubject string `yaml:"digest_subject"`
+	DigestBody    string `yaml:"digest_body"`
+	// Retries is how many more times sending is tried after it fails, defaults to 2 if it's not set; 0 turns retries
+	// off. RetryDelay is how long to wait before the first retry and doubles after each, defaults to 10s.
+	Retries    *int          `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+// Enabled returns whether notifications are configured.
+func (s Settings) Enabled() bool {
+	return s.Host != ""
+}
+
+// Upload is a video a notification is about. Its fields are the template values.
+type Upload struct {
+	Name     string
+	Class    string
+	Term     string
+	Week     int
+	VideoURI string
+	Password string
+}
+
+// digest holds the digest template values.
+type digest struct {
+	Uploads []Upload
+}
+
+// Notifier sends notification emails.
+type Notifier struct {
+	settings      Settings
+	tlsConfig     *tls.Config
+	subject       *template.Template
+	body          *template.Template
+	digestSubject *template.Template
+	digestBody    *template.Template
+	sleep         func(time.Duration)
+}
+
+// New checks the settings and prepares their templates.
+func New(s Settings) (*Notifier, error) {
+	if s.Host == "" {
+		return nil, errors.New("notifications host is required")
+	}
+
+	switch s.Security {
+	case "", SecuritySTARTTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("unknown notifications security %v, expected one of: starttls, tls, none", s.Security)
+	}
+
+	switch s.Mode {
+	case "", ModeEach, ModeDigest:
+	default:
+		return nil, fmt.Errorf("unknown notifications mode %v, expected one of: each, digest", s.Mode)
+	}
+
+	_, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications from address %q: %v", s.From, err)
+	}
+
+	err = CheckRecipients(s.Recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Retries != nil && *s.Retries < 0 {
+		return nil, fmt.Errorf("notifications retries can't be negative, got %v", *s.Retries)
+	}
+
+	if s.Password == "" {
+		s.Password = os.Getenv(smtpPasswordEnv)
+	}
+
+	n := &Notifier{
+		settings:  s,
+		tlsConfig: &tls.Config{ServerName: s.Host},
+		sleep:     time.Sleep,
+	}
+
+	if s.RootCAPath != "" {
+		pem, err := os.ReadFile(s.RootCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read notifications root_ca_path: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", s.RootCAPath)
+		}
+		n.tlsConfig.RootCAs = pool
+	}
+
+	templates := []struct {
+		t        **template.Template
+		name     string
+		tmpl     string
+		fallback string
+	}{
+		{&n.subject, "subject", s.Subject, defaultSubject},
+		{&n.body, "body", s.Body, defaultBody},
+		{&n.digestSubject, "digest_subject", s.DigestSubject, defaultDigestSubject},
+		{&n.digestBody, "digest_body", s.DigestBody, defaultDigestBody},
+	}
+
+	for _, t := range templates {
+		tmpl := t.tmpl
+		if tmpl == "" {
+			tmpl = t.fallback
+		}
+
+		*t.t, err = template.New(t.name).Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse notifications %v template: %v", t.name, err)
+		}
+	}
+
+	return n, nil
+}
+
+// CheckRecipients returns an error if any of the addresses is invalid.
+func CheckRecipients(recipients []string) error {
+	for _, r := range recipients {
+		_, err := mail.ParseAddress(r)
+		if err != nil {
+			return fmt.Errorf("invalid notification recipient %q: %v", r, err)
+		}
+	}
+
+	return nil
+}
+
+// Digest returns whether videos should be collected and sent together with NotifyDigest.
+func (n *Notifier) Digest() bool {
+	return n.settings.Mode == ModeDigest
+}
+
+// Recipients returns who is notified about videos, classRecipients if there are any, otherwise the configured
+// recipients.
+func (n *Notifier) Recipients(classRecipients []string) []string {
+	if len(classRecipients) > 0 {
+		return classRecipients
+	}
+
+	return n.settings.Recipients
+}
+
+// Notify emails recipients about the uploaded video. It returns how many times sending was tried.
+func (n *Notifier) Notify(recipients []string, u Upload) (int, error) {
+	subject, body, err := render(n.subject, n.body, u)
+	if err != nil {
+		return 0, err
+	}
+
+	return n.send(recipients, subject, body)
+}
+
+// NotifyDigest emails recipients one message about all the uploaded videos. It returns how many times sending was
+// tried.
+func (n *Notifier) NotifyDigest(recipients []string, uploads []Upload) (int, error) {
+	subject, body, err := render(n.digestSubject, n.digestBody, digest{Uploads: uploads})
+	if err != nil {
+		return 0, err
+	}
+
+	return n.send(recipients, subject, body)
+}
+
+func render(subjectTmpl, bodyTmpl *template.Template, data interface{}) (string, string, error) {
+	var subject, body strings.Builder
+	err := subjectTmpl.Execute(&subject, data)
+	if err != nil {
+		return "", "", fmt.Errorf("could not apply notification subject template: %v", err)
+	}
+
+	err = bodyTmpl.Execute(&body, data)
+	if err != nil {
+		return "", "", fmt.Errorf("could not apply notification body template: %v", err)
+	}
+
+	// a subject is one line.
+	return strings.Join(strings.Fields(subject.String()), " "), body.String(), nil
+}
+
+// send sends the email, retrying failures that might be temporary. It returns how many times sending was tried.
+func (n *Notifier) send(recipients []string, subject, body string) (int, error) {
+	if len(recipients) == 0 {
+		return 0, errors.New("no notification recipients configured")
+	}
+
+	msg := message(n.settings.From, recipients, subject, body, time.Now())
+
+	delay := n.settings.RetryDelay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	retries := defaultRetries
+	if n.settings.Retries != nil {
+		retries = *n.settings.Retries
+	}
+
+	var err error
+	attempts := 0
+	for attempts <= retries {
+		if attempts > 0 {
+			n.sleep(delay)
+			delay *= 2
+		}
+
+		attempts++
+		err = n.sendMail(recipients, msg)
+		if err == nil || permanent(err) {
+			break
+		}
+	}
+
+	return attempts, err
+}
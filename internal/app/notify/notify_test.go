@@ -0,0 +1,338 @@
+package notify_test
+
+import (
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/notify"
+)
+
+var testUpload = notify.Upload{
+	Name:     "Tap Week 3",
+	Class:    "Tap",
+	Term:     "2023 Spring",
+	Week:     3,
+	VideoURI: "https://vimeo.com/123",
+	Password: "spied_ferry_gray_jaws",
+}
+
+// testSettings returns settings for sending to the fake server.
+func testSettings(t *testing.T, f *fakeSMTP, security string) notify.Settings {
+	return notify.Settings{
+		Host:       "127.0.0.1",
+		Port:       f.port(t),
+		Security:   security,
+		RootCAPath: f.caPath,
+		From:       "Dance School <videos@example.com>",
+		Recipients: []string{"teacher@example.com"},
+		RetryDelay: time.Millisecond,
+	}
+}
+
+// parseMessage returns the decoded subject and body of a received message.
+func parseMessage(t *testing.T, data string) (string, string) {
+	t.Helper()
+
+	m, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("could not parse message: %v\n%v", err, data)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Header.Get("Content-Transfer-Encoding") != "quoted-printable" {
+		t.Errorf("Content-Transfer-Encoding = %q", m.Header.Get("Content-Transfer-Encoding"))
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return subject, strings.ReplaceAll(string(body), "\r\n", "\n")
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	tests := []struct {
+		name        string
+		implicitTLS bool
+		security    string
+		username    string
+		wantTLS     bool
+	}{
+		{name: "STARTTLS by default", wantTLS: true},
+		{name: "STARTTLS with auth", security: notify.SecuritySTARTTLS, username: "videos", wantTLS: true},
+		{name: "implicit TLS with auth", implicitTLS: true, security: notify.SecurityTLS, username: "videos", wantTLS: true},
+		{name: "unencrypted", security: notify.SecurityNone},
+		// net/smtp allows sending a password unencrypted to localhost only.
+		{name: "unencrypted with auth to localhost", security: notify.SecurityNone, username: "videos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSMTP(t, fakeSMTPOptions{implicitTLS: tt.implicitTLS, username: tt.username, password: "hunter2"})
+
+			s := testSettings(t, f, tt.security)
+			s.Username, s.Password = tt.username, "hunter2"
+			n, err := notify.New(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attempts, err := n.Notify([]string{"Teacher <teacher@example.com>", "office@example.com"}, testUpload)
+			if err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			if attempts != 1 {
+				t.Errorf("Notify() attempts = %v, want 1", attempts)
+			}
+
+			got := f.received()
+			if len(got) != 1 {
+				t.Fatalf("server received %v messages, want 1", len(got))
+			}
+
+			m := got[0]
+			if m.from != "videos@example.com" || strings.Join(m.to, ",") != "teacher@example.com,office@example.com" {
+				t.Errorf("message sent from %v to %v", m.from, m.to)
+			}
+
+			if m.tls != tt.wantTLS || m.auth != (tt.username != "") {
+				t.Errorf("message sent with TLS %v and auth %v", m.tls, m.auth)
+			}
+
+			subject, body := parseMessage(t, m.data)
+			if subject != "New video: Tap Week 3" {
+				t.Errorf("subject = %q", subject)
+			}
+
+			wantBody := "Tap Week 3 has been uploaded.\n\nLink: https://vimeo.com/123\nPassword: spied_ferry_gray_jaws\n"
+			if body != wantBody {
+				t.Errorf("body = %q, want %q", body, wantBody)
+			}
+		})
+	}
+}
+
+func TestNotifier_Notify_templates(t *testing.T) {
+	f := newFakeSMTP(t, fakeSMTPOptions{})
+	s := testSettings(t, f, "")
+	s.Subject = "{{.Class}} week {{.Week}} ({{.Term}}) – new video"
+	s.Body = "Watch {{.Name}} at {{.VideoURI}} with {{.Password}}\n"
+
+	n, err := notify.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = n.Notify(n.Recipients(nil), testUpload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, body := parseMessage(t, f.received()[0].data)
+	if subject != "Tap week 3 (2023 Spring) – new video" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	if body != "Watch Tap Week 3 at https://vimeo.com/123 with spied_ferry_gray_jaws\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestNotifier_NotifyDigest(t *testing.T) {
+	f := newFakeSMTP(t, fakeSMTPOptions{})
+	s := testSettings(t, f, "")
+	s.Mode = notify.ModeDigest
+
+	n, err := notify.New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !n.Digest() {
+		t.Error("Digest() = false in digest mode")
+	}
+
+	second := notify.Upload{Name: "Tap Week 4", VideoURI: "https://vimeo.com/456"}
+	_, err = n.NotifyDigest(n.Recipients([]string{"tap@example.com"}), []notify.Upload{testUpload, second})
+	if err != nil {
+		t.Fatalf("NotifyDigest() error = %v", err)
+	}
+
+	got := f.received()
+	if len(got) != 1 || strings.Join(got[0].to, ",") != "tap@example.com" {
+		t.Fatalf("server received %+v, want one message to the class's recipients", got)
+	}
+
+	subject, body := parseMessage(t, got[0].data)
+	if subject != "2 new videos" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	wantBody := "Tap Week 3\nLink: https://vimeo.com/123\nPassword: spied_ferry_gray_jaws\n\nTap Week 4\nLink: https://vimeo.com/456\n\n"
+	if body != wantBody {
+		t.Errorf("body = %q, want %q", body, wantBody)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestNotifier_Notify_retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      *int
+		rcptReplies  []string
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "temporary failures are retried",
+			rcptReplies:  []string{"451 try again later", "421 busy"},
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after the retries",
+			retries:      intPtr(1),
+			rcptReplies:  []string{"451 try again later", "451 try again later"},
+			wantAttempts: 2,
+			wantErr:      true,
+		},
+		{
+			name:         "retries turned off",
+			retries:      intPtr(0),
+			rcptReplies:  []string{"451 try again later"},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "permanent failures aren't retried",
+			rcptReplies:  []string{"550 no such user"},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSMTP(t, fakeSMTPOptions{rcptReplies: tt.rcptReplies})
+
+			s := testSettings(t, f, "")
+			s.Retries = tt.retries
+			n, err := notify.New(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			attempts, err := n.Notify(n.Recipients(nil), testUpload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("Notify() attempts = %v, want %v", attempts, tt.wantAttempts)
+			}
+
+			if wantSent := !tt.wantErr; (len(f.received()) == 1) != wantSent {
+				t.Errorf("server received %v messages", len(f.received()))
+			}
+		})
+	}
+}
+
+func TestNotifier_Notify_failures(t *testing.T) {
+	tests := []struct {
+		name    string
+		options fakeSMTPOptions
+		change  func(s *notify.Settings)
+	}{
+		{
+			name:    "STARTTLS not supported",
+			options: fakeSMTPOptions{noSTARTTLS: true},
+		},
+		{
+			name:    "wrong password",
+			options: fakeSMTPOptions{username: "videos", password: "hunter2"},
+			change: func(s *notify.Settings) {
+				s.Username, s.Password = "videos", "hunter3"
+			},
+		},
+		{
+			name: "untrusted certificate",
+			change: func(s *notify.Settings) {
+				s.RootCAPath = ""
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeSMTP(t, tt.options)
+			s := testSettings(t, f, "")
+			s.Retries = intPtr(1)
+			if tt.change != nil {
+				tt.change(&s)
+			}
+
+			n, err := notify.New(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = n.Notify(n.Recipients(nil), testUpload)
+			if err == nil {
+				t.Fatal("Notify() succeeded")
+			}
+
+			if len(f.received()) != 0 {
+				t.Errorf("server received %v messages", len(f.received()))
+			}
+		})
+	}
+}
+
+func TestNew_errors(t *testing.T) {
+	valid := notify.Settings{Host: "smtp.example.com", From: "videos@example.com", Recipients: []string{"teacher@example.com"}}
+
+	tests := []struct {
+		name   string
+		change func(s *notify.Settings)
+	}{
+		{name: "no host", change: func(s *notify.Settings) { s.Host = "" }},
+		{name: "unknown security", change: func(s *notify.Settings) { s.Security = "ssl" }},
+		{name: "unknown mode", change: func(s *notify.Settings) { s.Mode = "weekly" }},
+		{name: "invalid from", change: func(s *notify.Settings) { s.From = "videos" }},
+		{name: "invalid recipient", change: func(s *notify.Settings) { s.Recipients = []string{"teacher@example.com", "office"} }},
+		{name: "negative retries", change: func(s *notify.Settings) { s.Retries = intPtr(-1) }},
+		{name: "invalid template", change: func(s *notify.Settings) { s.Body = "{{.Name" }},
+		{name: "missing root CA file", change: func(s *notify.Settings) { s.RootCAPath = "does-not-exist.pem" }},
+	}
+
+	_, err := notify.New(valid)
+	if err != nil {
+		t.Fatalf("New() error = %v for valid settings", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.change(&s)
+
+			_, err := notify.New(s)
+			if err == nil {
+				t.Error("New() succeeded")
+			}
+		})
+	}
+}
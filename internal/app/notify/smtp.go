@@ -0,0 +1,200 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sendMail delivers msg to the recipients in one SMTP session.
+func (n *Notifier) sendMail(recipients []string, msg []byte) error {
+	s := n.settings
+	port := s.Port
+	if port == 0 {
+		port = 587
+		if s.Security == SecurityTLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(port))
+
+	dialer := &net.Dialer{Timeout: sessionTimeout}
+	var conn net.Conn
+	var err error
+	if s.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, n.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("could not connect to %v: %v", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(sessionTimeout))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("could not start SMTP session with %v: %v", addr, err)
+	}
+	defer c.Close()
+
+	if s.Security == "" || s.Security == SecuritySTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return permanentError{fmt.Errorf("%v doesn't support STARTTLS", addr)}
+		}
+
+		err = c.StartTLS(n.tlsConfig)
+		if err != nil {
+			return describe(err, "could not start TLS with %v", addr)
+		}
+	}
+
+	if s.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted connection to anything but localhost.
+		err = c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host))
+		if err != nil {
+			var tpErr *textproto.Error
+			if !errors.As(err, &tpErr) {
+				// the server didn't reply, so the settings are the problem.
+				return permanentError{fmt.Errorf("could not log in to %v: %v", addr, err)}
+			}
+
+			return describe(err, "could not log in to %v", addr)
+		}
+	}
+
+	err = c.Mail(address(s.From))
+	if err != nil {
+		return describe(err, "%v rejected sender %v", addr, s.From)
+	}
+
+	for _, r := range recipients {
+		err = c.Rcpt(address(r))
+		if err != nil {
+			return describe(err, "%v rejected recipient %v", addr, r)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return describe(err, "could not send message to %v", addr)
+	}
+
+	_, err = w.Write(msg)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return describe(err, "could not send message to %v", addr)
+	}
+
+	// the message was accepted, so a failed QUIT doesn't matter.
+	c.Quit()
+	return nil
+}
+
+// permanentError is a failure that retrying won't fix.
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p permanentError) Unwrap() error {
+	return p.err
+}
+
+// permanent returns whether err won't go away by retrying.
+func permanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// describe adds what failed to err. A 5xx reply from the server means it rejected the request for good, so the error
+// is permanent; other replies and connection errors may be temporary.
+func describe(err error, format string, args ...interface{}) error {
+	described := fmt.Errorf("%v: %v", fmt.Sprintf(format, args...), err)
+
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return permanentError{described}
+	}
+
+	return described
+}
+
+// address returns the email address without the display name, ex. videos@example.com for
+// "Videos <videos@example.com>". New already checked that it parses.
+func address(a string) string {
+	parsed, err := mail.ParseAddress(a)
+	if err != nil {
+		return a
+	}
+
+	return parsed.Address
+}
+
+// message formats a plain text email. The subject is encoded if it isn't ASCII and the body is quoted-printable, so
+// both can hold any text.
+func message(from string, to []string, subject, body string, date time.Time) []byte {
+	var b bytes.Buffer
+	header := func(k, v string) {
+		fmt.Fprintf(&b, "%v: %v\r\n", k, v)
+	}
+
+	header("From", formatAddress(from))
+	var recipients []string
+	for _, r := range to {
+		recipients = append(recipients, formatAddress(r))
+	}
+	header("To", strings.Join(recipients, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	b.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n")))
+	qp.Close()
+
+	return b.Bytes()
+}
+
+// formatAddress returns the address for a header, with any display name encoded.
+func formatAddress(a string) string {
+	parsed, err := mail.ParseAddress(a)
+	if err != nil {
+		return a
+	}
+
+	return parsed.String()
+}
+
+// messageID returns a unique Message-ID at the sender's domain.
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(address(from), "@"); i >= 0 {
+		domain = address(from)[i+1:]
+	}
+
+	r := make([]byte, 16)
+	rand.Read(r)
+	return fmt.Sprintf("<%v@%v>", hex.EncodeToString(r), domain)
+}
@@ -0,0 +1,227 @@
+package notify_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPOptions change how the fake server behaves.
+type fakeSMTPOptions struct {
+	// implicitTLS serves TLS from the start instead of offering STARTTLS.
+	implicitTLS bool
+	// noSTARTTLS leaves STARTTLS out of the extensions.
+	noSTARTTLS bool
+	username   string
+	password   string
+	// rcptReplies are replied to RCPT commands instead of accepting them, one per session until they run out.
+	rcptReplies []string
+}
+
+// fakeSMTP is an in-process SMTP server that records the messages it accepts.
+type fakeSMTP struct {
+	fakeSMTPOptions
+	addr string
+	// caPath is a PEM file with the server's certificate, for RootCAPath.
+	caPath    string
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	sessions int
+	messages []receivedMessage
+}
+
+type receivedMessage struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth bool
+}
+
+func newFakeSMTP(t *testing.T, o fakeSMTPOptions) *fakeSMTP {
+	t.Helper()
+
+	cert, caPath := newTestCertificate(t)
+	f := &fakeSMTP{
+		fakeSMTPOptions: o,
+		caPath:          caPath,
+		tlsConfig:       &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	var l net.Listener
+	var err error
+	if o.implicitTLS {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", f.tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	f.addr = l.Addr().String()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	return f
+}
+
+// port returns the port the server listens on.
+func (f *fakeSMTP) port(t *testing.T) int {
+	_, p, _ := net.SplitHostPort(f.addr)
+	var port int
+	_, err := fmt.Sscan(p, &port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return port
+}
+
+func (f *fakeSMTP) received() []receivedMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]receivedMessage{}, f.messages...)
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	f.mu.Lock()
+	var rcptReply string
+	if f.sessions < len(f.rcptReplies) {
+		rcptReply = f.rcptReplies[f.sessions]
+	}
+	f.sessions++
+	f.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	isTLS := f.implicitTLS
+	authed := false
+	var msg receivedMessage
+
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			ext := []string{"250-fake"}
+			if !isTLS && !f.noSTARTTLS {
+				ext = append(ext, "250-STARTTLS")
+			}
+			tp.PrintfLine("%v\r\n250 AUTH PLAIN", strings.Join(ext, "\r\n"))
+		case "STARTTLS":
+			tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, f.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(creds) != "\x00"+f.username+"\x00"+f.password {
+				tp.PrintfLine("535 authentication failed")
+				continue
+			}
+			authed = true
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			msg = receivedMessage{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>"), tls: isTLS, auth: authed}
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if rcptReply != "" {
+				tp.PrintfLine(rcptReply)
+				continue
+			}
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			f.mu.Lock()
+			f.messages = append(f.messages, msg)
+			f.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "RSET", "NOOP":
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1 and the path of a PEM file holding it.
+func newTestCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, path
+}
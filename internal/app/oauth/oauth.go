@@ -0,0 +1,284 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FlowAuthorizationCode = "authorization_code"
+	FlowClientCredentials = "client_credentials"
+	FlowPassword          = "password"
+)
+
+// Config describes an OAuth2 provider and the client registered with it.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	// ClientCredentialsURL is used for the client credentials grant if the provider has a separate endpoint for it.
+	// Defaults to TokenURL.
+	ClientCredentialsURL string
+	Scopes               []string
+	// RedirectPort is the loopback port the authorization code flow listens on. It must match the redirect URI
+	// registered with the provider, ex. http://127.0.0.1:8085/callback.
+	RedirectPort int
+	// AuthParams are extra query parameters added to the authorization URL, ex. access_type=offline.
+	AuthParams map[string]string
+	// CredentialsInBody sends the client ID and secret as form values instead of with HTTP basic auth.
+	CredentialsInBody bool
+}
+
+// Token is an OAuth2 access token and what's needed to refresh it.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+}
+
+// Valid returns whether the token has an access token that isn't about to expire. Tokens without an expiry are
+// valid until the provider rejects them.
+func (t Token) Valid() bool {
+	if t.AccessToken == "" {
+		return false
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(time.Minute).Before(t.Expiry)
+}
+
+// tokenResponse contains the fields returned from a token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope"`
+}
+
+type httpCaller interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// RedirectURI returns the loopback redirect URI used by the authorization code flow.
+func (c Config) RedirectURI() string {
+	return fmt.Sprintf("http://127.0.0.1:%v/callback", c.RedirectPort)
+}
+
+// AuthCodeURL returns the URL a user opens to grant access.
+func (c Config) AuthCodeURL(state string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", c.RedirectURI())
+	q.Set("state", state)
+	if len(c.Scopes) > 0 {
+		q.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	for k, v := range c.AuthParams {
+		q.Set(k, v)
+	}
+
+	sep := "?"
+	if strings.Contains(c.AuthURL, "?") {
+		sep = "&"
+	}
+
+	return c.AuthURL + sep + q.Encode()
+}
+
+// AuthorizeCode runs the authorization code flow. It listens on the loopback redirect URI, passes the authorization
+// URL to prompt so the user can open it, waits up to timeout for the provider's redirect, and exchanges the code.
+func AuthorizeCode(c httpCaller, conf Config, prompt func(authURL string), timeout time.Duration) (Token, error) {
+	state, err := randomState()
+	if err != nil {
+		return Token{}, err
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", conf.RedirectPort))
+	if err != nil {
+		return Token{}, fmt.Errorf("could not listen for the authorization redirect on port %v: %v", conf.RedirectPort, err)
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	var once sync.Once
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/callback" {
+				http.NotFound(w, r)
+				return
+			}
+
+			q := r.URL.Query()
+			res := result{code: q.Get("code")}
+			switch {
+			case q.Get("state") != state:
+				res.err = errors.New("authorization redirect had an unexpected state, try logging in again")
+			case q.Get("error") != "":
+				res.err = fmt.Errorf("authorization was denied: %v %v", q.Get("error"), q.Get("error_description"))
+			case res.code == "":
+				res.err = errors.New("authorization redirect did not include a code")
+			}
+
+			if res.err != nil {
+				http.Error(w, res.err.Error(), http.StatusBadRequest)
+			} else {
+				fmt.Fprintln(w, "Authorization complete, you can close this window.")
+			}
+
+			once.Do(func() { results <- res })
+		}),
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	prompt(conf.AuthCodeURL(state))
+
+	var res result
+	select {
+	case res = <-results:
+	case <-time.After(timeout):
+		return Token{}, errors.New("timed out waiting for authorization")
+	}
+
+	if res.err != nil {
+		return Token{}, res.err
+	}
+
+	return requestToken(c, conf, conf.TokenURL, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {res.code},
+		"redirect_uri": {conf.RedirectURI()},
+	})
+}
+
+// ClientCredentials gets a token for the client itself rather than a user.
+func ClientCredentials(c httpCaller, conf Config) (Token, error) {
+	tokenURL := conf.ClientCredentialsURL
+	if tokenURL == "" {
+		tokenURL = conf.TokenURL
+	}
+
+	v := url.Values{"grant_type": {"client_credentials"}}
+	if len(conf.Scopes) > 0 {
+		v.Set("scope", strings.Join(conf.Scopes, " "))
+	}
+
+	return requestToken(c, conf, tokenURL, v)
+}
+
+// Password gets a token for a user with the resource owner password grant.
+func Password(c httpCaller, conf Config, username, password string) (Token, error) {
+	v := url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	}
+	if len(conf.Scopes) > 0 {
+		v.Set("scope", strings.Join(conf.Scopes, " "))
+	}
+
+	return requestToken(c, conf, conf.TokenURL, v)
+}
+
+// Refresh exchanges a refresh token for a new access token. If the provider doesn't return a new refresh token,
+// the given one is kept.
+func Refresh(c httpCaller, conf Config, refreshToken string) (Token, error) {
+	t, err := requestToken(c, conf, conf.TokenURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+
+	return t, nil
+}
+
+// requestToken posts a form-encoded grant to a token endpoint, authenticating with the client ID and secret.
+func requestToken(c httpCaller, conf Config, tokenURL string, v url.Values) (Token, error) {
+	if conf.CredentialsInBody {
+		v.Set("client_id", conf.ClientID)
+		v.Set("client_secret", conf.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("error creating token request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+	if !conf.CredentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("error requesting token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("could not read token response bytes: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("token request received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+	}
+
+	var tResp tokenResponse
+	err = json.Unmarshal(respBytes, &tResp)
+	if err != nil {
+		return Token{}, fmt.Errorf("could not unmarshal token response: %v", err)
+	}
+
+	if tResp.AccessToken == "" {
+		return Token{}, errors.New("token response did not include an access token")
+	}
+
+	t := Token{
+		AccessToken:  tResp.AccessToken,
+		TokenType:    tResp.TokenType,
+		RefreshToken: tResp.RefreshToken,
+		Scope:        tResp.Scope,
+	}
+	if tResp.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(tResp.ExpiresIn) * time.Second)
+	}
+
+	return t, nil
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("could not generate authorization state: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,208 @@
+package oauth_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// fakeProvider is a token endpoint that records the grants it receives.
+type fakeProvider struct {
+	grants []url.Values
+	issued int
+}
+
+func (f *fakeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.grants = append(f.grants, r.PostForm)
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "client" || secret != "secret" {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	f.issued++
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  fmt.Sprintf("access-%v", f.issued),
+		"refresh_token": "refresh",
+		"token_type":    "bearer",
+		"expires_in":    3600,
+	})
+}
+
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestAuthorizeCode(t *testing.T) {
+	provider := &fakeProvider{}
+	srv := httptest.NewServer(provider)
+	defer srv.Close()
+
+	conf := oauth.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		AuthURL:      "https://provider.test/authorize",
+		TokenURL:     srv.URL + "/token",
+		Scopes:       []string{"public", "upload"},
+		RedirectPort: freePort(t),
+	}
+
+	// stand in for the browser: follow the auth URL's redirect_uri with a code and the given state.
+	prompt := func(authURL string) {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		q := u.Query()
+		if q.Get("scope") != "public upload" || q.Get("client_id") != "client" {
+			t.Errorf("AuthorizeCode() auth URL query = %v", q)
+		}
+
+		go func() {
+			resp, err := http.Get(q.Get("redirect_uri") + "?code=the-code&state=" + q.Get("state"))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+
+	tok, err := oauth.AuthorizeCode(http.DefaultClient, conf, prompt, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok.AccessToken != "access-1" || tok.RefreshToken != "refresh" || !tok.Valid() {
+		t.Errorf("AuthorizeCode() token = %+v", tok)
+	}
+
+	want := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {"the-code"},
+		"redirect_uri": {conf.RedirectURI()},
+	}
+	if diff := cmp.Diff(want, provider.grants[0]); diff != "" {
+		t.Errorf("AuthorizeCode() grant mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuthorizeCode_wrongState(t *testing.T) {
+	conf := oauth.Config{
+		ClientID:     "client",
+		AuthURL:      "https://provider.test/authorize",
+		TokenURL:     "https://provider.test/token",
+		RedirectPort: freePort(t),
+	}
+
+	prompt := func(authURL string) {
+		go func() {
+			resp, err := http.Get(conf.RedirectURI() + "?code=the-code&state=forged")
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+
+	_, err := oauth.AuthorizeCode(http.DefaultClient, conf, prompt, time.Second*5)
+	if err == nil {
+		t.Error("AuthorizeCode() expected an error for a mismatched state")
+	}
+}
+
+func TestSource_Renew(t *testing.T) {
+	provider := &fakeProvider{}
+	srv := httptest.NewServer(provider)
+	defer srv.Close()
+
+	conf := oauth.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL + "/token",
+	}
+
+	tests := []struct {
+		name      string
+		flow      string
+		saved     oauth.Token
+		wantGrant string
+		wantErr   bool
+	}{
+		{
+			name:      "refresh token is used when one is saved",
+			flow:      oauth.FlowAuthorizationCode,
+			saved:     oauth.Token{AccessToken: "old", RefreshToken: "refresh"},
+			wantGrant: "refresh_token",
+		},
+		{
+			name:      "client credentials are requested again",
+			flow:      oauth.FlowClientCredentials,
+			saved:     oauth.Token{AccessToken: "old"},
+			wantGrant: "client_credentials",
+		},
+		{
+			name:    "authorization code token without refresh token needs login",
+			flow:    oauth.FlowAuthorizationCode,
+			saved:   oauth.Token{AccessToken: "old"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.grants = nil
+			store := oauth.NewFileStore(filepath.Join(t.TempDir(), "token.json"))
+			err := store.Save(tt.saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			src := oauth.NewSource(http.DefaultClient, conf, tt.flow, store, "log in again")
+
+			got, err := src.Token()
+			if err != nil || got != "old" {
+				t.Fatalf("Source.Token() = %v, %v, want saved token", got, err)
+			}
+
+			err = src.Renew()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Source.Renew() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(provider.grants) != 1 || provider.grants[0].Get("grant_type") != tt.wantGrant {
+				t.Errorf("Source.Renew() grants = %v, want one %v grant", provider.grants, tt.wantGrant)
+			}
+
+			saved, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			renewed, err := src.Token()
+			if err != nil || renewed == "old" || renewed != saved.AccessToken {
+				t.Errorf("Source.Token() after renew = %v, %v, saved %v", renewed, err, saved.AccessToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TokenSource provides access tokens to API clients.
+type TokenSource interface {
+	// Token returns a valid access token.
+	Token() (string, error)
+	// Renew is called when the provider rejects the current token (ex. a 401) and gets a new one if possible.
+	Renew() error
+}
+
+// StaticSource is a long-lived token such as a personal access token that can't be renewed.
+type StaticSource string
+
+func (s StaticSource) Token() (string, error) {
+	if s == "" {
+		return "", errors.New("no access token configured")
+	}
+
+	return string(s), nil
+}
+
+func (s StaticSource) Renew() error {
+	return errors.New("access token was rejected, check that it's valid and has the required scopes")
+}
+
+// Source is a TokenSource backed by a FileStore. Expired or rejected tokens are refreshed with their refresh token,
+// or for the client credentials and password flows, requested again. Updated tokens are saved back to the store.
+type Source struct {
+	client httpCaller
+	conf   Config
+	flow   string
+	store  FileStore
+	// loginHint is added to errors that can only be fixed by logging in again.
+	loginHint string
+	// username and password are used to request new tokens for the password flow.
+	username string
+	password string
+
+	mu    sync.Mutex
+	token Token
+}
+
+// NewSource creates a Source for the given flow, one of the Flow constants. loginHint tells users how to log in
+// again when a token can't be renewed automatically, ex. "run the login command".
+func NewSource(c httpCaller, conf Config, flow string, store FileStore, loginHint string) *Source {
+	return &Source{
+		client:    c,
+		conf:      conf,
+		flow:      flow,
+		store:     store,
+		loginHint: loginHint,
+	}
+}
+
+func (s *Source) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.AccessToken == "" {
+		t, err := s.store.Load()
+		if err != nil {
+			return "", err
+		}
+		s.token = t
+	}
+
+	if s.token.Valid() {
+		return s.token.AccessToken, nil
+	}
+
+	err := s.renew()
+	if err != nil {
+		return "", err
+	}
+
+	return s.token.AccessToken, nil
+}
+
+func (s *Source) Renew() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.renew()
+}
+
+// renew gets a new token and saves it. s.mu must be held.
+func (s *Source) renew() error {
+	var t Token
+	var err error
+
+	switch {
+	case s.token.RefreshToken != "":
+		t, err = Refresh(s.client, s.conf, s.token.RefreshToken)
+	case s.flow == FlowClientCredentials:
+		t, err = ClientCredentials(s.client, s.conf)
+	case s.flow == FlowPassword && s.username != "":
+		t, err = Password(s.client, s.conf, s.username, s.password)
+	case s.token.AccessToken == "":
+		return fmt.Errorf("not logged in, %v", s.loginHint)
+	default:
+		return fmt.Errorf("access token was rejected and can't be refreshed, %v", s.loginHint)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not renew access token: %v", err)
+	}
+
+	s.token = t
+
+	err = s.store.Save(t)
+	if err != nil {
+		fmt.Printf("WARN: renewed access token but could not save it: %v\n", err)
+	}
+
+	return nil
+}
+
+// SetPassword sets the credentials the password flow uses to get new tokens.
+func (s *Source) SetPassword(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.username = username
+	s.password = password
+}
+
+// SetToken replaces the current token and saves it, ex. after logging in.
+func (s *Source) SetToken(t Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = t
+	return s.store.Save(t)
+}
@@ -0,0 +1,81 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore saves a token to a JSON file that only the current user can read.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a FileStore that saves to path, creating its folder when a token is saved.
+func NewFileStore(path string) FileStore {
+	return FileStore{path: path}
+}
+
+// Load reads the saved token. An empty token is returned if nothing has been saved yet.
+func (s FileStore) Load() (Token, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Token{}, nil
+	}
+	if err != nil {
+		return Token{}, fmt.Errorf("could not read token file: %v", err)
+	}
+
+	var t Token
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return Token{}, fmt.Errorf("could not unmarshal token file %v: %v", s.path, err)
+	}
+
+	return t, nil
+}
+
+// Save writes the token to a temporary file and renames it over the old one so a partial write never replaces a
+// working token.
+func (s FileStore) Save(t Token) error {
+	err := os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("could not create token folder: %v", err)
+	}
+
+	b, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("could not marshal token: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".token-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary token file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp already uses 0600, but be explicit since the file holds a credential.
+	err = tmp.Chmod(0600)
+	if err == nil {
+		_, err = tmp.Write(b)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write token file: %v", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("could not save token file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package oauth_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+func TestFileStore_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens", "token.json")
+	store := oauth.NewFileStore(path)
+
+	empty, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if empty.AccessToken != "" {
+		t.Fatalf("FileStore.Load() expected empty token before saving, got %+v", empty)
+	}
+
+	want := oauth.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	err = store.Save(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FileStore.Load() mismatch (-want +got):\n%s", diff)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("FileStore.Save() file permissions = %v, want 0600", info.Mode().Perm())
+	}
+}
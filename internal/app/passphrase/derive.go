@@ -0,0 +1,67 @@
+package passphrase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+const (
+	// subkeyLabel derives the HMAC key passphrases are made with from the given key, so a key that's also used for
+	// something else, ex. encrypting saved passwords, isn't used directly as an HMAC key too.
+	subkeyLabel = "video-uploader passphrase-derive"
+	// deriveLabel is mixed into every derived block so the key can't be used to derive anything else by accident. It
+	// has a version in case derivation needs to change, which would change every derived passphrase.
+	deriveLabel = "video-uploader passphrase v1"
+)
+
+// Derive returns the passphrase for scope, ex. a class and term that share a password. It's generated like Generate,
+// but the randomness comes from HMAC-SHA256 of the scope with key, so the same key, scope, and options always give
+// the same passphrase and it doesn't need to be saved. The entropy is the same as a random passphrase's as long as the
+// key is secret. The HMAC key is a subkey derived from key rather than key itself.
+func (o Options) Derive(key []byte, scope string) (Passphrase, error) {
+	if len(key) == 0 {
+		return Passphrase{}, errors.New("a key is needed to derive passphrases")
+	}
+
+	return o.generate(&hmacStream{mac: hmac.New(sha256.New, subkey(key)), scope: scope})
+}
+
+// subkey returns HMAC-SHA256(key, subkeyLabel).
+func subkey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(subkeyLabel))
+	return mac.Sum(nil)
+}
+
+// hmacStream reads the blocks HMAC(key, label, scope, counter) for counter 0, 1, 2... one after another.
+type hmacStream struct {
+	mac     hash.Hash
+	scope   string
+	counter uint32
+	buf     []byte
+}
+
+func (s *hmacStream) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.buf) == 0 {
+			s.mac.Reset()
+			s.mac.Write([]byte(deriveLabel))
+			s.mac.Write([]byte{0})
+			s.mac.Write([]byte(s.scope))
+			s.mac.Write([]byte{0})
+			s.mac.Write(binary.BigEndian.AppendUint32(nil, s.counter))
+			s.buf = s.mac.Sum(nil)
+			s.counter++
+		}
+
+		c := copy(p[n:], s.buf)
+		s.buf = s.buf[c:]
+		n += c
+	}
+
+	return n, nil
+}
@@ -0,0 +1,105 @@
+package passphrase_test
+
+import (
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+)
+
+var deriveKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestOptions_Derive(t *testing.T) {
+	// derived passphrases are never saved, so changing how they're made would change the passwords of videos that
+	// were already uploaded.
+	tests := []struct {
+		name    string
+		options passphrase.Options
+		want    string
+	}{
+		{
+			name: "words",
+			want: "punk_rail_wreck_sift",
+		},
+		{
+			name:    "pronounceable",
+			options: passphrase.Options{Mode: passphrase.Pronounceable},
+			want:    "pimumo_gahepe_jopaju",
+		},
+		{
+			name:    "PIN",
+			options: passphrase.Options{Mode: passphrase.PIN},
+			want:    "243511",
+		},
+		{
+			name:    "random capitalization, digit, and symbol",
+			options: passphrase.Options{Capitalization: passphrase.Random, Digit: true, Symbol: true},
+			want:    "Punk_Rail8_wreck*_sift",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 3; i++ {
+				got, err := tt.options.Derive(deriveKey, "Tap\x002023 Spring")
+				if err != nil {
+					t.Fatalf("Derive() error = %v", err)
+				}
+
+				if got.Text != tt.want {
+					t.Errorf("Derive() = %q, want %q", got.Text, tt.want)
+				}
+
+				if got.Description != tt.options.Describe() {
+					t.Errorf("Derive() description = %q, want %q", got.Description, tt.options.Describe())
+				}
+			}
+		})
+	}
+}
+
+func TestOptions_Derive_differs(t *testing.T) {
+	o := passphrase.Options{Words: 6}
+	base, err := o.Derive(deriveKey, "Tap\x002023 Spring\x003")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey := append([]byte{}, deriveKey...)
+	otherKey[0] ^= 1
+
+	tests := []struct {
+		name  string
+		key   []byte
+		scope string
+	}{
+		{name: "other week", key: deriveKey, scope: "Tap\x002023 Spring\x004"},
+		{name: "other class", key: deriveKey, scope: "Jazz\x002023 Spring\x003"},
+		{name: "other term", key: deriveKey, scope: "Tap\x002023 Summer\x003"},
+		{name: "other key", key: otherKey, scope: "Tap\x002023 Spring\x003"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := o.Derive(tt.key, tt.scope)
+			if err != nil {
+				t.Fatalf("Derive() error = %v", err)
+			}
+
+			if got.Text == base.Text {
+				t.Errorf("Derive() = %q, the same as the original scope", got.Text)
+			}
+		})
+	}
+}
+
+func TestOptions_Derive_errors(t *testing.T) {
+	_, err := passphrase.Options{}.Derive(nil, "Tap")
+	if err == nil {
+		t.Error("Derive() without a key succeeded")
+	}
+
+	_, err = passphrase.Options{Mode: "emoji"}.Derive(deriveKey, "Tap")
+	if err == nil {
+		t.Error("Derive() with invalid options succeeded")
+	}
+}
@@ -0,0 +1,401 @@
+package passphrase
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultWords     = 4
+	defaultSeparator = "_"
+	// maxWords limits how many words MinEntropy can add.
+	maxWords = 20
+
+	defaultPronounceableWords = 3
+	defaultSyllables          = 3
+	maxSyllables              = 10
+
+	defaultPINLength = 6
+	minPINLength     = 4
+	maxPINLength     = 20
+
+	digits = "0123456789"
+	// symbols are ones most password rules accept and that are easy to type and read aloud.
+	symbols = "!#$%&*+=?@"
+)
+
+// Mode is how a passphrase is made.
+type Mode string
+
+const (
+	// Diceware picks random words from a word list, the default.
+	Diceware Mode = "words"
+	// Pronounceable makes up words from random syllables that are easy to say and spell.
+	Pronounceable Mode = "pronounceable"
+	// PIN is a random string of digits.
+	PIN Mode = "pin"
+)
+
+// Capitalization is which letters of a passphrase are uppercase.
+type Capitalization string
+
+const (
+	// Lower leaves every word lowercase, the default.
+	Lower Capitalization = "lower"
+	// First capitalizes the first word.
+	First Capitalization = "first"
+	// Title capitalizes every word.
+	Title Capitalization = "title"
+	// Upper makes every letter uppercase.
+	Upper Capitalization = "upper"
+	// Random capitalizes each word or not at random, adding a bit of entropy per word.
+	Random Capitalization = "random"
+)
+
+// Options controls how passphrases are generated. The zero value generates four lowercase words from the EFF's first
+// short word list separated by underscores.
+type Options struct {
+	Mode Mode `yaml:"mode"`
+	// WordList is the built-in word list to use, see BuiltinWordList. Defaults to EFFShort1.
+	WordList string `yaml:"word_list"`
+	// WordListPath is a word list file to use instead, see ParseWordList.
+	WordListPath string `yaml:"word_list_path"`
+	// NoAmbiguous leaves out words that are hard to spell after hearing them, see WordList.Unambiguous.
+	NoAmbiguous bool `yaml:"no_ambiguous"`
+	// Words is how many words are used, defaults to 4, or 3 pronounceable words.
+	Words int `yaml:"words"`
+	// Syllables is how many syllables each pronounceable word has, defaults to 3.
+	Syllables int `yaml:"syllables"`
+	// PINLength is how many digits a PIN has, defaults to 6.
+	PINLength int `yaml:"pin_length"`
+	// Separator goes between words, defaults to an underscore.
+	Separator      string         `yaml:"separator"`
+	Capitalization Capitalization `yaml:"capitalization"`
+	// Digit and Symbol add a random digit or symbol to the end of a random word, for password rules that require
+	// them.
+	Digit  bool `yaml:"digit"`
+	Symbol bool `yaml:"symbol"`
+	// MinEntropy adds words, or digits to a PIN, until the passphrase has at least this many bits of entropy, ex. 50.
+	MinEntropy float64 `yaml:"min_entropy"`
+}
+
+// Passphrase is a generated passphrase.
+type Passphrase struct {
+	Text string
+	// Entropy is how many bits of randomness the passphrase has, assuming an attacker knows the options and word
+	// list it was made with.
+	Entropy float64
+	// Description says how the passphrase was made and its entropy, ex. "4 words from eff_short_1, 41.4 bits of
+	// entropy".
+	Description string
+}
+
+// Validate checks that the options can be used.
+func (o Options) Validate() error {
+	switch o.Mode {
+	case "", Diceware, Pronounceable, PIN:
+	default:
+		return fmt.Errorf("unknown passphrase mode %v, expected one of: words, pronounceable, pin", o.Mode)
+	}
+
+	if o.Words < 0 || o.Words > maxWords {
+		return fmt.Errorf("passphrase words must be between 0 (default) and %v, got %v", maxWords, o.Words)
+	}
+
+	if o.Syllables < 0 || o.Syllables > maxSyllables {
+		return fmt.Errorf("passphrase syllables must be between 0 (default) and %v, got %v", maxSyllables, o.Syllables)
+	}
+
+	if o.PINLength != 0 && (o.PINLength < minPINLength || o.PINLength > maxPINLength) {
+		return fmt.Errorf("PIN length must be between %v and %v, got %v", minPINLength, maxPINLength, o.PINLength)
+	}
+
+	switch o.Capitalization {
+	case "", Lower, First, Title, Upper, Random:
+	default:
+		return fmt.Errorf("unknown passphrase capitalization %v, expected one of: lower, first, title, upper, random", o.Capitalization)
+	}
+
+	if o.Mode == "" || o.Mode == Diceware {
+		_, err := o.List()
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.MinEntropy > 0 && o.withDefaults().Entropy() < o.MinEntropy {
+		return fmt.Errorf("%v passphrases can't reach %v bits of entropy", o.withDefaults().Mode, o.MinEntropy)
+	}
+
+	return nil
+}
+
+// List returns the word list the options use.
+func (o Options) List() (WordList, error) {
+	name := o.WordList
+	if name == "" {
+		name = EFFShort1
+	}
+
+	return cachedWordList(name, o.WordListPath, o.NoAmbiguous)
+}
+
+// Entropy returns how many bits of entropy passphrases generated with the options have, after words are added to
+// reach MinEntropy. It's 0 if the word list can't be loaded.
+func (o Options) Entropy() float64 {
+	o = o.withDefaults()
+
+	if o.Mode == PIN {
+		return float64(o.PINLength) * math.Log2(float64(len(digits)))
+	}
+
+	perWord := float64(o.Syllables) * math.Log2(float64(syllableCount))
+	if o.Mode == Diceware {
+		list, err := o.List()
+		if err != nil {
+			return 0
+		}
+		perWord = list.Entropy()
+	}
+
+	bits := float64(o.Words) * perWord
+	if o.Capitalization == Random {
+		bits += float64(o.Words)
+	}
+
+	// the character, and which word it's added to.
+	if o.Digit {
+		bits += math.Log2(float64(len(digits))) + math.Log2(float64(o.Words))
+	}
+
+	if o.Symbol {
+		bits += math.Log2(float64(len(o.symbols()))) + math.Log2(float64(o.Words))
+	}
+
+	return bits
+}
+
+// Describe says how passphrases are made with the options and their entropy.
+func (o Options) Describe() string {
+	o = o.withDefaults()
+
+	var what string
+	switch o.Mode {
+	case PIN:
+		what = fmt.Sprintf("%v-digit PIN", o.PINLength)
+	case Pronounceable:
+		what = fmt.Sprintf("%v pronounceable words of %v syllables", o.Words, o.Syllables)
+	default:
+		list, _ := o.List()
+		what = fmt.Sprintf("%v words from %v", o.Words, list.Name())
+	}
+
+	return fmt.Sprintf("%v, %.1f bits of entropy", what, o.Entropy())
+}
+
+// Generate creates a random passphrase.
+func (o Options) Generate() (Passphrase, error) {
+	return o.generate(rand.Reader)
+}
+
+// generate creates a passphrase using randomness read from src.
+func (o Options) generate(src io.Reader) (Passphrase, error) {
+	err := o.Validate()
+	if err != nil {
+		return Passphrase{}, err
+	}
+
+	o = o.withDefaults()
+	p := Passphrase{
+		Entropy:     o.Entropy(),
+		Description: o.Describe(),
+	}
+
+	if o.Mode == PIN {
+		p.Text, err = randomString(src, digits, o.PINLength)
+		return p, err
+	}
+
+	chosen := make([]string, o.Words)
+	if o.Mode == Pronounceable {
+		for i := range chosen {
+			chosen[i], err = pronounceableWord(src, o.Syllables)
+			if err != nil {
+				return Passphrase{}, err
+			}
+		}
+	} else {
+		list, err := o.List()
+		if err != nil {
+			return Passphrase{}, err
+		}
+
+		// picking a random index is the same as rolling the dice for a word.
+		for i := range chosen {
+			n, err := randomInt(src, list.Len())
+			if err != nil {
+				return Passphrase{}, err
+			}
+
+			chosen[i] = list.Word(n)
+		}
+	}
+
+	for i, w := range chosen {
+		capitalize := false
+		switch o.Capitalization {
+		case First:
+			capitalize = i == 0
+		case Title:
+			capitalize = true
+		case Upper:
+			w = strings.ToUpper(w)
+		case Random:
+			n, err := randomInt(src, 2)
+			if err != nil {
+				return Passphrase{}, err
+			}
+			capitalize = n == 1
+		}
+
+		if capitalize {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+
+		chosen[i] = w
+	}
+
+	if o.Digit {
+		err = appendRandom(src, chosen, digits)
+		if err != nil {
+			return Passphrase{}, err
+		}
+	}
+
+	if o.Symbol {
+		err = appendRandom(src, chosen, o.symbols())
+		if err != nil {
+			return Passphrase{}, err
+		}
+	}
+
+	p.Text = strings.Join(chosen, o.Separator)
+	return p, nil
+}
+
+// withDefaults fills in unset options and adds words or digits until MinEntropy is reached.
+func (o Options) withDefaults() Options {
+	if o.Mode == "" {
+		o.Mode = Diceware
+	}
+
+	if o.Words == 0 {
+		o.Words = defaultWords
+		if o.Mode == Pronounceable {
+			o.Words = defaultPronounceableWords
+		}
+	}
+
+	if o.Syllables == 0 {
+		o.Syllables = defaultSyllables
+	}
+
+	if o.PINLength == 0 {
+		o.PINLength = defaultPINLength
+	}
+
+	if o.Separator == "" {
+		o.Separator = defaultSeparator
+	}
+
+	if o.Capitalization == "" {
+		o.Capitalization = Lower
+	}
+
+	if o.MinEntropy > 0 {
+		for {
+			// Entropy calls withDefaults, so stop it from adding more too.
+			check := o
+			check.MinEntropy = 0
+			if check.Entropy() >= o.MinEntropy {
+				break
+			}
+
+			if o.Mode == PIN && o.PINLength < maxPINLength {
+				o.PINLength++
+			} else if o.Mode != PIN && o.Words < maxWords {
+				o.Words++
+			} else {
+				break
+			}
+		}
+	}
+
+	return o
+}
+
+// symbols returns the symbols that can be added, without the separator so the words stay easy to tell apart.
+func (o Options) symbols() string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(o.Separator, r) {
+			return -1
+		}
+		return r
+	}, symbols)
+}
+
+// appendRandom adds a random character from chars to the end of a random word.
+func appendRandom(src io.Reader, words []string, chars string) error {
+	w, err := randomInt(src, len(words))
+	if err != nil {
+		return err
+	}
+
+	c, err := randomInt(src, len(chars))
+	if err != nil {
+		return err
+	}
+
+	words[w] += string(chars[c])
+	return nil
+}
+
+// randomString returns n random characters from chars.
+func randomString(src io.Reader, chars string, n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		c, err := randomInt(src, len(chars))
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[c]
+	}
+
+	return string(b), nil
+}
+
+// randomInt returns a uniformly random number in [0, n) read from src. Values that would make some numbers more
+// likely than others are rejected rather than wrapped around, and derived passphrases depend on exactly how many bytes
+// are read, so this shouldn't change.
+func randomInt(src io.Reader, n int) (int, error) {
+	max := ^uint64(0) - ^uint64(0)%uint64(n)
+	var b [8]byte
+	for {
+		_, err := io.ReadFull(src, b[:])
+		if err != nil {
+			return 0, err
+		}
+
+		v := binary.BigEndian.Uint64(b[:])
+		if v < max {
+			return int(v % uint64(n)), nil
+		}
+	}
+}
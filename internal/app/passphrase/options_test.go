@@ -0,0 +1,238 @@
+package passphrase_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+)
+
+// listSize is the number of words in the list, derived from the entropy of one word.
+var listSize = math.Round(math.Exp2(passphrase.Options{Words: 1}.Entropy()))
+
+func TestOptions_Generate(t *testing.T) {
+	capitalizations := []passphrase.Capitalization{"", passphrase.Lower, passphrase.First, passphrase.Title, passphrase.Upper, passphrase.Random}
+
+	for _, words := range []int{0, 1, 6} {
+		for _, sep := range []string{"", ".", " ", "#"} {
+			for _, c := range capitalizations {
+				for _, digit := range []bool{false, true} {
+					for _, symbol := range []bool{false, true} {
+						o := passphrase.Options{Words: words, Separator: sep, Capitalization: c, Digit: digit, Symbol: symbol}
+						checkPassphrase(t, o)
+					}
+				}
+			}
+		}
+	}
+}
+
+// checkPassphrase generates a passphrase and checks that every option was applied.
+func checkPassphrase(t *testing.T, o passphrase.Options) {
+	t.Helper()
+
+	p, err := o.Generate()
+	if err != nil {
+		t.Fatalf("%+v Generate() error = %v", o, err)
+	}
+
+	wantWords := o.Words
+	if wantWords == 0 {
+		wantWords = 4
+	}
+
+	sep := o.Separator
+	if sep == "" {
+		sep = "_"
+	}
+
+	parts := strings.Split(p.Text, sep)
+	if len(parts) != wantWords {
+		t.Fatalf("%+v Generate() = %q is %v words, want %v", o, p.Text, len(parts), wantWords)
+	}
+
+	var digits, symbols int
+	for i, part := range parts {
+		word := strings.TrimRightFunc(part, func(r rune) bool {
+			if unicode.IsDigit(r) {
+				digits++
+				return true
+			}
+			if strings.ContainsRune("!#$%&*+=?@", r) {
+				symbols++
+				if strings.ContainsRune(sep, r) {
+					t.Errorf("%+v Generate() = %q, symbol is the separator", o, p.Text)
+				}
+				return true
+			}
+			return false
+		})
+
+		first := []rune(word)[0]
+		rest := word[len(string(first)):]
+		switch o.Capitalization {
+		case "", passphrase.Lower:
+			if word != strings.ToLower(word) {
+				t.Errorf("%+v Generate() = %q, want lowercase words", o, p.Text)
+			}
+		case passphrase.First:
+			if unicode.IsUpper(first) != (i == 0) || rest != strings.ToLower(rest) {
+				t.Errorf("%+v Generate() = %q, want only the first word capitalized", o, p.Text)
+			}
+		case passphrase.Title:
+			if !unicode.IsUpper(first) || rest != strings.ToLower(rest) {
+				t.Errorf("%+v Generate() = %q, want every word capitalized", o, p.Text)
+			}
+		case passphrase.Upper:
+			if word != strings.ToUpper(word) {
+				t.Errorf("%+v Generate() = %q, want uppercase words", o, p.Text)
+			}
+		case passphrase.Random:
+			if rest != strings.ToLower(rest) {
+				t.Errorf("%+v Generate() = %q, want only first letters capitalized", o, p.Text)
+			}
+		}
+	}
+
+	if want := boolCount(o.Digit); digits != want {
+		t.Errorf("%+v Generate() = %q has %v digits, want %v", o, p.Text, digits, want)
+	}
+
+	if want := boolCount(o.Symbol); symbols != want {
+		t.Errorf("%+v Generate() = %q has %v symbols, want %v", o, p.Text, symbols, want)
+	}
+
+	wantEntropy := float64(wantWords) * math.Log2(listSize)
+	if o.Capitalization == passphrase.Random {
+		wantEntropy += float64(wantWords)
+	}
+	if o.Digit {
+		wantEntropy += math.Log2(10) + math.Log2(float64(wantWords))
+	}
+	if o.Symbol {
+		// a symbol used as the separator isn't added.
+		symbolCount := 10.0
+		if sep == "#" {
+			symbolCount = 9
+		}
+		wantEntropy += math.Log2(symbolCount) + math.Log2(float64(wantWords))
+	}
+
+	if math.Abs(p.Entropy-wantEntropy) > 1e-9 {
+		t.Errorf("%+v Generate() entropy = %v, want %v", o, p.Entropy, wantEntropy)
+	}
+}
+
+func boolCount(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestOptions_MinEntropy(t *testing.T) {
+	o := passphrase.Options{Words: 2, MinEntropy: 60}
+
+	p, err := o.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each word adds log2(1296), about 10.3 bits.
+	want := int(math.Ceil(60 / math.Log2(listSize)))
+	if got := len(strings.Split(p.Text, "_")); got != want {
+		t.Errorf("Generate() = %q is %v words, want %v", p.Text, got, want)
+	}
+
+	if p.Entropy < 60 {
+		t.Errorf("Generate() entropy = %v, want at least 60", p.Entropy)
+	}
+}
+
+func TestOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options passphrase.Options
+		wantErr bool
+	}{
+		{name: "defaults", options: passphrase.Options{}},
+		{name: "negative words", options: passphrase.Options{Words: -1}, wantErr: true},
+		{name: "too many words", options: passphrase.Options{Words: 21}, wantErr: true},
+		{name: "unknown capitalization", options: passphrase.Options{Capitalization: "camel"}, wantErr: true},
+		{name: "unreachable entropy", options: passphrase.Options{MinEntropy: 1000}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// chiSquare returns the chi-square statistic of counts against a uniform distribution over buckets, and the
+// threshold it should stay under: the mean plus six standard deviations, which a uniform generator exceeds about once
+// in a billion runs.
+func chiSquare(counts map[string]int, buckets, samples int) (float64, float64) {
+	expected := float64(samples) / float64(buckets)
+
+	var stat float64
+	for _, c := range counts {
+		stat += math.Pow(float64(c)-expected, 2) / expected
+	}
+	// buckets that never came up.
+	stat += float64(buckets-len(counts)) * expected
+
+	df := float64(buckets - 1)
+	return stat, df + 6*math.Sqrt(2*df)
+}
+
+func TestOptions_Generate_uniform(t *testing.T) {
+	buckets := int(listSize)
+	samples := buckets * 40
+
+	words := make(map[string]int)
+	digits := make(map[string]int)
+	positions := make(map[string]int)
+	o := passphrase.Options{Words: 1}
+	withDigit := passphrase.Options{Words: 3, Separator: " ", Digit: true}
+	for i := 0; i < samples; i++ {
+		p, err := o.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		words[p.Text]++
+
+		p, err = withDigit.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for n, part := range strings.Split(p.Text, " ") {
+			last := part[len(part)-1:]
+			if unicode.IsDigit(rune(last[0])) {
+				digits[last]++
+				positions[string(rune('0'+n))]++
+			}
+		}
+	}
+
+	if len(words) > buckets {
+		t.Fatalf("Generate() made %v different words, want at most %v", len(words), buckets)
+	}
+
+	if stat, max := chiSquare(words, buckets, samples); stat > max {
+		t.Errorf("word chi-square = %v, want under %v", stat, max)
+	}
+
+	if stat, max := chiSquare(digits, 10, samples); stat > max {
+		t.Errorf("digit chi-square = %v, want under %v", stat, max)
+	}
+
+	if stat, max := chiSquare(positions, 3, samples); stat > max {
+		t.Errorf("digit position chi-square = %v, want under %v", stat, max)
+	}
+}
@@ -0,0 +1,32 @@
+package passphrase
+
+import (
+	"io"
+	"strings"
+)
+
+const (
+	// consonants leave out letters that are easy to mishear or misspell when read aloud: c and q sound like k or s, x
+	// like ks, and w and y are sometimes vowels.
+	consonants = "bdfghjklmnprstvz"
+	vowels     = "aeiou"
+	// syllableCount is how many different syllables there are, each is a consonant followed by a vowel.
+	syllableCount = len(consonants) * len(vowels)
+)
+
+// pronounceableWord returns a made-up word of random consonant-vowel syllables, ex. "bofali". Every syllable is
+// picked uniformly, adding log2(80), about 6.3, bits of entropy.
+func pronounceableWord(src io.Reader, syllables int) (string, error) {
+	var b strings.Builder
+	for i := 0; i < syllables; i++ {
+		n, err := randomInt(src, syllableCount)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteByte(consonants[n/len(vowels)])
+		b.WriteByte(vowels[n%len(vowels)])
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,205 @@
+package passphrase_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+)
+
+func TestOptions_Generate_modes(t *testing.T) {
+	tests := []struct {
+		name            string
+		options         passphrase.Options
+		check           func(t *testing.T, text string)
+		wantEntropy     float64
+		wantDescription string
+	}{
+		{
+			name:    "pronounceable defaults",
+			options: passphrase.Options{Mode: passphrase.Pronounceable},
+			check: func(t *testing.T, text string) {
+				checkPronounceable(t, text, "_", 3, 3)
+			},
+			wantEntropy:     9 * math.Log2(80),
+			wantDescription: "3 pronounceable words of 3 syllables, 56.9 bits of entropy",
+		},
+		{
+			name:    "pronounceable with options",
+			options: passphrase.Options{Mode: passphrase.Pronounceable, Words: 2, Syllables: 4, Separator: "-"},
+			check: func(t *testing.T, text string) {
+				checkPronounceable(t, text, "-", 2, 4)
+			},
+			wantEntropy:     8 * math.Log2(80),
+			wantDescription: "2 pronounceable words of 4 syllables, 50.6 bits of entropy",
+		},
+		{
+			name:    "PIN defaults",
+			options: passphrase.Options{Mode: passphrase.PIN},
+			check: func(t *testing.T, text string) {
+				checkPIN(t, text, 6)
+			},
+			wantEntropy:     6 * math.Log2(10),
+			wantDescription: "6-digit PIN, 19.9 bits of entropy",
+		},
+		{
+			name:    "PIN ignores word options",
+			options: passphrase.Options{Mode: passphrase.PIN, PINLength: 4, Capitalization: passphrase.Upper, Symbol: true, Separator: "-"},
+			check: func(t *testing.T, text string) {
+				checkPIN(t, text, 4)
+			},
+			wantEntropy:     4 * math.Log2(10),
+			wantDescription: "4-digit PIN, 13.3 bits of entropy",
+		},
+		{
+			name:    "PIN min entropy adds digits",
+			options: passphrase.Options{Mode: passphrase.PIN, MinEntropy: 30},
+			check: func(t *testing.T, text string) {
+				checkPIN(t, text, 10)
+			},
+			wantEntropy:     10 * math.Log2(10),
+			wantDescription: "10-digit PIN, 33.2 bits of entropy",
+		},
+		{
+			name:    "words without ambiguous entries",
+			options: passphrase.Options{NoAmbiguous: true},
+			check: func(t *testing.T, text string) {
+				if len(strings.Split(text, "_")) != 4 {
+					t.Errorf("Generate() = %q, want 4 words", text)
+				}
+			},
+			wantEntropy:     4 * math.Log2(1269),
+			wantDescription: "4 words from eff_short_1 without ambiguous words, 41.2 bits of entropy",
+		},
+		{
+			name:            "words",
+			options:         passphrase.Options{},
+			check:           func(t *testing.T, text string) {},
+			wantEntropy:     4 * math.Log2(1296),
+			wantDescription: "4 words from eff_short_1, 41.4 bits of entropy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.options.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, p.Text)
+
+			if math.Abs(p.Entropy-tt.wantEntropy) > 1e-9 {
+				t.Errorf("Generate() entropy = %v, want %v", p.Entropy, tt.wantEntropy)
+			}
+
+			if p.Description != tt.wantDescription {
+				t.Errorf("Generate() description = %q, want %q", p.Description, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func checkPronounceable(t *testing.T, text, sep string, words, syllables int) {
+	t.Helper()
+
+	parts := strings.Split(text, sep)
+	if len(parts) != words {
+		t.Fatalf("Generate() = %q is %v words, want %v", text, len(parts), words)
+	}
+
+	for _, w := range parts {
+		if len(w) != 2*syllables {
+			t.Errorf("Generate() = %q, want words of %v syllables", text, syllables)
+			continue
+		}
+
+		for i := 0; i < len(w); i += 2 {
+			if !strings.ContainsRune("bdfghjklmnprstvz", rune(w[i])) || !strings.ContainsRune("aeiou", rune(w[i+1])) {
+				t.Errorf("Generate() = %q, %q isn't a consonant-vowel syllable", text, w[i:i+2])
+			}
+		}
+	}
+}
+
+func checkPIN(t *testing.T, text string, length int) {
+	t.Helper()
+
+	if len(text) != length || strings.Trim(text, "0123456789") != "" {
+		t.Errorf("Generate() = %q, want a %v-digit PIN", text, length)
+	}
+}
+
+func TestWordList_Unambiguous(t *testing.T) {
+	l, err := passphrase.BuiltinWordList(passphrase.EFFShort1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := l.Unambiguous()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < u.Len(); i++ {
+		switch w := u.Word(i); w {
+		case "yo-yo", "yoyo", "whole", "wind":
+			t.Errorf("Unambiguous() kept %v", w)
+		}
+	}
+
+	if u.Len() != 1269 {
+		t.Errorf("Unambiguous() has %v words, want 1269", u.Len())
+	}
+}
+
+func TestOptions_Generate_uniformModes(t *testing.T) {
+	samples := 80 * 200
+
+	syllables := make(map[string]int)
+	pinDigits := make(map[string]int)
+	pronounceable := passphrase.Options{Mode: passphrase.Pronounceable, Words: 1, Syllables: 1}
+	pin := passphrase.Options{Mode: passphrase.PIN, PINLength: 4}
+	for i := 0; i < samples; i++ {
+		p, err := pronounceable.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		syllables[p.Text]++
+
+		p, err = pin.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pinDigits[p.Text[:1]]++
+	}
+
+	if stat, max := chiSquare(syllables, 80, samples); stat > max {
+		t.Errorf("syllable chi-square = %v, want under %v", stat, max)
+	}
+
+	if stat, max := chiSquare(pinDigits, 10, samples); stat > max {
+		t.Errorf("PIN digit chi-square = %v, want under %v", stat, max)
+	}
+}
+
+func TestOptions_Validate_modes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options passphrase.Options
+	}{
+		{name: "unknown mode", options: passphrase.Options{Mode: "emoji"}},
+		{name: "short PIN", options: passphrase.Options{Mode: passphrase.PIN, PINLength: 3}},
+		{name: "long PIN", options: passphrase.Options{Mode: passphrase.PIN, PINLength: 21}},
+		{name: "too many syllables", options: passphrase.Options{Mode: passphrase.Pronounceable, Syllables: 11}},
+		{name: "unreachable PIN entropy", options: passphrase.Options{Mode: passphrase.PIN, MinEntropy: 80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if err == nil {
+				t.Error("Validate() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package passphrase
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// EFFLarge is the EFF's long word list, 7776 words picked with 5 dice.
+	EFFLarge = "eff_large"
+	// EFFShort1 is the EFF's first short word list, 1296 short words picked with 4 dice. It's the default.
+	EFFShort1 = "eff_short_1"
+	// EFFShort2 is the EFF's second short word list, 1296 longer, more memorable words with unique 3-letter prefixes.
+	EFFShort2 = "eff_short_2"
+
+	// minListSize keeps each word worth at least 6 bits of entropy.
+	minListSize = 64
+)
+
+// builtinFiles are the files of the word lists in the wordlists folder that can be chosen by name, as published at
+// https://www.eff.org/deeplinks/2016/07/new-wordlists-random-passphrases.
+var builtinFiles = map[string]string{
+	EFFLarge:  "eff_large_wordlist.txt",
+	EFFShort1: "eff_short_wordlist_1.txt",
+	EFFShort2: "eff_short_wordlist_2_0.txt",
+}
+
+//go:embed wordlists
+var wordlists embed.FS
+
+// WordList is the list passphrase words are picked from.
+type WordList struct {
+	name  string
+	words []string
+}
+
+// NewWordList checks that the words can be used as a word list: there must be at least 64 of them, and none can be
+// empty, contain whitespace, or be repeated.
+func NewWordList(name string, words []string) (WordList, error) {
+	if len(words) < minListSize {
+		return WordList{}, fmt.Errorf("word list %v has %v words, it needs at least %v", name, len(words), minListSize)
+	}
+
+	seen := make(map[string]bool, len(words))
+	for i, w := range words {
+		if w == "" || strings.IndexFunc(w, unicode.IsSpace) >= 0 {
+			return WordList{}, fmt.Errorf("word list %v has an empty word or one with spaces at line %v", name, i+1)
+		}
+
+		if seen[w] {
+			return WordList{}, fmt.Errorf("word list %v has %q more than once", name, w)
+		}
+		seen[w] = true
+	}
+
+	return WordList{name: name, words: words}, nil
+}
+
+// Name returns the list's name, or the file it was loaded from.
+func (l WordList) Name() string {
+	return l.name
+}
+
+// Len returns the number of words in the list.
+func (l WordList) Len() int {
+	return len(l.words)
+}
+
+// Word returns the word at index i.
+func (l WordList) Word(i int) string {
+	return l.words[i]
+}
+
+// Entropy returns the bits of entropy each word adds.
+func (l WordList) Entropy() float64 {
+	return math.Log2(float64(len(l.words)))
+}
+
+// DiceLength returns how many dice rolls pick a word, ex. 4 for a 1296-word list. Lists whose size isn't a power of
+// 6 can't be used with dice exactly, but words are picked at random uniformly either way.
+func (l WordList) DiceLength() int {
+	n := 0
+	for size := 1; size < len(l.words); size *= 6 {
+		n++
+	}
+
+	return n
+}
+
+// ambiguous are words in the built-in lists that are hard to spell after hearing them: homophones and near-homophones
+// of common words (whole, chute, wok), words with two pronunciations (wind, wound, dove), words with another spelling
+// in the same list (boney and bony, yoyo and yo-yo), and names and brands usually written with capitals.
+var ambiguous = map[string]bool{
+	"aide": true, "bok": true, "boney": true, "bony": true, "cache": true, "chute": true, "creme": true, "dove": true,
+	"ebay": true, "ebook": true, "email": true, "islam": true, "kung": true, "mardi": true, "mumbo": true,
+	"petri": true, "sax": true, "shown": true, "whole": true, "whoop": true, "wifi": true, "wind": true, "wok": true,
+	"wound": true, "xerox": true, "yoyo": true,
+}
+
+// Unambiguous returns the list without words that are hard to spell after hearing them read aloud: ones with
+// characters other than letters, like "yo-yo", and the ambiguous words of the built-in lists. It's an error if too
+// few words are left.
+func (l WordList) Unambiguous() (WordList, error) {
+	var words []string
+	for _, w := range l.words {
+		if ambiguous[strings.ToLower(w)] || strings.IndexFunc(w, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+			continue
+		}
+		words = append(words, w)
+	}
+
+	return NewWordList(l.name+" without ambiguous words", words)
+}
+
+// ParseWordList reads a word list with one word per line. Lines can also be in the EFF's dice format, the dice
+// rolls then the word separated by whitespace; the rolls must then cover every combination of the same number of
+// dice exactly once. Blank lines are skipped.
+func ParseWordList(name string, r io.Reader) (WordList, error) {
+	var words, rolls []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			words = append(words, fields[0])
+		case 2:
+			if strings.Trim(fields[0], "123456") != "" {
+				return WordList{}, fmt.Errorf("word list %v line %v: %q aren't dice rolls", name, line, fields[0])
+			}
+			rolls = append(rolls, fields[0])
+			words = append(words, fields[1])
+		default:
+			return WordList{}, fmt.Errorf("word list %v line %v: expected a word, or dice rolls and a word", name, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return WordList{}, fmt.Errorf("could not read word list %v: %v", name, err)
+	}
+
+	if len(rolls) > 0 {
+		err := checkRolls(name, rolls, len(words))
+		if err != nil {
+			return WordList{}, err
+		}
+	}
+
+	return NewWordList(name, words)
+}
+
+// checkRolls makes sure every word has dice rolls and that they cover every combination exactly once.
+func checkRolls(name string, rolls []string, words int) error {
+	if len(rolls) != words {
+		return fmt.Errorf("word list %v mixes lines with and without dice rolls", name)
+	}
+
+	dice := len(rolls[0])
+	want := int(math.Pow(6, float64(dice)))
+	if words != want {
+		return fmt.Errorf("word list %v has %v words, %v dice need %v", name, words, dice, want)
+	}
+
+	seen := make(map[string]bool, words)
+	for _, r := range rolls {
+		if len(r) != dice {
+			return fmt.Errorf("word list %v has rolls of %v and %v dice", name, dice, len(r))
+		}
+
+		if seen[r] {
+			return fmt.Errorf("word list %v has rolls %v more than once", name, r)
+		}
+		seen[r] = true
+	}
+
+	return nil
+}
+
+// LoadWordList reads a word list file, see ParseWordList.
+func LoadWordList(path string) (WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WordList{}, fmt.Errorf("could not open word list: %v", err)
+	}
+	defer f.Close()
+
+	return ParseWordList(path, f)
+}
+
+// BuiltinWordList returns one of the EFF word lists by name.
+func BuiltinWordList(name string) (WordList, error) {
+	file, ok := builtinFiles[name]
+	if !ok {
+		return WordList{}, fmt.Errorf("unknown word list %v, expected one of: %v, %v, %v", name, EFFLarge, EFFShort1, EFFShort2)
+	}
+
+	f, err := wordlists.Open(path.Join("wordlists", file))
+	if err != nil {
+		return WordList{}, err
+	}
+	defer f.Close()
+
+	return ParseWordList(name, f)
+}
+
+var (
+	listsMu sync.Mutex
+	// lists caches word lists by name or path so files are only read once.
+	lists = make(map[string]WordList)
+)
+
+// cachedWordList returns the built-in list with the given name, or the list in the file at path if it's set,
+// optionally without its ambiguous words.
+func cachedWordList(name, path string, unambiguous bool) (WordList, error) {
+	key := "builtin:" + name
+	if path != "" {
+		key = "file:" + path
+	}
+	if unambiguous {
+		key += ":unambiguous"
+	}
+
+	listsMu.Lock()
+	defer listsMu.Unlock()
+
+	if l, ok := lists[key]; ok {
+		return l, nil
+	}
+
+	var l WordList
+	var err error
+	if path != "" {
+		l, err = LoadWordList(path)
+	} else {
+		l, err = BuiltinWordList(name)
+	}
+	if err == nil && unambiguous {
+		l, err = l.Unambiguous()
+	}
+	if err != nil {
+		return WordList{}, err
+	}
+
+	lists[key] = l
+	return l, nil
+}
@@ -0,0 +1,149 @@
+package passphrase_test
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/passphrase"
+)
+
+// plainList returns n words, one per line.
+func plainList(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "word%v\n", i)
+	}
+	return b.String()
+}
+
+// diceList returns a list in the EFF dice format for the given number of dice.
+func diceList(dice int) string {
+	var b strings.Builder
+	for i := 0; i < int(math.Pow(6, float64(dice))); i++ {
+		rolls := make([]byte, dice)
+		n := i
+		for d := dice - 1; d >= 0; d-- {
+			rolls[d] = byte('1' + n%6)
+			n /= 6
+		}
+		fmt.Fprintf(&b, "%s\tword%v\n", rolls, i)
+	}
+	return b.String()
+}
+
+func TestParseWordList(t *testing.T) {
+	tests := []struct {
+		name      string
+		contents  string
+		wantLen   int
+		wantDice  int
+		wantError bool
+	}{
+		{name: "one word per line", contents: plainList(2048), wantLen: 2048, wantDice: 5},
+		{name: "blank lines are skipped", contents: "\n" + plainList(64) + "\n\n", wantLen: 64, wantDice: 3},
+		{name: "dice format", contents: diceList(3), wantLen: 216, wantDice: 3},
+		{name: "too few words", contents: plainList(63), wantError: true},
+		{name: "duplicate word", contents: plainList(100) + "word5\n", wantError: true},
+		{name: "missing dice rolls", contents: strings.SplitN(diceList(3), "\n", 2)[1], wantError: true},
+		{name: "repeated dice rolls", contents: strings.Replace(diceList(3), "112\t", "111\t", 1), wantError: true},
+		{name: "rolls that aren't dice", contents: strings.Replace(diceList(3), "111\t", "117\t", 1), wantError: true},
+		{name: "rolls of different lengths", contents: strings.Replace(diceList(3), "111\t", "1111\t", 1), wantError: true},
+		{name: "mixed formats", contents: diceList(3) + "extra\n", wantError: true},
+		{name: "too many fields", contents: plainList(100) + "11 two words\n", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := passphrase.ParseWordList(tt.name, strings.NewReader(tt.contents))
+			if (err != nil) != tt.wantError {
+				t.Fatalf("ParseWordList() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+
+			if l.Len() != tt.wantLen {
+				t.Errorf("Len() = %v, want %v", l.Len(), tt.wantLen)
+			}
+
+			if l.DiceLength() != tt.wantDice {
+				t.Errorf("DiceLength() = %v, want %v", l.DiceLength(), tt.wantDice)
+			}
+
+			if want := math.Log2(float64(tt.wantLen)); l.Entropy() != want {
+				t.Errorf("Entropy() = %v, want %v", l.Entropy(), want)
+			}
+
+			if l.Word(0) != "word0" {
+				t.Errorf("Word(0) = %v, want word0", l.Word(0))
+			}
+		})
+	}
+}
+
+func TestBuiltinWordList(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantLen   int
+		wantDice  int
+		wantFirst string
+		wantLast  string
+	}{
+		{name: passphrase.EFFLarge, wantLen: 7776, wantDice: 5, wantFirst: "abacus", wantLast: "zoom"},
+		{name: passphrase.EFFShort1, wantLen: 1296, wantDice: 4, wantFirst: "acid", wantLast: "zoom"},
+		{name: passphrase.EFFShort2, wantLen: 1296, wantDice: 4, wantFirst: "aardvark", wantLast: "zucchini"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := passphrase.BuiltinWordList(tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if l.Len() != tt.wantLen || l.DiceLength() != tt.wantDice {
+				t.Errorf("%v has %v words and %v dice, want %v and %v", tt.name, l.Len(), l.DiceLength(), tt.wantLen, tt.wantDice)
+			}
+
+			if l.Word(0) != tt.wantFirst || l.Word(l.Len()-1) != tt.wantLast {
+				t.Errorf("%v runs from %v to %v, want %v to %v", tt.name, l.Word(0), l.Word(l.Len()-1), tt.wantFirst, tt.wantLast)
+			}
+		})
+	}
+
+	_, err := passphrase.BuiltinWordList("diceware")
+	if err == nil {
+		t.Error("BuiltinWordList(diceware) error = nil, want an error")
+	}
+}
+
+func TestOptions_WordListPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	err := os.WriteFile(path, []byte(diceList(3)), 0640)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := passphrase.Options{Words: 3, WordListPath: path}
+	p, err := o.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, w := range strings.Split(p.Text, "_") {
+		if !strings.HasPrefix(w, "word") {
+			t.Errorf("Generate() = %q, want words from %v", p.Text, path)
+		}
+	}
+
+	if want := 3 * math.Log2(216); p.Entropy != want {
+		t.Errorf("Generate() entropy = %v, want %v", p.Entropy, want)
+	}
+
+	err = passphrase.Options{WordListPath: filepath.Join(t.TempDir(), "missing.txt")}.Validate()
+	if err == nil {
+		t.Error("Validate() with a missing word list error = nil, want an error")
+	}
+}
@@ -0,0 +1,533 @@
+package peertube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// Settings contains the account and settings used for PeerTube uploads.
+type Settings struct {
+	// InstanceURL is the PeerTube instance's address, ex. https://videos.example.edu.
+	InstanceURL string `yaml:"instance_url"`
+	Username    string `yaml:"username"`
+	// Password can be left empty and set with the PEERTUBE_PASSWORD environment variable instead.
+	Password string `yaml:"password"`
+	// TokenPath is where tokens are saved, defaults to peertube_token.json in the upload status folder.
+	TokenPath string `yaml:"token_path"`
+	// ChannelID is the channel videos are published to if their class doesn't have a peertube_channel_id. Defaults
+	// to the user's first channel.
+	ChannelID int `yaml:"channel_id"`
+	// PlaylistID is the playlist videos are added to if their class doesn't have a peertube_playlist_id.
+	PlaylistID string `yaml:"playlist_id"`
+	// PrivacyView uses the same values as Vimeo's privacy view and is mapped to the closest PeerTube privacy level.
+	PrivacyView string `yaml:"privacy_view"`
+	// NameTemplate and DescriptionTemplate are text/template strings rendered with metadata.VideoDetails.
+	NameTemplate        string   `yaml:"name_template"`
+	DescriptionTemplate string   `yaml:"description_template"`
+	Tags                []string `yaml:"tags"`
+}
+
+// Uploader uploads videos to a PeerTube instance with its resumable upload API.
+type Uploader struct {
+	// client is used for all HTTP calls except uploading video chunks.
+	client httpCaller
+	// uploadClient is used to upload video chunks so it has a long timeout property.
+	uploadClient httpCaller
+	settings     Settings
+	instanceURL  *url.URL
+	uploadDB     database.UploadDatastore
+	tokens       *tokenSource
+}
+
+type httpCaller interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// VideoUpload is the metadata sent when starting a resumable upload.
+type VideoUpload struct {
+	Name           string   `json:"name"`
+	ChannelID      int      `json:"channelId"`
+	Filename       string   `json:"filename"`
+	Privacy        Privacy  `json:"privacy"`
+	Description    string   `json:"description,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	VideoPasswords []string `json:"videoPasswords,omitempty"`
+}
+
+// Privacy is one of PeerTube's video privacy levels.
+type Privacy int
+
+const (
+	Public Privacy = iota + 1
+	Unlisted
+	Private
+	Internal
+	PasswordProtected
+)
+
+const (
+	oauthClientPath    = "/api/v1/oauth-clients/local"
+	tokenAPIPath       = "/api/v1/users/token"
+	userPath           = "/api/v1/users/me"
+	uploadPath         = "/api/v1/videos/upload-resumable"
+	playlistVideosPath = "/api/v1/video-playlists/%v/videos"
+	videoPathPrefix    = "/w/"
+	tokenFilename      = "peertube_token.json"
+	passwordEnv        = "PEERTUBE_PASSWORD"
+	maxTags            = 5
+	minChunkSize       = 256 * 1024
+)
+
+// New creates a PeerTube uploader that tracks uploads in db. OAuth tokens are saved to the output folder unless a
+// token path is configured.
+func New(outputFolderPath string, db database.UploadDatastore, hc httpCaller, uhc httpCaller, s Settings) (Uploader, error) {
+	if s.InstanceURL == "" || s.Username == "" {
+		return Uploader{}, errors.New("peertube_settings.instance_url and username are required")
+	}
+
+	instanceURL, err := url.Parse(strings.TrimSuffix(s.InstanceURL, "/"))
+	if err != nil {
+		return Uploader{}, fmt.Errorf("invalid peertube_settings.instance_url: %v", err)
+	}
+
+	if s.Password == "" {
+		s.Password = os.Getenv(passwordEnv)
+	}
+
+	tokenPath := s.TokenPath
+	if tokenPath == "" {
+		tokenPath = filepath.Join(outputFolderPath, tokenFilename)
+	}
+
+	return Uploader{
+		client:       hc,
+		uploadClient: uhc,
+		settings:     s,
+		instanceURL:  instanceURL,
+		uploadDB:     db,
+		tokens: &tokenSource{
+			client:      hc,
+			settings:    s,
+			instanceURL: instanceURL.String(),
+			store:       oauth.NewFileStore(tokenPath),
+		},
+	}, nil
+}
+
+// PrivacyFor maps a Vimeo privacy view to a PeerTube privacy level. PeerTube has no equivalent of Vimeo's contacts
+// or logged in users, so those are internal to the instance.
+func PrivacyFor(view string) (Privacy, error) {
+	switch view {
+	case "", "nobody", "disable":
+		return Private, nil
+	case "anybody":
+		return Public, nil
+	case "unlisted":
+		return Unlisted, nil
+	case "contacts", "users":
+		return Internal, nil
+	case "password":
+		return PasswordProtected, nil
+	default:
+		return 0, fmt.Errorf("unknown privacy view %v", view)
+	}
+}
+
+// Login gets a token with the configured username and password and saves it. PeerTube doesn't need a browser, so
+// prompt is unused.
+func (u Uploader) Login(prompt func(authURL string)) error {
+	src, err := u.tokens.source()
+	if err != nil {
+		return err
+	}
+
+	t, err := oauth.Password(u.client, u.tokens.conf, u.settings.Username, u.settings.Password)
+	if err != nil {
+		return err
+	}
+
+	return src.SetToken(t)
+}
+
+func (u Uploader) Upload(data destination.UploadData) error {
+	// check for existing file in tracking file (failed initial upload case)
+	r, err := destination.FindRecord(u.uploadDB, data)
+	if err != nil {
+		fmt.Printf("WARN: error checking for prior upload, attempting upload. error: %v\n", err)
+	}
+
+	var uploadOffset int64
+
+	// a new upload, or an earlier attempt failed before the upload session was created.
+	if r.IsEmpty() || (r.Status == database.Error && r.TusURI == "") {
+		sessionURI, err := u.initiateUpload(data)
+		if err != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+		}
+
+		r.Name = data.Name()
+		r.CalculatedName = data.VideoName
+		r.Term = data.Term
+		r.Status = database.InProgress
+		r.TusURI = sessionURI
+		if privacy, _ := PrivacyFor(u.settings.PrivacyView); privacy == PasswordProtected {
+			r.Password = data.Password
+		}
+
+		saveErr := u.uploadDB.PutUpload(r)
+		if saveErr != nil {
+			return fmt.Errorf("started upload but error saving initial data: %v\nupload session: %v", saveErr, r.TusURI)
+		}
+	} else {
+		if r.Status == database.Complete {
+			fmt.Printf("file %v was already uploaded, skipping...\n", data.Filename)
+			return u.finishUpload(r, data)
+		}
+
+		offset, videoID, oErr := u.session(r.TusURI, data).Offset(data.FileSize)
+		if oErr != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindResume,
+				fmt.Errorf("could not get offset for video %v: %v", r.Name, oErr))
+		}
+
+		if videoID != "" {
+			return u.complete(r, data, videoID)
+		}
+
+		uploadOffset = offset
+	}
+
+	videoID, err := u.session(r.TusURI, data).Upload(uploadOffset, data)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error uploading file %v: %v", data.Filename, err))
+	}
+
+	return u.complete(r, data, videoID)
+}
+
+// complete marks the record as uploaded and adds the video to its playlist.
+func (u Uploader) complete(r database.UploadRecord, data destination.UploadData, videoID string) error {
+	destination.Complete(u.uploadDB, &r, data, u.instanceURL.String()+videoPathPrefix+videoID)
+	return u.finishUpload(r, data)
+}
+
+// finishUpload adds an uploaded video to its playlist, recording a failure on the record or clearing an earlier one.
+func (u Uploader) finishUpload(r database.UploadRecord, data destination.UploadData) error {
+	return destination.Finish(u.uploadDB, r, data, u.addToPlaylist)
+}
+
+// initiateUpload creates the video and returns the resumable upload session URI.
+func (u Uploader) initiateUpload(d destination.UploadData) (string, error) {
+	title, err := d.Title(u.settings.NameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	description, err := d.Description(u.settings.DescriptionTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	privacy, err := PrivacyFor(u.settings.PrivacyView)
+	if err != nil {
+		return "", err
+	}
+
+	var passwords []string
+	if privacy == PasswordProtected {
+		if d.Password == "" {
+			return "", errors.New("password privacy requires a video password")
+		}
+		passwords = []string{d.Password}
+	}
+
+	channelID, err := u.channelID(d)
+	if err != nil {
+		return "", err
+	}
+
+	tags := u.settings.Tags
+	if len(tags) > maxTags {
+		fmt.Printf("WARN: PeerTube allows %v tags per video, only using %v\n", maxTags, tags[:maxTags])
+		tags = tags[:maxTags]
+	}
+
+	resp, err := u.call(http.MethodPost, uploadPath, VideoUpload{
+		Name:           title,
+		ChannelID:      channelID,
+		Filename:       d.Filename,
+		Privacy:        privacy,
+		Description:    description,
+		Tags:           tags,
+		VideoPasswords: passwords,
+	}, map[string]string{
+		"X-Upload-Content-Length": fmt.Sprint(d.FileSize),
+		"X-Upload-Content-Type":   "video/mp4",
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("error initiating upload: %v", err)
+	}
+
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", errors.New("upload initiation response did not include a session URI")
+	}
+
+	// the location is usually relative to the instance, ex. //videos.example.edu/api/v1/videos/upload-resumable?upload_id=...
+	sessionURI, err := u.instanceURL.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid upload session URI %v: %v", location, err)
+	}
+
+	return sessionURI.String(), nil
+}
+
+// channelID returns the class's channel, the configured channel, or the user's first channel.
+func (u Uploader) channelID(d destination.UploadData) (int, error) {
+	if d.Class.PeerTubeChannelID != 0 {
+		return d.Class.PeerTubeChannelID, nil
+	}
+
+	if u.settings.ChannelID != 0 {
+		return u.settings.ChannelID, nil
+	}
+
+	var user struct {
+		VideoChannels []struct {
+			ID int `json:"id"`
+		} `json:"videoChannels"`
+	}
+	_, err := u.call(http.MethodGet, userPath, nil, nil, &user)
+	if err != nil {
+		return 0, fmt.Errorf("could not look up the user's channels: %v", err)
+	}
+
+	if len(user.VideoChannels) == 0 {
+		return 0, errors.New("the PeerTube user doesn't have any channels")
+	}
+
+	return user.VideoChannels[0].ID, nil
+}
+
+// session returns the resumable upload session for data's file.
+func (u Uploader) session(sessionURI string, data destination.UploadData) destination.ResumableSession {
+	chunkSize := int64(data.ChunkSize) * 1000000
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+
+	return destination.ResumableSession{
+		URI:          sessionURI,
+		Client:       u.client,
+		UploadClient: u.uploadClient,
+		Prepare:      u.authorize,
+		ContentType:  "application/octet-stream",
+		ChunkSize:    chunkSize,
+		Destination:  "PeerTube",
+		VideoID:      videoID,
+	}
+}
+
+// authorize adds the access token to a request.
+func (u Uploader) authorize(req *http.Request) error {
+	token, err := u.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("could not get access token: %v", err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	return nil
+}
+
+// videoID reads the short UUID of the video returned once an upload finishes.
+func videoID(body []byte) string {
+	var v struct {
+		Video struct {
+			ShortUUID string `json:"shortUUID"`
+		} `json:"video"`
+	}
+	if json.Unmarshal(body, &v) != nil {
+		return ""
+	}
+
+	return v.Video.ShortUUID
+}
+
+// addToPlaylist adds the video to its class's playlist, or the default playlist, if it isn't in it already.
+func (u Uploader) addToPlaylist(r *database.UploadRecord, data destination.UploadData) error {
+	playlistID := data.Class.PeerTubePlaylistID
+	if playlistID == "" {
+		playlistID = u.settings.PlaylistID
+	}
+
+	return destination.AddToPlaylist(u.uploadDB, r, data, playlistID, func() error {
+		videoID := r.VideoURI[strings.LastIndex(r.VideoURI, "/")+1:]
+		_, err := u.call(http.MethodPost, fmt.Sprintf(playlistVideosPath, url.PathEscape(playlistID)), map[string]string{
+			"videoId": videoID,
+		}, nil, nil)
+		return err
+	})
+}
+
+// call makes an authorized JSON request to the instance's API, renewing the token once if it's rejected. The
+// response is returned with its body already read and closed; if out is not nil the body is unmarshaled into it.
+func (u Uploader) call(method, path string, payload interface{}, headers map[string]string, out interface{}) (*http.Response, error) {
+	var bodyBytes []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("unable to prepare request payload: %v", err)
+		}
+		bodyBytes = b
+	}
+
+	renewed := false
+	for {
+		token, err := u.tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not get access token: %v", err)
+		}
+
+		req, err := http.NewRequest(method, u.instanceURL.String()+path, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+
+		if payload != nil {
+			req.Header.Add("Content-Type", "application/json; charset=UTF-8")
+		}
+		req.Header.Add("Authorization", "Bearer "+token)
+		for k, v := range headers {
+			req.Header.Add(k, v)
+		}
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error making %v request: %v", method, err)
+		}
+
+		respBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read response bytes: %v", err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !renewed {
+			renewed = true
+			err = u.tokens.Renew()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+		}
+
+		if out != nil {
+			err = json.Unmarshal(respBytes, out)
+			if err != nil {
+				return nil, fmt.Errorf("could not unmarshal response: %v", err)
+			}
+		}
+
+		return resp, nil
+	}
+}
+
+// tokenSource gets tokens with the OAuth password grant. PeerTube creates one OAuth client per instance instead of
+// having users register their own, so the client is looked up before the first token is requested.
+type tokenSource struct {
+	client      httpCaller
+	settings    Settings
+	instanceURL string
+	store       oauth.FileStore
+
+	mu   sync.Mutex
+	conf oauth.Config
+	src  *oauth.Source
+}
+
+func (t *tokenSource) Token() (string, error) {
+	src, err := t.source()
+	if err != nil {
+		return "", err
+	}
+
+	return src.Token()
+}
+
+func (t *tokenSource) Renew() error {
+	src, err := t.source()
+	if err != nil {
+		return err
+	}
+
+	return src.Renew()
+}
+
+// source returns the oauth.Source, looking up the instance's OAuth client the first time it's called.
+func (t *tokenSource) source() (*oauth.Source, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.src != nil {
+		return t.src, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, t.instanceURL+oauthClientPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the instance's OAuth client: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read OAuth client response bytes: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting the instance's OAuth client received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+	}
+
+	var c struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	err = json.Unmarshal(respBytes, &c)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal OAuth client response: %v", err)
+	}
+
+	t.conf = oauth.Config{
+		ClientID:          c.ClientID,
+		ClientSecret:      c.ClientSecret,
+		TokenURL:          t.instanceURL + tokenAPIPath,
+		CredentialsInBody: true,
+	}
+	t.src = oauth.NewSource(t.client, t.conf, oauth.FlowPassword, t.store, "check peertube_settings.username and password")
+	t.src.SetPassword(t.settings.Username, t.settings.Password)
+
+	return t.src, nil
+}
@@ -0,0 +1,297 @@
+package peertube_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/peertube"
+)
+
+// fakePeerTube implements the parts of a PeerTube instance's OAuth, user, resumable upload, and playlist APIs the
+// uploader uses.
+type fakePeerTube struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	logins    int
+	metadata  peertube.VideoUpload
+	received  []byte
+	size      int64
+	failChunk int
+	chunks    int
+	playlists []string
+}
+
+func (f *fakePeerTube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/api/v1/oauth-clients/local":
+		w.Write([]byte(`{"client_id":"local-client","client_secret":"local-secret"}`))
+		return
+	case "/api/v1/users/token":
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "password" || r.PostForm.Get("client_id") != "local-client" ||
+			r.PostForm.Get("username") != "teacher" || r.PostForm.Get("password") != "hunter2" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		f.logins++
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "tok", "refresh_token": "ref", "expires_in": 3600})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer tok" {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/users/me":
+		w.Write([]byte(`{"videoChannels":[{"id":7},{"id":8}]}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/videos/upload-resumable":
+		json.NewDecoder(r.Body).Decode(&f.metadata)
+		f.size, _ = strconv.ParseInt(r.Header.Get("X-Upload-Content-Length"), 10, 64)
+		// PeerTube returns a protocol-relative location.
+		w.Header().Set("Location", "//"+r.Host+"/api/v1/videos/upload-resumable?upload_id=abc")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v1/videos/upload-resumable" && r.URL.Query().Get("upload_id") == "abc":
+		f.session(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v1/video-playlists/"):
+		var v struct {
+			VideoID string `json:"videoId"`
+		}
+		json.NewDecoder(r.Body).Decode(&v)
+		playlist := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/video-playlists/"), "/videos")
+		f.playlists = append(f.playlists, playlist+"/"+v.VideoID)
+		w.Write([]byte(`{"videoPlaylistElement":{"id":1}}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// session handles PUTs to the upload session, either status checks or chunks.
+func (f *fakePeerTube) session(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rng := r.Header.Get("Content-Range")
+
+	if !strings.HasPrefix(rng, "bytes */") {
+		f.chunks++
+		if f.chunks == f.failChunk {
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+
+		var start, end, total int64
+		fmt.Sscanf(rng, "bytes %d-%d/%d", &start, &end, &total)
+		if start != int64(len(f.received)) || end-start+1 != int64(len(body)) || total != f.size {
+			f.t.Errorf("unexpected Content-Range %v with %v bytes, have %v bytes", rng, len(body), len(f.received))
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		f.received = append(f.received, body...)
+	}
+
+	if int64(len(f.received)) == f.size {
+		w.Write([]byte(`{"video":{"id":42,"uuid":"9c9de5e8-0a1e-484a-b099-e80766180a6d","shortUUID":"kKGYvU2gR5s"}}`))
+		return
+	}
+
+	if len(f.received) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%v", len(f.received)-1))
+	}
+	w.WriteHeader(308)
+}
+
+func TestUploader_Upload(t *testing.T) {
+	fake := &fakePeerTube{t: t, failChunk: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	video := make([]byte, 600*1024)
+	rand.Read(video)
+	videoPath := filepath.Join(dir, "Tap Week 1.mp4")
+	err := os.WriteFile(videoPath, video, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := peertube.New(dir, db, srv.Client(), srv.Client(), peertube.Settings{
+		InstanceURL:  srv.URL + "/",
+		Username:     "teacher",
+		Password:     "hunter2",
+		PlaylistID:   "default-list",
+		PrivacyView:  "password",
+		NameTemplate: "{{.Name}} ({{.Term}})",
+		Tags:         []string{"dance", "tap"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := destination.UploadData{
+		Filename:         "Tap Week 1.mp4",
+		VideoTitle:       "Tap Week 1.mp4",
+		VideoDescription: "Tap Week 1",
+		Details:          metadata.VideoDetails{Name: "Tap Week 1", Term: "2023 Spring"},
+		Class:            metadata.Class{Name: "Tap", PeerTubePlaylistID: "tap-list"},
+		FilePath:         videoPath,
+		FileSize:         int64(len(video)),
+		Password:         "correct-horse",
+	}
+
+	// the second chunk fails, leaving the upload resumable with the failure recorded.
+	err = u.Upload(data)
+	if err == nil {
+		t.Fatal("Upload() expected the failed chunk to return an error")
+	}
+
+	r, err := db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Error || r.TusURI != srv.URL+"/api/v1/videos/upload-resumable?upload_id=abc" {
+		t.Fatalf("Upload() record after failure = %+v", r)
+	}
+
+	// running again resumes from what the instance received.
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fake.received, video) {
+		t.Errorf("Upload() instance received %v bytes that don't match the %v byte file", len(fake.received), len(video))
+	}
+
+	m := fake.metadata
+	if m.Name != "Tap Week 1 (2023 Spring)" || m.ChannelID != 7 || m.Privacy != peertube.PasswordProtected ||
+		len(m.VideoPasswords) != 1 || m.VideoPasswords[0] != "correct-horse" || m.Filename != "Tap Week 1.mp4" {
+		t.Errorf("Upload() video metadata = %+v", m)
+	}
+
+	r, err = db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Complete || r.VideoURI != srv.URL+"/w/kKGYvU2gR5s" {
+		t.Errorf("Upload() record after finishing = %+v", r)
+	}
+
+	// uploading again is a no-op, the video is only added to the class playlist once.
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.playlists) != 1 || fake.playlists[0] != "tap-list/kKGYvU2gR5s" {
+		t.Errorf("Upload() playlist additions = %v, want [tap-list/kKGYvU2gR5s]", fake.playlists)
+	}
+
+	if fake.logins != 1 {
+		t.Errorf("Upload() logged in %v times, want the saved token to be reused", fake.logins)
+	}
+}
+
+func TestUploader_UploadClassChannel(t *testing.T) {
+	fake := &fakePeerTube{t: t}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	videoPath := filepath.Join(dir, "Ballet Week 2.mp4")
+	err := os.WriteFile(videoPath, []byte("video"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := peertube.New(dir, db, srv.Client(), srv.Client(), peertube.Settings{
+		InstanceURL: srv.URL,
+		Username:    "teacher",
+		Password:    "hunter2",
+		ChannelID:   8,
+		PrivacyView: "unlisted",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.Upload(destination.UploadData{
+		Filename:   "Ballet Week 2.mp4",
+		VideoTitle: "Ballet Week 2.mp4",
+		Class:      metadata.Class{Name: "Ballet", PeerTubeChannelID: 12},
+		FilePath:   videoPath,
+		FileSize:   5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.metadata.ChannelID != 12 || fake.metadata.Privacy != peertube.Unlisted {
+		t.Errorf("Upload() video metadata = %+v, want the class's channel", fake.metadata)
+	}
+
+	if len(fake.playlists) != 0 {
+		t.Errorf("Upload() playlist additions = %v, want none", fake.playlists)
+	}
+}
+
+func TestPrivacyFor(t *testing.T) {
+	tests := []struct {
+		view    string
+		want    peertube.Privacy
+		wantErr bool
+	}{
+		{view: "anybody", want: peertube.Public},
+		{view: "unlisted", want: peertube.Unlisted},
+		{view: "nobody", want: peertube.Private},
+		{view: "disable", want: peertube.Private},
+		{view: "", want: peertube.Private},
+		{view: "users", want: peertube.Internal},
+		{view: "contacts", want: peertube.Internal},
+		{view: "password", want: peertube.PasswordProtected},
+		{view: "everyone", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view, func(t *testing.T) {
+			got, err := peertube.PrivacyFor(tt.view)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PrivacyFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("PrivacyFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
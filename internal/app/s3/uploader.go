@@ -0,0 +1,483 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// Settings contains the credentials and layout used for S3-compatible object storage.
+type Settings struct {
+	// Endpoint is the storage server's base URL, ex. https://s3.example.edu. Buckets are addressed path-style.
+	Endpoint string `yaml:"endpoint"`
+	// Region defaults to us-east-1, which most S3-compatible servers accept.
+	Region      string `yaml:"region"`
+	AccessKeyID string `yaml:"access_key_id"`
+	// SecretAccessKey can be left empty and set with the S3_SECRET_ACCESS_KEY environment variable instead.
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// Bucket and KeyTemplate are text/template strings rendered with metadata.VideoDetails, ex.
+	// "{{.Term}}/{{.Class}}/{{.Filename}}". KeyTemplate defaults to "{{.Term}}/{{.Filename}}".
+	Bucket      string `yaml:"bucket"`
+	KeyTemplate string `yaml:"key_template"`
+	// PartSizeMB defaults to chunk_size_mb. S3 requires at least 5 MB for every part except the last.
+	PartSizeMB int `yaml:"part_size_mb"`
+}
+
+// Uploader copies videos to S3-compatible object storage with multipart uploads.
+type Uploader struct {
+	// client is used for all HTTP calls except uploading parts.
+	client httpCaller
+	// uploadClient is used to upload parts so it has a long timeout property.
+	uploadClient httpCaller
+	settings     Settings
+	signer       signer
+	uploadDB     database.UploadDatastore
+}
+
+type httpCaller interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// InitiateMultipartUploadResult is the response to starting a multipart upload.
+type InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// ListPartsResult is the response listing a multipart upload's finished parts.
+type ListPartsResult struct {
+	Parts       []Part `xml:"Part"`
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextMarker  int    `xml:"NextPartNumberMarker"`
+}
+
+// Part is a finished part of a multipart upload.
+type Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+	Size       int64  `xml:"Size,omitempty"`
+}
+
+// CompleteMultipartUpload is the payload used to finish a multipart upload.
+type CompleteMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []Part   `xml:"Part"`
+}
+
+// CompleteMultipartUploadResult is the response to finishing a multipart upload.
+type CompleteMultipartUploadResult struct {
+	Location string `xml:"Location"`
+	ETag     string `xml:"ETag"`
+}
+
+// ErrorResponse is the body S3 returns for errors, sometimes with a 200 status when completing an upload.
+type ErrorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	// StatusCode is the HTTP status the error was returned with.
+	StatusCode int `xml:"-"`
+}
+
+func (e ErrorResponse) Error() string {
+	return fmt.Sprintf("received status code %v, %v: %v", e.StatusCode, e.Code, e.Message)
+}
+
+const (
+	defaultRegion      = "us-east-1"
+	defaultKeyTemplate = "{{.Term}}/{{.Filename}}"
+	secretKeyEnv       = "S3_SECRET_ACCESS_KEY"
+	minPartSize        = 5 * 1000 * 1000
+)
+
+// New creates an S3 uploader that tracks uploads in db.
+func New(db database.UploadDatastore, hc httpCaller, uhc httpCaller, s Settings) (Uploader, error) {
+	if s.Endpoint == "" || s.Bucket == "" || s.AccessKeyID == "" {
+		return Uploader{}, errors.New("s3_settings endpoint, bucket, and access_key_id are required")
+	}
+
+	secret := s.SecretAccessKey
+	if secret == "" {
+		secret = os.Getenv(secretKeyEnv)
+	}
+
+	region := s.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	return Uploader{
+		client:       hc,
+		uploadClient: uhc,
+		settings:     s,
+		signer: signer{
+			accessKeyID:     s.AccessKeyID,
+			secretAccessKey: secret,
+			region:          region,
+			service:         "s3",
+		},
+		uploadDB: db,
+	}, nil
+}
+
+func (u Uploader) Upload(data destination.UploadData) error {
+	// check for existing file in tracking file (failed initial upload case)
+	r, err := destination.FindRecord(u.uploadDB, data)
+	if err != nil {
+		fmt.Printf("WARN: error checking for prior upload, attempting upload. error: %v\n", err)
+	}
+
+	if r.Status == database.Complete {
+		fmt.Printf("file %v was already uploaded, skipping...\n", data.Filename)
+		return nil
+	}
+
+	obj, err := u.objectLocation(data.Details)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+	}
+
+	// the object location can change if the config's templates change, in which case the upload starts over.
+	resume := !r.IsEmpty() && r.UploadID != "" && r.VideoURI == u.objectURI(obj)
+	if resume {
+		parts, lErr := u.listParts(obj, r.UploadID)
+		var s3Err ErrorResponse
+		if errors.As(lErr, &s3Err) && s3Err.Code == "NoSuchUpload" {
+			fmt.Printf("WARN: previous upload of %v no longer exists on the server, starting over...\n", data.Filename)
+			resume = false
+		} else if lErr != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindResume,
+				fmt.Errorf("could not get finished parts for %v: %v", r.Name, lErr))
+		} else {
+			r.Parts = resumableParts(parts, r.PartSize)
+		}
+	}
+
+	if !resume {
+		uploadID, err := u.initiateUpload(obj)
+		if err != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+		}
+
+		r.Name = data.Name()
+		r.CalculatedName = data.VideoName
+		r.Term = data.Term
+		r.Status = database.InProgress
+		r.VideoURI = u.objectURI(obj)
+		r.UploadID = uploadID
+		r.PartSize = u.partSize(data.ChunkSize)
+		r.Parts = nil
+
+		saveErr := u.uploadDB.PutUpload(r)
+		if saveErr != nil {
+			return fmt.Errorf("started upload but error saving initial data: %v\nupload ID: %v", saveErr, uploadID)
+		}
+	}
+
+	err = u.uploadParts(&r, obj, data)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error uploading file %v: %v", data.Filename, err))
+	}
+
+	err = u.completeUpload(obj, r)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error completing upload of %v: %v", data.Filename, err))
+	}
+
+	fmt.Println("------------------------------")
+	fmt.Printf("finished uploading file: \n%v\nobject: %v\n", data.Filename, r.VideoURI)
+	fmt.Println("------------------------------")
+
+	r.Status = database.Complete
+	r.UploadID = ""
+	r.Parts = nil
+	r.ErrorDetails = nil
+	pErr := u.uploadDB.PutUpload(r)
+	if pErr != nil {
+		fmt.Printf("error updating file %v status locally but the upload succeeded: %v\n", data.Filename, pErr)
+	}
+
+	return nil
+}
+
+// object is the location of an uploaded file.
+type object struct {
+	bucket string
+	key    string
+}
+
+// path returns the object's path-style request path.
+func (o object) path() string {
+	return "/" + o.bucket + "/" + o.key
+}
+
+// objectLocation renders the bucket and key templates.
+func (u Uploader) objectLocation(d metadata.VideoDetails) (object, error) {
+	bucket, err := metadata.ApplyTemplate(u.settings.Bucket, "", d)
+	if err != nil {
+		return object{}, err
+	}
+
+	keyTemplate := u.settings.KeyTemplate
+	if keyTemplate == "" {
+		keyTemplate = defaultKeyTemplate
+	}
+
+	key, err := metadata.ApplyTemplate(keyTemplate, "", d)
+	if err != nil {
+		return object{}, err
+	}
+
+	// empty template fields, ex. an unknown class, would otherwise leave empty path segments.
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if bucket == "" || key == "" || key == "." {
+		return object{}, fmt.Errorf("bucket %q and key %q must not be empty", bucket, key)
+	}
+
+	return object{bucket: bucket, key: key}, nil
+}
+
+// objectURI returns the object's URL, which is saved as the record's video URI.
+func (u Uploader) objectURI(o object) string {
+	return strings.TrimSuffix(u.settings.Endpoint, "/") + o.path()
+}
+
+// partSize returns the part size in bytes, at least the S3 minimum.
+func (u Uploader) partSize(chunkSizeMB int) int64 {
+	size := int64(u.settings.PartSizeMB) * 1000000
+	if size == 0 {
+		size = int64(chunkSizeMB) * 1000000
+	}
+
+	if size < minPartSize {
+		size = minPartSize
+	}
+
+	return size
+}
+
+// resumableParts keeps the listed parts that are numbered consecutively from 1 and have the expected size, since an
+// upload can only resume after the last contiguous part.
+func resumableParts(parts []Part, partSize int64) []database.UploadPart {
+	byNumber := make(map[int]Part, len(parts))
+	for _, p := range parts {
+		byNumber[p.PartNumber] = p
+	}
+
+	var kept []database.UploadPart
+	for n := 1; ; n++ {
+		p, ok := byNumber[n]
+		if !ok || p.Size != partSize {
+			return kept
+		}
+
+		kept = append(kept, database.UploadPart{Number: n, ETag: p.ETag, Size: p.Size})
+	}
+}
+
+// initiateUpload starts a multipart upload and returns its ID.
+func (u Uploader) initiateUpload(obj object) (string, error) {
+	var result InitiateMultipartUploadResult
+	_, err := u.call(u.client, http.MethodPost, obj, url.Values{"uploads": {""}}, nil, nil, &result)
+	if err != nil {
+		return "", fmt.Errorf("error initiating multipart upload: %v", err)
+	}
+
+	if result.UploadID == "" {
+		return "", errors.New("multipart upload initiation did not return an upload ID")
+	}
+
+	return result.UploadID, nil
+}
+
+// listParts returns every finished part of the upload.
+func (u Uploader) listParts(obj object, uploadID string) ([]Part, error) {
+	var parts []Part
+	marker := 0
+	for {
+		q := url.Values{"uploadId": {uploadID}}
+		if marker > 0 {
+			q.Set("part-number-marker", fmt.Sprint(marker))
+		}
+
+		var result ListPartsResult
+		_, err := u.call(u.client, http.MethodGet, obj, q, nil, nil, &result)
+		if err != nil {
+			// returned as is so callers can check for NoSuchUpload.
+			return nil, err
+		}
+
+		parts = append(parts, result.Parts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextMarker
+	}
+}
+
+// uploadParts uploads the file's remaining parts, saving the record after each one.
+func (u Uploader) uploadParts(r *database.UploadRecord, obj object, data destination.UploadData) error {
+	f, err := os.Open(data.FilePath)
+	if err != nil {
+		return fmt.Errorf("error opening file to upload: %v", err)
+	}
+	defer f.Close()
+
+	totalParts := int(math.Ceil(float64(data.FileSize) / float64(r.PartSize)))
+	if totalParts == 0 {
+		totalParts = 1
+	}
+
+	fmt.Printf("Uploading %v....\n", f.Name())
+	data.Progress.Start(int64(len(r.Parts)) * r.PartSize)
+	for n := len(r.Parts) + 1; n <= totalParts; n++ {
+		offset := int64(n-1) * r.PartSize
+		size := r.PartSize
+		if data.FileSize-offset < size {
+			size = data.FileSize - offset
+		}
+
+		partBytes := make([]byte, size)
+		_, err = f.ReadAt(partBytes, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error reading file %v bytes at offset %v: %v", data.FilePath, offset, err)
+		}
+
+		md5Sum := md5.Sum(partBytes)
+		resp, err := u.call(u.uploadClient, http.MethodPut, obj, url.Values{
+			"partNumber": {fmt.Sprint(n)},
+			"uploadId":   {r.UploadID},
+		}, partBytes, map[string]string{
+			// the server rejects the part if its contents don't match.
+			"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:]),
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("error uploading part %v: %v", n, err)
+		}
+
+		etag := resp.Header.Get("ETag")
+		if strings.Trim(etag, `"`) != hex.EncodeToString(md5Sum[:]) {
+			return fmt.Errorf("part %v checksum mismatch, server returned ETag %v", n, etag)
+		}
+
+		r.Parts = append(r.Parts, database.UploadPart{Number: n, ETag: etag, Size: size})
+		pErr := u.uploadDB.PutUpload(*r)
+		if pErr != nil {
+			fmt.Printf("WARN: could not save part %v of %v: %v\n", n, data.Filename, pErr)
+		}
+
+		data.Progress.Sent(offset + size)
+		fmt.Printf("%v%% uploaded...", math.Floor(float64(offset+size)/float64(data.FileSize)*100))
+	}
+
+	fmt.Println()
+	return nil
+}
+
+// completeUpload assembles the parts and checks the resulting object's ETag against the parts' checksums.
+func (u Uploader) completeUpload(obj object, r database.UploadRecord) error {
+	payload := CompleteMultipartUpload{}
+	partMD5s := []byte{}
+	for _, p := range r.Parts {
+		payload.Parts = append(payload.Parts, Part{PartNumber: p.Number, ETag: p.ETag})
+
+		sum, err := hex.DecodeString(strings.Trim(p.ETag, `"`))
+		if err != nil {
+			return fmt.Errorf("part %v has an invalid ETag %v", p.Number, p.ETag)
+		}
+		partMD5s = append(partMD5s, sum...)
+	}
+
+	body, err := xml.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("unable to prepare complete payload: %v", err)
+	}
+
+	var result CompleteMultipartUploadResult
+	_, err = u.call(u.client, http.MethodPost, obj, url.Values{"uploadId": {r.UploadID}}, body, nil, &result)
+	if err != nil {
+		return err
+	}
+
+	// a multipart object's ETag is the MD5 of its parts' MD5s followed by the number of parts.
+	combined := md5.Sum(partMD5s)
+	want := fmt.Sprintf("%v-%v", hex.EncodeToString(combined[:]), len(r.Parts))
+	if got := strings.Trim(result.ETag, `"`); got != want {
+		return fmt.Errorf("object checksum mismatch, expected ETag %v but server returned %v", want, got)
+	}
+
+	return nil
+}
+
+// call makes a signed request to the object. The response body is unmarshaled into out if it's not
+// nil, and S3 error bodies are returned as errors even when the status is 200.
+func (u Uploader) call(c httpCaller, method string, obj object, q url.Values, body []byte, headers map[string]string, out interface{}) (*http.Response, error) {
+	endpoint, err := url.Parse(u.settings.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %v: %v", u.settings.Endpoint, err)
+	}
+
+	reqURI := *endpoint
+	reqURI.Path = strings.TrimSuffix(endpoint.Path, "/") + obj.path()
+	reqURI.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(method, reqURI.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	sum := sha256.Sum256(body)
+	u.signer.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making %v request: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response bytes: %v", err)
+	}
+
+	var s3Err ErrorResponse
+	if xml.Unmarshal(respBytes, &s3Err) == nil && s3Err.Code != "" {
+		s3Err.StatusCode = resp.StatusCode
+		return nil, s3Err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+	}
+
+	if out != nil {
+		err = xml.Unmarshal(respBytes, out)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal response: %v", err)
+		}
+	}
+
+	return resp, nil
+}
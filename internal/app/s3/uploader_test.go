@@ -0,0 +1,287 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+)
+
+// fakeObjectStore is an in-process stand-in for an S3-compatible server like MinIO. It checks request signatures
+// and part checksums the same way a real server would.
+type fakeObjectStore struct {
+	t      *testing.T
+	signer signer
+
+	mu       sync.Mutex
+	nextID   int
+	uploads  map[string]map[int][]byte
+	objects  map[string][]byte
+	failPart int
+	putCount int
+}
+
+func newFakeObjectStore(t *testing.T, s signer) *fakeObjectStore {
+	return &fakeObjectStore{
+		t:       t,
+		signer:  s,
+		uploads: map[string]map[int][]byte{},
+		objects: map[string][]byte{},
+	}
+}
+
+func (f *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if !f.validSignature(r, body) {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	q := r.URL.Query()
+	_, initiate := q["uploads"]
+	uploadID := q.Get("uploadId")
+	parts, known := f.uploads[uploadID]
+
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		f.nextID++
+		id := fmt.Sprintf("upload-%v", f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		f.writeXML(w, InitiateMultipartUploadResult{UploadID: id})
+	case !known:
+		f.writeError(w, http.StatusNotFound, "NoSuchUpload")
+	case r.Method == http.MethodPut:
+		f.putCount++
+		if f.putCount == f.failPart {
+			f.writeError(w, http.StatusInternalServerError, "InternalError")
+			return
+		}
+
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			f.writeError(w, http.StatusBadRequest, "BadDigest")
+			return
+		}
+
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodGet:
+		result := ListPartsResult{}
+		for n, b := range parts {
+			sum := md5.Sum(b)
+			result.Parts = append(result.Parts, Part{PartNumber: n, ETag: `"` + hex.EncodeToString(sum[:]) + `"`, Size: int64(len(b))})
+		}
+		sort.Slice(result.Parts, func(i, j int) bool { return result.Parts[i].PartNumber < result.Parts[j].PartNumber })
+		f.writeXML(w, result)
+	case r.Method == http.MethodPost:
+		var complete CompleteMultipartUpload
+		xml.Unmarshal(body, &complete)
+
+		object := []byte{}
+		md5s := []byte{}
+		for _, p := range complete.Parts {
+			object = append(object, parts[p.PartNumber]...)
+			sum := md5.Sum(parts[p.PartNumber])
+			md5s = append(md5s, sum[:]...)
+		}
+
+		f.objects[r.URL.Path] = object
+		delete(f.uploads, uploadID)
+
+		sum := md5.Sum(md5s)
+		f.writeXML(w, CompleteMultipartUploadResult{ETag: fmt.Sprintf(`"%v-%v"`, hex.EncodeToString(sum[:]), len(complete.Parts))})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// validSignature signs a copy of the request with the same date and compares the Authorization headers.
+func (f *fakeObjectStore) validSignature(r *http.Request, body []byte) bool {
+	date, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		return false
+	}
+
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for k, v := range r.Header {
+		if k != "Authorization" {
+			check.Header[k] = v
+		}
+	}
+	f.signer.sign(check, hex.EncodeToString(sum[:]), date)
+
+	return check.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (f *fakeObjectStore) writeXML(w http.ResponseWriter, v interface{}) {
+	b, _ := xml.Marshal(v)
+	w.Write(b)
+}
+
+func (f *fakeObjectStore) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	f.writeXML(w, ErrorResponse{Code: code, Message: code})
+}
+
+func TestUploader_Upload(t *testing.T) {
+	dir := t.TempDir()
+	settings := Settings{
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "archive",
+		KeyTemplate:     "{{.Term}}/{{.Class}}/{{.Filename}}",
+	}
+
+	fake := newFakeObjectStore(t, signer{accessKeyID: "access", secretAccessKey: "secret", region: defaultRegion, service: "s3"})
+	fake.failPart = 2
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	settings.Endpoint = srv.URL
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := New(db, http.DefaultClient, http.DefaultClient, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// three parts, the last one smaller.
+	video := make([]byte, 2*minPartSize+1234)
+	rand.Read(video)
+	videoPath := filepath.Join(dir, "Tap Week 1.mp4")
+	err = os.WriteFile(videoPath, video, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := destination.UploadData{
+		Filename: "Tap Week 1.mp4",
+		Details:  metadata.VideoDetails{Filename: "Tap Week 1.mp4", Term: "2023 Spring", Class: "Tap"},
+		FilePath: videoPath,
+		FileSize: int64(len(video)),
+	}
+
+	err = u.Upload(data)
+	if err == nil {
+		t.Fatal("Upload() expected the failed part to return an error")
+	}
+
+	r, err := db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Error || r.ErrorDetails == nil || r.ErrorDetails.Kind != database.ErrorKindTransfer || r.UploadID == "" || len(r.Parts) != 1 {
+		t.Fatalf("Upload() record after failure = %+v", r)
+	}
+
+	// running again resumes after the first part.
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 1 good part, 1 failed part, then parts 2 and 3.
+	if fake.putCount != 4 {
+		t.Errorf("Upload() made %v part uploads, want 4", fake.putCount)
+	}
+
+	got := fake.objects["/archive/2023 Spring/Tap/Tap Week 1.mp4"]
+	if !bytes.Equal(got, video) {
+		t.Errorf("Upload() stored object is %v bytes and doesn't match the %v byte file", len(got), len(video))
+	}
+
+	r, err = db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Complete || r.VideoURI != srv.URL+"/archive/2023 Spring/Tap/Tap Week 1.mp4" || len(r.Parts) != 0 {
+		t.Errorf("Upload() record after finishing = %+v", r)
+	}
+}
+
+func TestUploader_Upload_expiredUpload(t *testing.T) {
+	dir := t.TempDir()
+	fake := newFakeObjectStore(t, signer{accessKeyID: "access", secretAccessKey: "secret", region: defaultRegion, service: "s3"})
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := New(db, http.DefaultClient, http.DefaultClient, Settings{
+		Endpoint:        srv.URL,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "archive",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	videoPath := filepath.Join(dir, "lecture.mp4")
+	err = os.WriteFile(videoPath, []byte("short video"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an upload the server has since aborted.
+	err = db.PutUpload(database.UploadRecord{
+		Name:     "lecture",
+		Status:   database.InProgress,
+		VideoURI: srv.URL + "/archive/2023 Spring/lecture.mp4",
+		UploadID: "gone",
+		PartSize: minPartSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.Upload(destination.UploadData{
+		Filename: "lecture.mp4",
+		Details:  metadata.VideoDetails{Filename: "lecture.mp4", Term: "2023 Spring"},
+		FilePath: videoPath,
+		FileSize: int64(len("short video")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(fake.objects["/archive/2023 Spring/lecture.mp4"]) != "short video" {
+		t.Errorf("Upload() objects = %v", fake.objects)
+	}
+}
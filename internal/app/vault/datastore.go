@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+)
+
+// Datastore encrypts each record's password before saving it to another datastore and decrypts it when the record
+// is read, so the rest of the program works with plain text passwords. Passwords saved in plain text before the
+// vault was added are encrypted the next time their record is saved.
+type Datastore struct {
+	database.UploadDatastore
+	vault Vault
+}
+
+// NewDatastore wraps parent so passwords are encrypted with v. If v is the zero Vault, records without passwords work
+// as usual, but saving a password or reading a record with an encrypted one fails with ErrNoKey.
+func NewDatastore(parent database.UploadDatastore, v Vault) Datastore {
+	return Datastore{
+		UploadDatastore: parent,
+		vault:           v,
+	}
+}
+
+// GetUpload returns the record saved under the key with its password decrypted.
+func (d Datastore) GetUpload(key string) (database.UploadRecord, error) {
+	r, err := d.UploadDatastore.GetUpload(key)
+	if err != nil {
+		return r, err
+	}
+
+	return d.open(r)
+}
+
+// FindUploads returns every record with the given name with their passwords decrypted.
+func (d Datastore) FindUploads(name string) ([]database.UploadRecord, error) {
+	records, err := d.UploadDatastore.FindUploads(name)
+	if err != nil {
+		return records, err
+	}
+
+	for i, r := range records {
+		records[i], err = d.open(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// PutUpload encrypts the record's passwords and saves it.
+func (d Datastore) PutUpload(item database.UploadRecord) error {
+	sealed, err := d.seal(item)
+	if err != nil {
+		return err
+	}
+
+	return d.UploadDatastore.PutUpload(sealed)
+}
+
+// ListUploads returns every record with their passwords decrypted.
+func (d Datastore) ListUploads() ([]database.UploadRecord, error) {
+	records, err := d.UploadDatastore.ListUploads()
+	if err != nil {
+		return records, err
+	}
+
+	for i, r := range records {
+		records[i], err = d.open(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// open decrypts the passwords of the record and its destinations. A password that can't be decrypted, ex. because
+// the key changed, only produces a warning so uploads can continue; it stays encrypted so it isn't lost when the
+// record is saved again. Having no key at all is an error, since every saved password would be unreadable.
+func (d Datastore) open(r database.UploadRecord) (database.UploadRecord, error) {
+	if r.EncryptedPassword != "" {
+		p, err := d.vault.Decrypt(r.EncryptedPassword)
+		if errors.Is(err, ErrNoKey) {
+			return r, fmt.Errorf("could not read the saved password of %v: %v, set %v or the key file it was saved with", r.Name, err, KeyEnv)
+		}
+		if err != nil {
+			fmt.Printf("WARN: could not read the saved password of %v: %v\n", r.Name, err)
+		} else {
+			r.Password = p
+			r.EncryptedPassword = ""
+		}
+	}
+
+	if r.Destinations != nil {
+		destinations := make(map[string]database.UploadRecord, len(r.Destinations))
+		for name, dr := range r.Destinations {
+			opened, err := d.open(dr)
+			if err != nil {
+				return r, err
+			}
+			destinations[name] = opened
+		}
+		r.Destinations = destinations
+	}
+
+	return r, nil
+}
+
+// seal encrypts the passwords of the record and its destinations.
+func (d Datastore) seal(r database.UploadRecord) (database.UploadRecord, error) {
+	if r.Password != "" {
+		encrypted, err := d.vault.Encrypt(r.Password)
+		if err != nil {
+			return r, fmt.Errorf("could not encrypt the password of %v: %v", r.Name, err)
+		}
+
+		r.EncryptedPassword = encrypted
+		r.Password = ""
+	}
+
+	if r.Destinations != nil {
+		destinations := make(map[string]database.UploadRecord, len(r.Destinations))
+		for name, dr := range r.Destinations {
+			sealed, err := d.seal(dr)
+			if err != nil {
+				return r, err
+			}
+			destinations[name] = sealed
+		}
+		r.Destinations = destinations
+	}
+
+	return r, nil
+}
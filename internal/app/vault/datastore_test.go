@@ -0,0 +1,209 @@
+package vault_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/vault"
+)
+
+func TestDatastore(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := vault.NewDatastore(fdb, newTestVault(t, 1))
+
+	want := database.UploadRecord{
+		ID:       "100-abc",
+		Name:     "lecture",
+		Status:   database.Complete,
+		Password: "apple_banana",
+		Destinations: map[string]database.UploadRecord{
+			"vimeo":    {Name: "lecture", Status: database.Complete, Password: "apple_banana"},
+			"peertube": {Name: "lecture", Status: database.Complete, Password: "cherry_date"},
+		},
+	}
+
+	err = db.PutUpload(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// passwords aren't saved in plain text, including the destinations'.
+	b, err := os.ReadFile(filepath.Join(dir, "uploads.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"apple_banana", "cherry_date"} {
+		if strings.Contains(string(b), p) {
+			t.Errorf("uploads.json contains password %v", p)
+		}
+	}
+
+	got, err := db.GetUpload("100-abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GetUpload() mismatch (-want +got):\n%s", diff)
+	}
+
+	list, err := db.ListUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]database.UploadRecord{want}, list); diff != "" {
+		t.Errorf("ListUploads() mismatch (-want +got):\n%s", diff)
+	}
+
+	found, err := db.FindUploads("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]database.UploadRecord{want}, found); diff != "" {
+		t.Errorf("FindUploads() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDatastore_plainTextPassword(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saved before passwords were encrypted.
+	err = fdb.PutUpload(database.UploadRecord{Name: "lecture", Status: database.Complete, Password: "apple_banana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := vault.NewDatastore(fdb, newTestVault(t, 1))
+	r, err := db.GetUpload("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Password != "apple_banana" {
+		t.Errorf("GetUpload() password = %v, want apple_banana", r.Password)
+	}
+
+	err = db.PutUpload(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := fdb.GetUpload("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw.Password != "" || raw.EncryptedPassword == "" {
+		t.Errorf("saved record password = %q, encrypted = %q, want it encrypted", raw.Password, raw.EncryptedPassword)
+	}
+}
+
+func TestDatastore_otherKey(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = vault.NewDatastore(fdb, newTestVault(t, 1)).PutUpload(database.UploadRecord{Name: "lecture", Password: "apple_banana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := fdb.GetUpload("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a password encrypted with another key can't be read, but isn't lost when the record is saved again.
+	db := vault.NewDatastore(fdb, newTestVault(t, 2))
+	r, err := db.GetUpload("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Password != "" {
+		t.Errorf("GetUpload() password = %v, want it empty", r.Password)
+	}
+
+	r.Status = database.Complete
+	err = db.PutUpload(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fdb.GetUpload("lecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.EncryptedPassword != raw.EncryptedPassword {
+		t.Errorf("saved encrypted password = %v, want %v", got.EncryptedPassword, raw.EncryptedPassword)
+	}
+}
+
+func TestDatastore_noKey(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fdb.PutUpload(database.UploadRecord{Name: "plain", Status: database.Complete})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := vault.NewDatastore(fdb, vault.Vault{})
+
+	// records without passwords work as usual.
+	r, err := db.GetUpload("plain")
+	if err != nil || r.Name != "plain" {
+		t.Fatalf("GetUpload() = %v, %v, want the record", r, err)
+	}
+
+	err = db.PutUpload(database.UploadRecord{Name: "lecture", Password: "apple_banana"})
+	if err == nil {
+		t.Error("PutUpload() with a password error = nil, want an error")
+	}
+
+	err = vault.NewDatastore(fdb, newTestVault(t, 1)).PutUpload(database.UploadRecord{
+		Name:         "lecture",
+		Destinations: map[string]database.UploadRecord{"vimeo": {Name: "lecture", Password: "apple_banana"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.GetUpload("lecture")
+	if err == nil {
+		t.Error("GetUpload() of a record with an encrypted password error = nil, want an error")
+	}
+
+	_, err = db.FindUploads("lecture")
+	if err == nil {
+		t.Error("FindUploads() of a record with an encrypted password error = nil, want an error")
+	}
+
+	_, err = db.ListUploads()
+	if err == nil {
+		t.Error("ListUploads() with a record with an encrypted password error = nil, want an error")
+	}
+}
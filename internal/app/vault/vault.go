@@ -0,0 +1,173 @@
+// Package vault encrypts video passwords before they're saved with upload records, so the upload status file or
+// database doesn't hold them in plain text.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// KeyEnv holds the base64-encoded key, and is used instead of the key file if it's set.
+	KeyEnv = "VIDEO_PASSWORD_KEY"
+	// KeySize is the key length in bytes, for AES-256.
+	KeySize = 32
+
+	// version is prepended to encrypted values in case the format needs to change.
+	version = "v1:"
+)
+
+// ErrNoKey is returned when there's no key to encrypt or decrypt passwords with.
+var ErrNoKey = errors.New("no password key configured")
+
+// Vault encrypts and decrypts passwords with AES-256-GCM. The zero value has no key, so Encrypt and Decrypt return
+// ErrNoKey.
+type Vault struct {
+	aead cipher.AEAD
+}
+
+// New creates a Vault that uses the given KeySize-byte key.
+func New(key []byte) (Vault, error) {
+	if len(key) != KeySize {
+		return Vault{}, fmt.Errorf("password key must be %v bytes, got %v", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return Vault{}, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return Vault{}, err
+	}
+
+	return Vault{aead: aead}, nil
+}
+
+// Encrypt returns the password encrypted with a random nonce, encoded as text.
+func (v Vault) Encrypt(password string) (string, error) {
+	if v.aead == nil {
+		return "", ErrNoKey
+	}
+
+	nonce := make([]byte, v.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", fmt.Errorf("could not generate nonce: %v", err)
+	}
+
+	sealed := v.aead.Seal(nonce, nonce, []byte(password), nil)
+	return version + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the password from a value made by Encrypt. It fails if the value was encrypted with another key
+// or has been changed.
+func (v Vault) Decrypt(encrypted string) (string, error) {
+	if v.aead == nil {
+		return "", ErrNoKey
+	}
+
+	if !strings.HasPrefix(encrypted, version) {
+		return "", errors.New("unknown encrypted password format")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, version))
+	if err != nil {
+		return "", fmt.Errorf("could not decode encrypted password: %v", err)
+	}
+
+	if len(sealed) < v.aead.NonceSize() {
+		return "", errors.New("encrypted password is too short")
+	}
+
+	nonce, ciphertext := sealed[:v.aead.NonceSize()], sealed[v.aead.NonceSize():]
+	password, err := v.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("could not decrypt password, check that the password key hasn't changed")
+	}
+
+	return string(password), nil
+}
+
+// LoadKey returns the key from the KeyEnv environment variable, or else the key file at path. ErrNoKey is returned if
+// the variable isn't set and path is empty. A missing key file is an error rather than a reason to make a new key,
+// since passwords saved with the old one couldn't be read anymore; keys are only made by CreateKey.
+func LoadKey(path string) ([]byte, error) {
+	if env := os.Getenv(KeyEnv); env != "" {
+		return decodeKey(env, KeyEnv)
+	}
+
+	if path == "" {
+		return nil, ErrNoKey
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("password key file %v does not exist, restore it from a copy or create a new key with the password create-key command", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read password key file: %v", err)
+	}
+
+	return decodeKey(string(b), path)
+}
+
+func decodeKey(encoded, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("password key in %v is not valid base64: %v", source, err)
+	}
+
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("password key in %v must be %v bytes, got %v", source, KeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// CreateKey saves a new random key to path with permissions only the current user can read. It fails if the file
+// already exists so a key can't be replaced by accident.
+func CreateKey(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("could not create password key folder: %v", err)
+	}
+
+	key := make([]byte, KeySize)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return fmt.Errorf("could not generate password key: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("password key file %v already exists", path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create password key file: %v", err)
+	}
+
+	_, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("could not write password key file: %v", err)
+	}
+
+	return nil
+}
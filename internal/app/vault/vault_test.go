@@ -0,0 +1,179 @@
+package vault_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/vault"
+)
+
+func newTestVault(t *testing.T, fill byte) vault.Vault {
+	t.Helper()
+
+	v, err := vault.New(bytes.Repeat([]byte{fill}, vault.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestVault_EncryptDecrypt(t *testing.T) {
+	v := newTestVault(t, 1)
+
+	a, err := v.Encrypt("apple_banana_cherry_date")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := v.Encrypt("apple_banana_cherry_date")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("Encrypt() returned the same value twice, want a random nonce")
+	}
+
+	if strings.Contains(a, "apple") {
+		t.Errorf("Encrypt() = %v, contains the password", a)
+	}
+
+	got, err := v.Decrypt(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "apple_banana_cherry_date" {
+		t.Errorf("Decrypt() = %v, want apple_banana_cherry_date", got)
+	}
+
+	tests := []struct {
+		name      string
+		encrypted string
+		vault     vault.Vault
+	}{
+		{name: "other key", encrypted: a, vault: newTestVault(t, 2)},
+		{name: "changed value", encrypted: a[:len(a)-4] + "AAA=", vault: v},
+		{name: "unknown format", encrypted: strings.TrimPrefix(a, "v1:"), vault: v},
+		{name: "too short", encrypted: "v1:AAAA", vault: v},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.vault.Decrypt(tt.encrypted)
+			if err == nil {
+				t.Error("Decrypt() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNew_keySize(t *testing.T) {
+	_, err := vault.New(make([]byte, 16))
+	if err == nil {
+		t.Error("New() with a 16-byte key error = nil, want an error")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	t.Setenv(vault.KeyEnv, "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "keys", "password.key")
+
+	_, err := vault.LoadKey("")
+	if !errors.Is(err, vault.ErrNoKey) {
+		t.Errorf("LoadKey() without a path error = %v, want ErrNoKey", err)
+	}
+
+	// a missing key file isn't replaced with a new key.
+	_, err = vault.LoadKey(path)
+	if err == nil {
+		t.Error("LoadKey() of a missing file error = nil, want an error")
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadKey() created %v", path)
+	}
+
+	err = vault.CreateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file permissions = %v, want 0600", info.Mode().Perm())
+	}
+
+	created, err := vault.LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created) != vault.KeySize {
+		t.Errorf("CreateKey() created a %v-byte key, want %v", len(created), vault.KeySize)
+	}
+
+	err = vault.CreateKey(path)
+	if err == nil {
+		t.Error("CreateKey() of an existing file error = nil, want an error")
+	}
+
+	loaded, err := vault.LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(created, loaded) {
+		t.Error("CreateKey() replaced the existing key")
+	}
+
+	envKey := bytes.Repeat([]byte{7}, vault.KeySize)
+	t.Setenv(vault.KeyEnv, base64.StdEncoding.EncodeToString(envKey))
+
+	for _, p := range []string{path, ""} {
+		got, err := vault.LoadKey(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, envKey) {
+			t.Errorf("LoadKey(%q) ignored the environment variable", p)
+		}
+	}
+
+	t.Setenv(vault.KeyEnv, base64.StdEncoding.EncodeToString(envKey[:10]))
+	_, err = vault.LoadKey(path)
+	if err == nil {
+		t.Error("LoadKey() with a short key error = nil, want an error")
+	}
+}
+
+func TestVault_noKey(t *testing.T) {
+	var v vault.Vault
+
+	_, err := v.Encrypt("apple_banana")
+	if !errors.Is(err, vault.ErrNoKey) {
+		t.Errorf("Encrypt() error = %v, want ErrNoKey", err)
+	}
+
+	encrypted, err := newTestVault(t, 1).Encrypt("apple_banana")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Decrypt(encrypted)
+	if !errors.Is(err, vault.ErrNoKey) {
+		t.Errorf("Decrypt() error = %v, want ErrNoKey", err)
+	}
+}
@@ -0,0 +1,107 @@
+package vimeo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiURI = "https://api.vimeo.com"
+)
+
+// callAPI makes a JSON request to the given Vimeo API path, retrying once when rate limited and once with a renewed
+// token if the current one is rejected. If out is not nil, the response body is unmarshaled into it.
+func (u Uploader) callAPI(method, path string, payload interface{}, out interface{}) error {
+	var bodyBytes []byte
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("unable to prepare request payload: %v", err)
+		}
+		bodyBytes = b
+	}
+
+	retries := 0
+	renewed := false
+
+	for retries < 2 {
+		token, err := u.tokens.Token()
+		if err != nil {
+			return fmt.Errorf("could not get access token: %v", err)
+		}
+
+		// the request is rebuilt on every attempt since the body can only be read once.
+		req, err := http.NewRequest(method, apiURI+path, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return fmt.Errorf("error creating request: %v", err)
+		}
+
+		if payload != nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+		req.Header.Add("Accept", "application/vnd.vimeo.*+json;version=3.4")
+		req.Header.Add("Authorization", fmt.Sprintf("bearer %v", token))
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("error making %v request to %v: %v", method, path, err)
+		}
+
+		respBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("could not read %v response bytes: %v", path, err)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			fmt.Println("rate limited, waiting for 60 seconds and trying again...")
+			time.Sleep(time.Second * 60) // TODO: calculate time remaining
+			retries++
+			continue
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !renewed {
+			renewed = true
+			err = u.tokens.Renew()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("received status code %v from %v %v with response body: %v", resp.StatusCode, method, path, string(respBytes))
+		}
+
+		if out != nil && len(respBytes) > 0 {
+			err = json.Unmarshal(respBytes, out)
+			if err != nil {
+				return fmt.Errorf("could not unmarshal %v response: %v", path, err)
+			}
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("rate limited twice calling %v %v, aborting...", method, path)
+}
+
+// apiVideoPath converts a tracked video URI (ex. https://vimeo.com/1234) into its API path (ex. /videos/1234).
+func apiVideoPath(videoURI string) (string, error) {
+	if strings.HasPrefix(videoURI, "/videos/") {
+		return videoURI, nil
+	}
+
+	id := strings.TrimPrefix(strings.TrimPrefix(videoURI, "https://vimeo.com"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		return "", errors.New("could not determine video ID from URI " + videoURI)
+	}
+
+	return "/videos/" + id, nil
+}
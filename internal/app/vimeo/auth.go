@@ -0,0 +1,106 @@
+package vimeo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+const (
+	authorizeURI         = "https://api.vimeo.com/oauth/authorize"
+	accessTokenURI       = "https://api.vimeo.com/oauth/access_token"
+	clientCredentialsURI = "https://api.vimeo.com/oauth/authorize/client"
+	tokenFilename        = "vimeo_token.json"
+	defaultRedirectPort  = 8085
+	// clientSecretEnv can be set instead of auth.client_secret to keep the secret out of the config file.
+	clientSecretEnv = "VIMEO_CLIENT_SECRET"
+)
+
+// AuthSettings configures OAuth2 authentication as an alternative to a personal access token.
+type AuthSettings struct {
+	// Flow is personal_access_token (the default), authorization_code, or client_credentials.
+	Flow         string `yaml:"flow"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectPort is the local port for the authorization code redirect, http://127.0.0.1:<port>/callback must
+	// be added to the Vimeo app's callback URLs.
+	RedirectPort int `yaml:"redirect_port"`
+	// TokenPath is where tokens are saved, defaults to vimeo_token.json in the upload status folder.
+	TokenPath string `yaml:"token_path"`
+}
+
+// usesOAuth returns whether tokens come from an OAuth2 flow instead of the personal access token.
+func (a AuthSettings) usesOAuth() bool {
+	return a.Flow == oauth.FlowAuthorizationCode || a.Flow == oauth.FlowClientCredentials
+}
+
+// oauthConfig returns the OAuth2 settings for Vimeo's endpoints.
+func (a AuthSettings) oauthConfig() oauth.Config {
+	secret := a.ClientSecret
+	if secret == "" {
+		secret = os.Getenv(clientSecretEnv)
+	}
+
+	port := a.RedirectPort
+	if port == 0 {
+		port = defaultRedirectPort
+	}
+
+	return oauth.Config{
+		ClientID:             a.ClientID,
+		ClientSecret:         secret,
+		AuthURL:              authorizeURI,
+		TokenURL:             accessTokenURI,
+		ClientCredentialsURL: clientCredentialsURI,
+		Scopes:               []string{"public", "private", "edit", "upload"},
+		RedirectPort:         port,
+	}
+}
+
+// newTokenSource returns the token source for the configured flow.
+func newTokenSource(c httpCaller, outputFolderPath string, s Settings) (oauth.TokenSource, *oauth.Source, error) {
+	switch s.Auth.Flow {
+	case "", "personal_access_token":
+		return oauth.StaticSource(s.PersonalAccessToken), nil, nil
+	case oauth.FlowAuthorizationCode, oauth.FlowClientCredentials:
+		if s.Auth.ClientID == "" {
+			return nil, nil, fmt.Errorf("vimeo auth flow %v requires a client_id", s.Auth.Flow)
+		}
+
+		tokenPath := s.Auth.TokenPath
+		if tokenPath == "" {
+			tokenPath = filepath.Join(outputFolderPath, tokenFilename)
+		}
+
+		src := oauth.NewSource(c, s.Auth.oauthConfig(), s.Auth.Flow, oauth.NewFileStore(tokenPath), "run the login command")
+		return src, src, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown vimeo auth flow %v", s.Auth.Flow)
+	}
+}
+
+// Login gets and saves a new token using the configured OAuth2 flow. For the authorization code flow, prompt is
+// given the URL the user needs to open to grant access.
+func (u Uploader) Login(prompt func(authURL string)) error {
+	if u.oauthSource == nil {
+		return errors.New("login is only needed when vimeo_settings.auth.flow is authorization_code or client_credentials")
+	}
+
+	var t oauth.Token
+	var err error
+	if u.settings.Auth.Flow == oauth.FlowClientCredentials {
+		t, err = oauth.ClientCredentials(u.client, u.settings.Auth.oauthConfig())
+	} else {
+		t, err = oauth.AuthorizeCode(u.client, u.settings.Auth.oauthConfig(), prompt, time.Minute*5)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return u.oauthSource.SetToken(t)
+}
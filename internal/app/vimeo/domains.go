@@ -0,0 +1,125 @@
+package vimeo
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// DomainsResponse contains the fields returned when listing a video's embed domains.
+type DomainsResponse struct {
+	Data []Domain `json:"data"`
+}
+
+// Domain is a domain allowed to embed a video.
+type Domain struct {
+	Domain string `json:"domain"`
+}
+
+// setEmbedDomains reconciles the video's embed whitelist with data's embed domains when the video's embed privacy is
+// whitelist, then saves the domains to the record. Does nothing if the record already has the same domains.
+func (u Uploader) setEmbedDomains(r *database.UploadRecord, data destination.UploadData) error {
+	if u.settings.UploadSettings.Privacy.Embed != "whitelist" || len(data.EmbedDomains) == 0 {
+		return nil
+	}
+
+	want := normalizeDomains(data.EmbedDomains)
+	if equalDomains(want, r.EmbedDomains) {
+		return nil
+	}
+
+	path, err := apiVideoPath(r.VideoURI)
+	if err != nil {
+		return err
+	}
+
+	err = u.reconcileDomains(path, want)
+	if err != nil {
+		return fmt.Errorf("could not set %v embed domains: %v", data.Filename, err)
+	}
+
+	r.EmbedDomains = want
+	pErr := u.uploadDB.PutUpload(*r)
+	if pErr != nil {
+		fmt.Printf("error saving %v embed domains locally but they were set on the video: %v\n", data.Filename, pErr)
+	}
+
+	return nil
+}
+
+// reconcileDomains makes the video's embed whitelist match domains exactly, adding missing domains and removing
+// ones that aren't listed.
+func (u Uploader) reconcileDomains(videoPath string, domains []string) error {
+	var existing DomainsResponse
+	err := u.callAPI(http.MethodGet, videoPath+"/privacy/domains?per_page=100", nil, &existing)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]bool, len(existing.Data))
+	for _, d := range existing.Data {
+		current[strings.ToLower(d.Domain)] = true
+	}
+
+	wanted := make(map[string]bool, len(domains))
+	for _, d := range domains {
+		wanted[d] = true
+		if current[d] {
+			continue
+		}
+
+		err = u.callAPI(http.MethodPut, videoPath+"/privacy/domains/"+url.PathEscape(d), nil, nil)
+		if err != nil {
+			return fmt.Errorf("could not add domain %v: %v", d, err)
+		}
+	}
+
+	for d := range current {
+		if wanted[d] {
+			continue
+		}
+
+		err = u.callAPI(http.MethodDelete, videoPath+"/privacy/domains/"+url.PathEscape(d), nil, nil)
+		if err != nil {
+			return fmt.Errorf("could not remove domain %v: %v", d, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeDomains lowercases, de-duplicates, and sorts domains.
+func normalizeDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		normalized = append(normalized, d)
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
+
+func equalDomains(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
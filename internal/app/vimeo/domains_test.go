@@ -0,0 +1,74 @@
+package vimeo
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// fakeDomainsAPI serves a video's embed domain list and records changes made to it.
+type fakeDomainsAPI struct {
+	domains map[string]bool
+	calls   []string
+}
+
+func (f *fakeDomainsAPI) Do(req *http.Request) (*http.Response, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/videos/1/privacy/domains")
+	f.calls = append(f.calls, req.Method+" "+path)
+
+	body := ""
+	switch req.Method {
+	case http.MethodGet:
+		var data []string
+		for d := range f.domains {
+			data = append(data, `{"domain":"`+d+`"}`)
+		}
+		sort.Strings(data)
+		body = `{"data":[` + strings.Join(data, ",") + `]}`
+	case http.MethodPut:
+		f.domains[strings.TrimPrefix(path, "/")] = true
+	case http.MethodDelete:
+		delete(f.domains, strings.TrimPrefix(path, "/"))
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestUploader_reconcileDomains(t *testing.T) {
+	api := &fakeDomainsAPI{
+		domains: map[string]bool{"old.example.edu": true, "lms.example.edu": true},
+	}
+	u := Uploader{client: api, tokens: oauth.StaticSource("token")}
+
+	want := normalizeDomains([]string{"LMS.example.edu", "new.example.edu", "lms.example.edu"})
+
+	err := u.reconcileDomains("/videos/1", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCalls := []string{"GET ", "PUT /new.example.edu", "DELETE /old.example.edu"}
+	if diff := cmp.Diff(wantCalls, api.calls); diff != "" {
+		t.Errorf("reconcileDomains() calls mismatch (-want +got):\n%s", diff)
+	}
+
+	// running again with the same domains should only list them.
+	api.calls = nil
+	err = u.reconcileDomains("/videos/1", want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"GET "}, api.calls); diff != "" {
+		t.Errorf("reconcileDomains() second run calls mismatch (-want +got):\n%s", diff)
+	}
+}
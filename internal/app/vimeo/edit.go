@@ -0,0 +1,79 @@
+package vimeo
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// EditData holds the video fields that can be changed after an upload. Empty fields are left unchanged on Vimeo.
+type EditData struct {
+	Name        string
+	Description string
+	Password    string
+	Privacy     *Privacy
+	// Tags replaces the video's tags if it isn't empty.
+	Tags []string
+	// EmbedDomains replaces the video's embed whitelist if it isn't nil.
+	EmbedDomains []string
+}
+
+// EditPayload is the JSON payload used to update an existing video.
+type EditPayload struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Privacy     *Privacy `json:"privacy,omitempty"`
+}
+
+// Tag is a single entry in the payload used to set a video's tags.
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// Edit updates the metadata of an already uploaded video. videoURI is the URI tracked in the video's UploadRecord.
+func (u Uploader) Edit(videoURI string, data EditData) error {
+	path, err := apiVideoPath(videoURI)
+	if err != nil {
+		return err
+	}
+
+	payload := EditPayload{
+		Name:        data.Name,
+		Description: data.Description,
+		Password:    data.Password,
+		Privacy:     data.Privacy,
+	}
+
+	if payload != (EditPayload{}) {
+		err = u.callAPI(http.MethodPatch, path, payload, nil)
+		if err != nil {
+			return fmt.Errorf("could not update video %v: %v", videoURI, err)
+		}
+	}
+
+	if len(data.Tags) > 0 {
+		err = u.setTags(path, data.Tags)
+		if err != nil {
+			return fmt.Errorf("could not update video %v tags: %v", videoURI, err)
+		}
+	}
+
+	if data.EmbedDomains != nil {
+		err = u.reconcileDomains(path, normalizeDomains(data.EmbedDomains))
+		if err != nil {
+			return fmt.Errorf("could not update video %v embed domains: %v", videoURI, err)
+		}
+	}
+
+	return nil
+}
+
+// setTags replaces the tags of the video at the API path with the given ones.
+func (u Uploader) setTags(path string, tags []string) error {
+	payload := make([]Tag, len(tags))
+	for i, t := range tags {
+		payload[i] = Tag{Name: t}
+	}
+
+	return u.callAPI(http.MethodPut, path+"/tags", payload, nil)
+}
@@ -0,0 +1,172 @@
+package vimeo
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// recordedRequest is a request received by fakeAPI.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeAPI records the requests it receives and answers them with respond, or with an empty 200 response if respond
+// is nil.
+type fakeAPI struct {
+	requests []recordedRequest
+	respond  func(req *http.Request, body string) *http.Response
+}
+
+func (f *fakeAPI) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+
+	path := req.URL.Path
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+	f.requests = append(f.requests, recordedRequest{Method: req.Method, Path: path, Body: string(body)})
+
+	if f.respond != nil {
+		return f.respond(req, string(body)), nil
+	}
+
+	return response(http.StatusOK, nil, ""), nil
+}
+
+// response returns an HTTP response with the given status, headers, and body.
+func response(status int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestUploader_Edit(t *testing.T) {
+	tests := []struct {
+		name     string
+		videoURI string
+		data     EditData
+		want     []recordedRequest
+	}{
+		{
+			name:     "every field",
+			videoURI: "https://vimeo.com/1",
+			data: EditData{
+				Name:        "Tap Week 3",
+				Description: "Tap 2023 Spring",
+				Password:    "spied_ferry",
+				Privacy:     &Privacy{Embed: "public", View: "password"},
+				Tags:        []string{"tap", "spring"},
+			},
+			want: []recordedRequest{
+				{
+					Method: http.MethodPatch,
+					Path:   "/videos/1",
+					Body:   `{"name":"Tap Week 3","description":"Tap 2023 Spring","password":"spied_ferry","privacy":{"add":"","comments":"","embed":"public","view":"password"}}`,
+				},
+				{
+					Method: http.MethodPut,
+					Path:   "/videos/1/tags",
+					Body:   `[{"name":"tap"},{"name":"spring"}]`,
+				},
+			},
+		},
+		{
+			name:     "only tags skips the video update",
+			videoURI: "/videos/2",
+			data:     EditData{Tags: []string{"jazz"}},
+			want: []recordedRequest{
+				{Method: http.MethodPut, Path: "/videos/2/tags", Body: `[{"name":"jazz"}]`},
+			},
+		},
+		{
+			name:     "only a password",
+			videoURI: "https://vimeo.com/3",
+			data:     EditData{Password: "gray_jaws"},
+			want: []recordedRequest{
+				{Method: http.MethodPatch, Path: "/videos/3", Body: `{"password":"gray_jaws"}`},
+			},
+		},
+		{
+			name:     "nothing to change",
+			videoURI: "https://vimeo.com/4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{}
+			u := Uploader{client: api, tokens: oauth.StaticSource("token")}
+
+			err := u.Edit(tt.videoURI, tt.data)
+			if err != nil {
+				t.Fatalf("Edit() error = %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, api.requests); diff != "" {
+				t.Errorf("Edit() requests mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUploader_Edit_errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		videoURI string
+		data     EditData
+		status   func(path string) int
+	}{
+		{
+			name:     "invalid video URI",
+			videoURI: "https://vimeo.com/a/b",
+			data:     EditData{Name: "Tap"},
+		},
+		{
+			name:     "update rejected",
+			videoURI: "/videos/1",
+			data:     EditData{Name: "Tap", Tags: []string{"tap"}},
+			status:   func(string) int { return http.StatusBadRequest },
+		},
+		{
+			name:     "tags rejected",
+			videoURI: "/videos/1",
+			data:     EditData{Name: "Tap", Tags: []string{"tap"}},
+			status: func(path string) int {
+				if strings.HasSuffix(path, "/tags") {
+					return http.StatusForbidden
+				}
+				return http.StatusOK
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &fakeAPI{respond: func(req *http.Request, body string) *http.Response {
+				return response(tt.status(req.URL.Path), nil, `{"error":"no"}`)
+			}}
+			u := Uploader{client: api, tokens: oauth.StaticSource("token")}
+
+			err := u.Edit(tt.videoURI, tt.data)
+			if err == nil {
+				t.Error("Edit() succeeded")
+			}
+		})
+	}
+}
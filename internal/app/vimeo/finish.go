@@ -0,0 +1,12 @@
+package vimeo
+
+import (
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// finishUpload runs the steps that happen after a video's file is fully uploaded. Each step skips work that's already
+// recorded as done, so it's safe to call again for videos that finished in a previous run.
+func (u Uploader) finishUpload(r database.UploadRecord, data destination.UploadData) error {
+	return destination.Finish(u.uploadDB, r, data, u.setEmbedDomains, u.uploadTextTracks, u.setThumbnail)
+}
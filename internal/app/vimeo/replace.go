@@ -0,0 +1,106 @@
+package vimeo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// VersionPayload is the JSON payload used to start uploading a new version of an existing video.
+type VersionPayload struct {
+	FileName string             `json:"file_name"`
+	Upload   UploadApproachSize `json:"upload"`
+}
+
+// Replace uploads data's file as a new version of the video tracked under the given record name or ID. The video
+// keeps its URI, password, and other settings. An interrupted replacement of the same file resumes where it left off.
+func (u Uploader) Replace(name string, data destination.UploadData) error {
+	r, err := database.FindUpload(u.uploadDB, name)
+	if err != nil {
+		return fmt.Errorf("could not get upload record %v: %v", name, err)
+	}
+
+	if r.IsEmpty() || r.VideoURI == "" {
+		return fmt.Errorf("no uploaded video found for %v", name)
+	}
+
+	if r.Status != database.Complete {
+		return fmt.Errorf("video %v has not finished uploading, upload it before replacing it", name)
+	}
+
+	path, err := apiVideoPath(r.VideoURI)
+	if err != nil {
+		return err
+	}
+
+	var uploadOffset int64
+	var v *database.VideoVersion
+
+	if len(r.Versions) > 0 {
+		last := &r.Versions[len(r.Versions)-1]
+		if last.Status == database.InProgress && last.Filename == data.Filename {
+			offset, oErr := getOffset(u.client, last.TusURI)
+			if oErr != nil {
+				fmt.Printf("WARN: could not resume replacement of %v, starting over. error: %v\n", name, oErr)
+			} else {
+				v = last
+				uploadOffset = offset
+			}
+		}
+	}
+
+	if v == nil {
+		var resp TUSResponse
+		err = u.callAPI(http.MethodPost, path+"/versions", VersionPayload{
+			FileName: data.Filename,
+			Upload: UploadApproachSize{
+				Approach: "tus",
+				Size:     fmt.Sprint(data.FileSize),
+			},
+		}, &resp)
+		if err != nil {
+			return fmt.Errorf("could not create new version of %v: %v", name, err)
+		}
+
+		if resp.Upload.UploadLink == "" {
+			return errors.New("vimeo did not return an upload link for the new version")
+		}
+
+		r.Versions = append(r.Versions, database.VideoVersion{
+			Filename:  data.Filename,
+			URI:       resp.FinalURI,
+			TusURI:    resp.Upload.UploadLink,
+			Status:    database.InProgress,
+			CreatedAt: time.Now(),
+		})
+		v = &r.Versions[len(r.Versions)-1]
+
+		saveErr := u.uploadDB.PutUpload(r)
+		if saveErr != nil {
+			return fmt.Errorf("started replacement but error saving version data: %v\ntus URI: %v", saveErr, v.TusURI)
+		}
+	}
+
+	if uploadOffset < data.FileSize {
+		err = uploadFromOffset(u.uploadClient, uploadOffset, v.TusURI, data.FilePath, data.ChunkSize, data.FileSize, data.Progress)
+		if err != nil {
+			return fmt.Errorf("error uploading replacement file %v: %v", data.Filename, err)
+		}
+	}
+
+	v.Status = database.Complete
+	pErr := u.uploadDB.PutUpload(r)
+	if pErr != nil {
+		fmt.Printf("error updating %v version status locally but the replacement succeeded: %v\n", name, pErr)
+	}
+
+	fmt.Println("------------------------------")
+	fmt.Printf("finished replacing video %v with file %v\nvideo link: %v\n", name, data.Filename, r.VideoURI)
+	fmt.Println("------------------------------")
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package vimeo
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+func TestUploader_Replace(t *testing.T) {
+	const link1, link2 = "https://upload.test/tus/1", "https://upload.test/tus/2"
+
+	tests := []struct {
+		name string
+		// versions are the record's versions before replacing it.
+		versions []database.VideoVersion
+		// received is what link1 already received, if it exists.
+		received     []byte
+		want         []recordedRequest
+		wantVersions []database.VideoVersion
+	}{
+		{
+			name: "new version",
+			want: []recordedRequest{
+				{
+					Method: http.MethodPost,
+					Path:   "/videos/1/versions",
+					Body:   `{"file_name":"new.mp4","upload":{"approach":"tus","size":"18"}}`,
+				},
+				{Method: http.MethodPatch, Path: "/tus/1"},
+			},
+			wantVersions: []database.VideoVersion{
+				{Filename: "new.mp4", URI: "/videos/1/versions/9", TusURI: link1, Status: database.Complete},
+			},
+		},
+		{
+			name: "resumes an interrupted version of the same file",
+			versions: []database.VideoVersion{
+				{Filename: "new.mp4", URI: "/videos/1/versions/9", TusURI: link1, Status: database.InProgress},
+			},
+			received: []byte("not really"),
+			want: []recordedRequest{
+				{Method: http.MethodHead, Path: "/tus/1"},
+				{Method: http.MethodPatch, Path: "/tus/1"},
+			},
+			wantVersions: []database.VideoVersion{
+				{Filename: "new.mp4", URI: "/videos/1/versions/9", TusURI: link1, Status: database.Complete},
+			},
+		},
+		{
+			name: "interrupted version of another file",
+			versions: []database.VideoVersion{
+				{Filename: "old.mp4", URI: "/videos/1/versions/8", TusURI: link1, Status: database.InProgress},
+			},
+			received: []byte("old"),
+			want: []recordedRequest{
+				{
+					Method: http.MethodPost,
+					Path:   "/videos/1/versions",
+					Body:   `{"file_name":"new.mp4","upload":{"approach":"tus","size":"18"}}`,
+				},
+				{Method: http.MethodPatch, Path: "/tus/2"},
+			},
+			wantVersions: []database.VideoVersion{
+				{Filename: "old.mp4", URI: "/videos/1/versions/8", TusURI: link1, Status: database.InProgress},
+				{Filename: "new.mp4", URI: "/videos/1/versions/9", TusURI: link2, Status: database.Complete},
+			},
+		},
+		{
+			name: "starts over if the interrupted version can't be resumed",
+			versions: []database.VideoVersion{
+				{Filename: "new.mp4", URI: "/videos/1/versions/8", TusURI: "https://upload.test/tus/expired", Status: database.InProgress},
+			},
+			want: []recordedRequest{
+				{Method: http.MethodHead, Path: "/tus/expired"},
+				{
+					Method: http.MethodPost,
+					Path:   "/videos/1/versions",
+					Body:   `{"file_name":"new.mp4","upload":{"approach":"tus","size":"18"}}`,
+				},
+				{Method: http.MethodPatch, Path: "/tus/1"},
+			},
+			wantVersions: []database.VideoVersion{
+				{Filename: "new.mp4", URI: "/videos/1/versions/8", TusURI: "https://upload.test/tus/expired", Status: database.InProgress},
+				{Filename: "new.mp4", URI: "/videos/1/versions/9", TusURI: link1, Status: database.Complete},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = db.PutUpload(database.UploadRecord{
+				Name:     "Tap Week 1",
+				Status:   database.Complete,
+				VideoURI: "https://vimeo.com/1",
+				Versions: tt.versions,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			api := newFakeVimeo()
+			if tt.received != nil {
+				api.received[link1] = tt.received
+			}
+			u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+			data := newTestUpload(t, dir, "new.mp4")
+			err = u.Replace("Tap Week 1", data)
+			if err != nil {
+				t.Fatalf("Replace() error = %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, api.requests); diff != "" {
+				t.Errorf("Replace() requests mismatch (-want +got):\n%s", diff)
+			}
+
+			last := tt.wantVersions[len(tt.wantVersions)-1].TusURI
+			if !bytes.Equal(api.received[last], []byte("not really a video")) {
+				t.Errorf("Replace() uploaded %q", api.received[last])
+			}
+
+			r, err := db.GetUpload("Tap Week 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range r.Versions {
+				r.Versions[i].CreatedAt = tt.wantVersions[i].CreatedAt
+			}
+			if diff := cmp.Diff(tt.wantVersions, r.Versions); diff != "" {
+				t.Errorf("Replace() versions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUploader_Replace_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		record database.UploadRecord
+		fail   string
+	}{
+		{name: "no record"},
+		{
+			name:   "upload not finished",
+			record: database.UploadRecord{Name: "Tap Week 1", Status: database.InProgress, VideoURI: "https://vimeo.com/1"},
+		},
+		{
+			name:   "version rejected",
+			record: database.UploadRecord{Name: "Tap Week 1", Status: database.Complete, VideoURI: "https://vimeo.com/1"},
+			fail:   "POST /videos/1/versions",
+		},
+		{
+			name:   "transfer fails",
+			record: database.UploadRecord{Name: "Tap Week 1", Status: database.Complete, VideoURI: "https://vimeo.com/1"},
+			fail:   "PATCH /tus/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.record.IsEmpty() {
+				err = db.PutUpload(tt.record)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			api := newFakeVimeo()
+			if tt.fail != "" {
+				api.fail[tt.fail] = http.StatusInternalServerError
+			}
+			u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+			err = u.Replace("Tap Week 1", newTestUpload(t, dir, "new.mp4"))
+			if err == nil {
+				t.Error("Replace() succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package vimeo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nmalensek/video-uploader/internal/app/captions"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// TextTrackPayload is the JSON payload used to create a text track.
+type TextTrackPayload struct {
+	Type     string `json:"type"`
+	Language string `json:"language"`
+	Name     string `json:"name"`
+}
+
+// TextTrackResponse contains the fields returned when a text track is created.
+type TextTrackResponse struct {
+	URI  string `json:"uri"`
+	Link string `json:"link"`
+}
+
+// uploadTextTracks adds data's text tracks that haven't been added yet to the record's video and saves the record
+// after each one. All tracks are attempted even if one fails.
+func (u Uploader) uploadTextTracks(r *database.UploadRecord, data destination.UploadData) error {
+	if len(data.TextTracks) == 0 {
+		return nil
+	}
+
+	path, err := apiVideoPath(r.VideoURI)
+	if err != nil {
+		return err
+	}
+
+	uploaded := make(map[string]bool, len(r.TextTracks))
+	for _, t := range r.TextTracks {
+		uploaded[t.Filename] = true
+	}
+
+	failed := 0
+	for _, t := range data.TextTracks {
+		if uploaded[t.Filename] {
+			continue
+		}
+
+		uri, tErr := u.uploadTextTrack(path, t)
+		if tErr != nil {
+			fmt.Printf("error adding text track %v to %v: %v\n", t.Filename, data.Filename, tErr)
+			failed++
+			continue
+		}
+
+		r.TextTracks = append(r.TextTracks, database.TextTrack{
+			Filename: t.Filename,
+			Language: t.Language,
+			Kind:     t.Kind,
+			URI:      uri,
+		})
+
+		pErr := u.uploadDB.PutUpload(*r)
+		if pErr != nil {
+			fmt.Printf("error saving text track %v locally but it was added to the video: %v\n", t.Filename, pErr)
+		}
+
+		fmt.Printf("added %v %v text track %v\n", t.Language, t.Kind, t.Filename)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v text tracks could not be added to %v", failed, data.Filename)
+	}
+
+	return nil
+}
+
+// uploadTextTrack creates the text track on the video, uploads its WebVTT contents, and activates it.
+func (u Uploader) uploadTextTrack(videoPath string, t captions.TextTrack) (string, error) {
+	vtt, err := t.WebVTT()
+	if err != nil {
+		return "", err
+	}
+
+	var resp TextTrackResponse
+	err = u.callAPI(http.MethodPost, videoPath+"/texttracks", TextTrackPayload{
+		Type:     t.Kind,
+		Language: t.Language,
+		Name:     t.Filename,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	err = putFile(u.uploadClient, resp.Link, "text/vtt", vtt)
+	if err != nil {
+		return "", err
+	}
+
+	err = u.callAPI(http.MethodPatch, resp.URI, map[string]bool{"active": true}, nil)
+	if err != nil {
+		return "", fmt.Errorf("text track was uploaded but could not be activated: %v", err)
+	}
+
+	return resp.URI, nil
+}
+
+// putFile uploads contents to a pre-authorized upload link returned by the API.
+func putFile(c httpCaller, link, contentType string, contents []byte) error {
+	req, err := http.NewRequest(http.MethodPut, link, bytes.NewReader(contents))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Add("Content-Type", contentType)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading file to %v: %v", link, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("received status code %v uploading file with response body: %v", resp.StatusCode, string(respBytes))
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package vimeo
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+)
+
+// PictureResponse contains the fields returned when a video picture is created.
+type PictureResponse struct {
+	URI  string `json:"uri"`
+	Link string `json:"link"`
+}
+
+// PictureTimePayload asks Vimeo to generate a thumbnail from the frame at Time seconds into the video.
+type PictureTimePayload struct {
+	Time   float64 `json:"time"`
+	Active bool    `json:"active"`
+}
+
+// setThumbnail sets the video's thumbnail from data's sidecar image or thumbnail offset and saves the picture URI
+// to the record. Does nothing if neither is set or the record already has a picture.
+func (u Uploader) setThumbnail(r *database.UploadRecord, data destination.UploadData) error {
+	if r.PictureURI != "" || (data.ThumbnailPath == "" && data.ThumbnailOffset <= 0) {
+		return nil
+	}
+
+	path, err := apiVideoPath(r.VideoURI)
+	if err != nil {
+		return err
+	}
+
+	var uri string
+	if data.ThumbnailPath != "" {
+		uri, err = u.uploadPicture(path, data.ThumbnailPath)
+	} else {
+		uri, err = u.generatePicture(path, data.ThumbnailOffset.Seconds())
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not set %v thumbnail: %v", data.Filename, err)
+	}
+
+	r.PictureURI = uri
+	pErr := u.uploadDB.PutUpload(*r)
+	if pErr != nil {
+		fmt.Printf("error saving %v thumbnail locally but it was set on the video: %v\n", data.Filename, pErr)
+	}
+
+	fmt.Printf("set thumbnail for %v\n", data.Filename)
+	return nil
+}
+
+// uploadPicture uploads the image at imagePath and makes it the video's active picture.
+func (u Uploader) uploadPicture(videoPath, imagePath string) (string, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("could not read thumbnail image: %v", err)
+	}
+
+	var resp PictureResponse
+	err = u.callAPI(http.MethodPost, videoPath+"/pictures", nil, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := "image/jpeg"
+	if strings.EqualFold(filepath.Ext(imagePath), ".png") {
+		contentType = "image/png"
+	}
+
+	err = putFile(u.uploadClient, resp.Link, contentType, image)
+	if err != nil {
+		return "", err
+	}
+
+	err = u.callAPI(http.MethodPatch, resp.URI, map[string]bool{"active": true}, nil)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail was uploaded but could not be activated: %v", err)
+	}
+
+	return resp.URI, nil
+}
+
+// generatePicture has Vimeo create the video's active picture from the frame at the given number of seconds.
+func (u Uploader) generatePicture(videoPath string, seconds float64) (string, error) {
+	var resp PictureResponse
+	err := u.callAPI(http.MethodPost, videoPath+"/pictures", PictureTimePayload{
+		Time:   seconds,
+		Active: true,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.URI, nil
+}
@@ -0,0 +1,156 @@
+package vimeo
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// pictureAPI is a fakeAPI that creates the picture /videos/1/pictures/7, uploaded at https://upload.test/pictures/7.
+func pictureAPI(fail string) *fakeAPI {
+	return &fakeAPI{respond: func(req *http.Request, body string) *http.Response {
+		if req.Method+" "+req.URL.Path == fail {
+			return response(http.StatusInternalServerError, nil, `{"error":"no"}`)
+		}
+
+		if req.Method == http.MethodPost && req.URL.Path == "/videos/1/pictures" {
+			return response(http.StatusCreated, nil, `{"uri":"/videos/1/pictures/7","link":"https://upload.test/pictures/7"}`)
+		}
+
+		return response(http.StatusOK, nil, "")
+	}}
+}
+
+func TestUploader_setThumbnail(t *testing.T) {
+	tests := []struct {
+		name       string
+		pictureURI string
+		sidecar    string
+		offset     time.Duration
+		want       []recordedRequest
+		wantURI    string
+	}{
+		{
+			name:    "sidecar image",
+			sidecar: "Tap Week 1.png",
+			want: []recordedRequest{
+				{Method: http.MethodPost, Path: "/videos/1/pictures"},
+				{Method: http.MethodPut, Path: "/pictures/7", Body: "not really a picture"},
+				{Method: http.MethodPatch, Path: "/videos/1/pictures/7", Body: `{"active":true}`},
+			},
+			wantURI: "/videos/1/pictures/7",
+		},
+		{
+			name:   "class offset",
+			offset: 90 * time.Second,
+			want: []recordedRequest{
+				{Method: http.MethodPost, Path: "/videos/1/pictures", Body: `{"time":90,"active":true}`},
+			},
+			wantURI: "/videos/1/pictures/7",
+		},
+		{
+			name:       "picture already set",
+			pictureURI: "/videos/1/pictures/5",
+			sidecar:    "Tap Week 1.png",
+			offset:     90 * time.Second,
+			wantURI:    "/videos/1/pictures/5",
+		},
+		{
+			name: "no thumbnail configured",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := database.UploadRecord{Name: "Tap Week 1", Status: database.Complete, VideoURI: "https://vimeo.com/1", PictureURI: tt.pictureURI}
+			err = db.PutUpload(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := destination.UploadData{Filename: "Tap Week 1.mp4", ThumbnailOffset: tt.offset}
+			if tt.sidecar != "" {
+				data.ThumbnailPath = filepath.Join(dir, tt.sidecar)
+				err = os.WriteFile(data.ThumbnailPath, []byte("not really a picture"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			api := pictureAPI("")
+			u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+			err = u.setThumbnail(&r, data)
+			if err != nil {
+				t.Fatalf("setThumbnail() error = %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, api.requests); diff != "" {
+				t.Errorf("setThumbnail() requests mismatch (-want +got):\n%s", diff)
+			}
+
+			saved, err := db.GetUpload("Tap Week 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.PictureURI != tt.wantURI || saved.PictureURI != tt.wantURI {
+				t.Errorf("setThumbnail() picture = %q, saved %q, want %q", r.PictureURI, saved.PictureURI, tt.wantURI)
+			}
+		})
+	}
+}
+
+func TestUploader_setThumbnail_errors(t *testing.T) {
+	tests := []struct {
+		name string
+		fail string
+	}{
+		{name: "picture not created", fail: "POST /videos/1/pictures"},
+		{name: "image upload fails", fail: "PUT /pictures/7"},
+		{name: "picture not activated", fail: "PATCH /videos/1/pictures/7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			image := filepath.Join(dir, "Tap Week 1.jpg")
+			err = os.WriteFile(image, []byte("not really a picture"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			api := pictureAPI(tt.fail)
+			u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+			r := database.UploadRecord{Name: "Tap Week 1", Status: database.Complete, VideoURI: "https://vimeo.com/1"}
+			err = u.setThumbnail(&r, destination.UploadData{Filename: "Tap Week 1.mp4", ThumbnailPath: image})
+			if err == nil {
+				t.Fatal("setThumbnail() succeeded")
+			}
+
+			if r.PictureURI != "" {
+				t.Errorf("setThumbnail() picture = %q after failing", r.PictureURI)
+			}
+		})
+	}
+}
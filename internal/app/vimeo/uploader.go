@@ -2,7 +2,6 @@ package vimeo
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -14,19 +13,27 @@ import (
 	"time"
 
 	"github.com/nmalensek/video-uploader/internal/app/database"
-	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
 )
 
-// Settings contains the PAT and settings used for video uploads.
+// Settings contains the credentials and settings used for video uploads.
 type Settings struct {
 	PersonalAccessToken string         `yaml:"personal_access_token"`
+	Auth                AuthSettings   `yaml:"auth"`
 	UploadSettings      UploadSettings `yaml:"upload_settings"`
+	// EmbedDomains are the domains allowed to embed videos when the embed privacy setting is whitelist.
+	EmbedDomains []string `yaml:"embed_domains"`
 }
 
 // UploadSettings are video-specific settings that must be set for new uploads.
 type UploadSettings struct {
 	ContentRating []string `yaml:"content_rating"`
 	Privacy       Privacy  `yaml:"privacy"`
+	// NameTemplate and DescriptionTemplate are text/template strings rendered with metadata.VideoDetails.
+	NameTemplate        string   `yaml:"name_template"`
+	DescriptionTemplate string   `yaml:"description_template"`
+	Tags                []string `yaml:"tags"`
 }
 
 // Privacy defines who can access the uploaded video.
@@ -38,17 +45,6 @@ type Privacy struct {
 	Download *bool  `json:"download,omitempty"`
 }
 
-// UploadData holds everything needed for an upload.
-type UploadData struct {
-	VideoName        string // May be redundant if using the filename as video name
-	VideoDescription string
-	Filename         string
-	FilePath         string
-	Password         string
-	FileSize         int64
-	ChunkSize        int
-}
-
 // UploadApproachSize contains the fields needed to start a tus upload.
 type UploadApproachSize struct {
 	Approach string `json:"approach"`
@@ -96,6 +92,9 @@ type Uploader struct {
 	uploadClient httpCaller
 	settings     Settings
 	uploadDB     database.UploadDatastore
+	tokens       oauth.TokenSource
+	// oauthSource is set when tokens come from an OAuth2 flow so new tokens can be saved on login.
+	oauthSource *oauth.Source
 }
 
 type httpCaller interface {
@@ -103,13 +102,15 @@ type httpCaller interface {
 }
 
 const (
-	uploadURI     = "https://api.vimeo.com/me/videos"
+	uploadPath    = "/me/videos"
 	uploadFilters = "?fields=name,description,upload,uri"
 	UploadOffset  = "Upload-Offset"
 )
 
-func NewUploader(outputFolderPath string, hc httpCaller, uhc httpCaller, s Settings) (Uploader, error) {
-	uploadDBConn, err := filedb.New(outputFolderPath)
+// NewUploader creates a Vimeo uploader that tracks uploads in db. OAuth tokens are saved to the output folder unless
+// a token path is configured.
+func NewUploader(outputFolderPath string, db database.UploadDatastore, hc httpCaller, uhc httpCaller, s Settings) (Uploader, error) {
+	tokens, oauthSource, err := newTokenSource(hc, outputFolderPath, s)
 	if err != nil {
 		return Uploader{}, err
 	}
@@ -118,32 +119,39 @@ func NewUploader(outputFolderPath string, hc httpCaller, uhc httpCaller, s Setti
 		client:       hc,
 		uploadClient: uhc,
 		settings:     s,
-		uploadDB:     uploadDBConn,
+		uploadDB:     db,
+		tokens:       tokens,
+		oauthSource:  oauthSource,
 	}, nil
 }
 
-func (u Uploader) Upload(data UploadData) error {
+func (u Uploader) Upload(data destination.UploadData) error {
 	// check for existing file in tracking file (failed initial upload case)
-	r, err := u.uploadDB.GetUpload(strings.TrimSuffix(strings.TrimSuffix(data.Filename, ".mp4"), ".mov"))
+	r, err := destination.FindRecord(u.uploadDB, data)
 	if err != nil {
 		fmt.Printf("WARN: error checking for prior upload, attempting upload. error: %v\n", err)
 	}
 
 	var uploadOffset int64
 
-	// if it's a new upload, make a call to set up all the base information
-	if r.IsEmpty() {
-		initialResp, err := initiateUpload(u.client, data, u.settings)
+	// if it's a new upload, or an earlier attempt failed before Vimeo created the video, make a call to set up all
+	// the base information
+	if r.IsEmpty() || (r.Status == database.Error && r.TusURI == "") {
+		initialResp, err := u.initiateUpload(data)
 		if err != nil {
 			// logging handled in called function.
-			return err
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
 		}
 
 		// currently, using the filename as the video name, but saving what was calculated for metrics.
-		r.Name = strings.TrimSuffix(data.Filename, ".mp4")
+		r.Name = data.Name()
 		r.CalculatedName = data.VideoName
+		r.Term = data.Term
 		r.Status = database.InProgress
 		r.TusURI = initialResp.Upload.UploadLink
+		if u.settings.UploadSettings.Privacy.View == "password" {
+			r.Password = data.Password
+		}
 		r.VideoURI = "https://vimeo.com" + strings.TrimPrefix(initialResp.FinalURI, "/videos")
 
 		saveErr := u.uploadDB.PutUpload(r)
@@ -151,33 +159,43 @@ func (u Uploader) Upload(data UploadData) error {
 			return fmt.Errorf("started upload but error saving initial data: %v\ndata from vimeo:\n%v\n%v\n%v\n%v",
 				saveErr, r.Name, r.Status, r.TusURI, r.VideoURI)
 		}
+
+		if len(u.settings.UploadSettings.Tags) > 0 {
+			tErr := u.setTags(initialResp.FinalURI, u.settings.UploadSettings.Tags)
+			if tErr != nil {
+				fmt.Printf("WARN: could not add tags to %v, they can be added later with the edit command: %v\n", data.Filename, tErr)
+			}
+		}
 	} else {
 		if r.Status == database.Complete {
 			fmt.Printf("file %v was already uploaded, skipping...\n", data.Filename)
-			return nil
+			return u.finishUpload(r, data)
 		}
 
 		tempOffset, oErr := getOffset(u.client, r.TusURI)
 		if oErr != nil {
-			return fmt.Errorf("could not get offset for video %v: %v", r.Name, err)
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindResume,
+				fmt.Errorf("could not get offset for video %v: %v", r.Name, oErr))
 		}
 
 		if tempOffset == data.FileSize {
 			r.Status = database.Complete
+			r.ErrorDetails = nil
 			pErr := u.uploadDB.PutUpload(r)
 			if pErr != nil {
-				fmt.Printf("error updating file %v status locally but the upload succeeded: %v", data.Filename, err)
+				fmt.Printf("WARN: could not save that %v finished uploading, the upload succeeded: %v\n", data.Filename, pErr)
 			}
 			fmt.Printf("file %v was already uploaded, skipping...\n", data.Filename)
-			return nil
+			return u.finishUpload(r, data)
 		}
 
 		uploadOffset = tempOffset
 	}
 
-	err = uploadFromOffset(u.uploadClient, uploadOffset, r.TusURI, data.FilePath, data.ChunkSize, data.FileSize)
+	err = uploadFromOffset(u.uploadClient, uploadOffset, r.TusURI, data.FilePath, data.ChunkSize, data.FileSize, data.Progress)
 	if err != nil {
-		return fmt.Errorf("error uploading file %v: %v", data.Filename, err)
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error uploading file %v: %v", data.Filename, err))
 	}
 
 	fmt.Println("------------------------------")
@@ -185,18 +203,31 @@ func (u Uploader) Upload(data UploadData) error {
 	fmt.Println("------------------------------")
 
 	r.Status = database.Complete
+	r.ErrorDetails = nil
 	pErr := u.uploadDB.PutUpload(r)
 	if pErr != nil {
-		fmt.Printf("error updating file %v status locally but the upload succeeded: %v", data.Filename, err)
+		fmt.Printf("WARN: could not save that %v finished uploading, the upload succeeded: %v\n", data.Filename, pErr)
 	}
 
-	return nil
+	return u.finishUpload(r, data)
 }
 
-func initiateUpload(c httpCaller, d UploadData, conf Settings) (TUSResponse, error) {
+func (u Uploader) initiateUpload(d destination.UploadData) (TUSResponse, error) {
+	conf := u.settings
+
+	name, err := d.Title(conf.UploadSettings.NameTemplate)
+	if err != nil {
+		return TUSResponse{}, err
+	}
+
+	description, err := d.Description(conf.UploadSettings.DescriptionTemplate)
+	if err != nil {
+		return TUSResponse{}, err
+	}
+
 	payload := UploadPayload{
-		Name:        d.Filename,
-		Description: d.VideoDescription,
+		Name:        name,
+		Description: description,
 		Password:    d.Password,
 		Privacy: Privacy{
 			Add:      conf.UploadSettings.Privacy.Add,
@@ -213,61 +244,13 @@ func initiateUpload(c httpCaller, d UploadData, conf Settings) (TUSResponse, err
 		},
 	}
 
-	bodyBytes, err := json.Marshal(payload)
-	if err != nil {
-		return TUSResponse{}, fmt.Errorf("unable to prepare video payload: %v", err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%v%v", uploadURI, uploadFilters), bytes.NewReader(bodyBytes))
+	var tResp TUSResponse
+	err = u.callAPI(http.MethodPost, uploadPath+uploadFilters, payload, &tResp)
 	if err != nil {
-		return TUSResponse{}, fmt.Errorf("error creating request: %v", err)
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/vnd.vimeo.*+json;version=3.4")
-	req.Header.Add("Authorization", fmt.Sprintf("bearer %v", conf.PersonalAccessToken))
-
-	retries := 0
-
-	for retries < 2 {
-		resp, err := c.Do(req)
-		if err != nil {
-			return TUSResponse{}, fmt.Errorf("error making post to vimeo upload URI: %v", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusTooManyRequests {
-			fmt.Println("rate limited, waiting for 60 seconds and trying again...")
-			time.Sleep(time.Second * 60) // TODO: calculate time remaining
-			retries++
-			continue
-		}
-
-		// TODO: add specific status code handling and unmarshalling.
-		if resp.StatusCode != http.StatusOK {
-			respBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return TUSResponse{}, fmt.Errorf("could not read initiation response bytes: %v", err)
-			}
-
-			return TUSResponse{}, fmt.Errorf("received status code %v with response body: %v", resp.StatusCode, string(respBytes))
-		}
-
-		respBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return TUSResponse{}, fmt.Errorf("could not read initiation response bytes: %v", err)
-		}
-
-		var tResp TUSResponse
-		err = json.Unmarshal(respBytes, &tResp)
-		if err != nil {
-			return TUSResponse{}, fmt.Errorf("could not unmarshal initiation response: %v", err)
-		}
-
-		return tResp, nil
+		return TUSResponse{}, fmt.Errorf("error initiating upload: %v", err)
 	}
 
-	return TUSResponse{}, errors.New("failed to upload three times, aborting...")
+	return tResp, nil
 }
 
 func getOffset(c httpCaller, tusURI string) (int64, error) {
@@ -325,7 +308,7 @@ func getOffset(c httpCaller, tusURI string) (int64, error) {
 	return -1, errors.New("unable to determine video offset")
 }
 
-func uploadFromOffset(c httpCaller, offset int64, tusURI, filePath string, chunkSizeMB int, fileSize int64) error {
+func uploadFromOffset(c httpCaller, offset int64, tusURI, filePath string, chunkSizeMB int, fileSize int64, progress *destination.Progress) error {
 	f, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("error opening file to upload: %v", err)
@@ -333,6 +316,7 @@ func uploadFromOffset(c httpCaller, offset int64, tusURI, filePath string, chunk
 	defer f.Close()
 
 	fmt.Printf("Uploading %v....\n", f.Name())
+	progress.Start(offset)
 	for offset < fileSize {
 		var payloadSize int64 = int64(chunkSizeMB) * 1000000
 		if (fileSize - offset) < payloadSize {
@@ -419,6 +403,7 @@ func uploadFromOffset(c httpCaller, offset int64, tusURI, filePath string, chunk
 		}
 
 		offset = newOffset
+		progress.Sent(offset)
 		percentUploaded := math.Floor((float64(newOffset) / float64(fileSize) * 100))
 
 		fmt.Printf("%v%% uploaded...", percentUploaded)
@@ -0,0 +1,320 @@
+package vimeo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nmalensek/video-uploader/internal/app/captions"
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// fakeVimeo implements the parts of Vimeo's API and upload endpoints used to upload and replace videos. tus upload
+// links are https://upload.test/tus/<n>, and files PUT to other upload.test links are accepted.
+type fakeVimeo struct {
+	// received are the bytes each upload link has received.
+	received map[string][]byte
+	// requests are the requests received, with the bodies of API calls but not of uploaded chunks.
+	requests []recordedRequest
+	// fail maps "METHOD path" to a status returned instead of handling matching requests.
+	fail map[string]int
+}
+
+func newFakeVimeo() *fakeVimeo {
+	return &fakeVimeo{received: map[string][]byte{}, fail: map[string]int{}}
+}
+
+func (f *fakeVimeo) Do(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+
+	path := req.URL.Path
+	if req.URL.RawQuery != "" {
+		path += "?" + req.URL.RawQuery
+	}
+
+	rr := recordedRequest{Method: req.Method, Path: path}
+	if req.URL.Host != "upload.test" {
+		rr.Body = string(body)
+	}
+	f.requests = append(f.requests, rr)
+
+	if status, ok := f.fail[req.Method+" "+req.URL.Path]; ok {
+		return response(status, nil, `{"error":"no"}`), nil
+	}
+
+	if req.URL.Host == "upload.test" {
+		if req.Method == http.MethodPut {
+			return response(http.StatusOK, nil, ""), nil
+		}
+		return f.tus(req, body), nil
+	}
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/videos/1/texttracks":
+		return response(http.StatusCreated, nil, `{"uri":"/texttracks/1","link":"https://upload.test/vtt/1"}`), nil
+	case req.Method == http.MethodPost && req.URL.Path == uploadPath:
+		return response(http.StatusOK, nil, `{"uri":"/videos/1","upload":{"upload_link":"`+f.newLink()+`"}}`), nil
+	case req.Method == http.MethodPost && req.URL.Path == "/videos/1/versions":
+		return response(http.StatusCreated, nil, `{"uri":"/videos/1/versions/9","upload":{"upload_link":"`+f.newLink()+`"}}`), nil
+	}
+
+	return response(http.StatusOK, nil, ""), nil
+}
+
+// newLink starts receiving a new upload.
+func (f *fakeVimeo) newLink() string {
+	link := fmt.Sprintf("https://upload.test/tus/%v", len(f.received)+1)
+	f.received[link] = []byte{}
+
+	return link
+}
+
+// tus answers offset checks and chunks sent to an upload link.
+func (f *fakeVimeo) tus(req *http.Request, body []byte) *http.Response {
+	link := req.URL.String()
+	got, ok := f.received[link]
+	if !ok {
+		return response(http.StatusNotFound, nil, "no such upload")
+	}
+
+	offset := http.Header{UploadOffset: []string{strconv.Itoa(len(got))}}
+
+	switch req.Method {
+	case http.MethodHead:
+		return response(http.StatusOK, offset, "")
+	case http.MethodPatch:
+		if req.Header.Get(UploadOffset) != strconv.Itoa(len(got)) {
+			return response(http.StatusConflict, offset, "")
+		}
+
+		f.received[link] = append(got, body...)
+		return response(http.StatusNoContent, http.Header{UploadOffset: []string{strconv.Itoa(len(f.received[link]))}}, "")
+	}
+
+	return response(http.StatusMethodNotAllowed, nil, "")
+}
+
+// newTestUpload writes a video file and returns upload data for it.
+func newTestUpload(t *testing.T, dir, filename string) destination.UploadData {
+	t.Helper()
+
+	video := []byte("not really a video")
+	path := filepath.Join(dir, filename)
+	err := os.WriteFile(path, video, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return destination.UploadData{
+		Filename:  filename,
+		FilePath:  path,
+		FileSize:  int64(len(video)),
+		ChunkSize: 1,
+	}
+}
+
+// calls returns the method and path of each request.
+func calls(requests []recordedRequest) []string {
+	var c []string
+	for _, r := range requests {
+		c = append(c, r.Method+" "+r.Path)
+	}
+
+	return c
+}
+
+// failingDB is a datastore that can't save records.
+type failingDB struct {
+	database.UploadDatastore
+	puts int
+}
+
+func (f *failingDB) PutUpload(database.UploadRecord) error {
+	f.puts++
+	return errors.New("disk full")
+}
+
+func TestUploader_Upload(t *testing.T) {
+	const create = "POST /me/videos?fields=name,description,upload,uri"
+
+	tests := []struct {
+		name string
+		// record is saved before uploading, if it isn't empty.
+		record     database.UploadRecord
+		textTracks bool
+		// fail is a request that fails during the first upload.
+		fail       string
+		want       []string
+		wantStatus database.UploadStatus
+		wantKind   database.ErrorKind
+		wantTusURI string
+		// retry are the requests of a second upload once fail no longer fails, if the first one failed.
+		retry []string
+	}{
+		{
+			name:       "new upload",
+			want:       []string{create, "PATCH /tus/1"},
+			wantStatus: database.Complete,
+			wantTusURI: "https://upload.test/tus/1",
+		},
+		{
+			name:       "create fails",
+			fail:       "POST /me/videos",
+			want:       []string{create},
+			wantStatus: database.Error,
+			wantKind:   database.ErrorKindCreate,
+			// Vimeo never created the video, so the upload starts over.
+			retry: []string{create, "PATCH /tus/1"},
+		},
+		{
+			name:       "transfer fails",
+			fail:       "PATCH /tus/1",
+			want:       []string{create, "PATCH /tus/1"},
+			wantStatus: database.Error,
+			wantKind:   database.ErrorKindTransfer,
+			wantTusURI: "https://upload.test/tus/1",
+			retry:      []string{"HEAD /tus/1", "PATCH /tus/1"},
+		},
+		{
+			name:       "resume fails",
+			record:     database.UploadRecord{Name: "Tap Week 1", Status: database.InProgress, TusURI: "https://upload.test/tus/expired", VideoURI: "https://vimeo.com/1"},
+			want:       []string{"HEAD /tus/expired"},
+			wantStatus: database.Error,
+			wantKind:   database.ErrorKindResume,
+			wantTusURI: "https://upload.test/tus/expired",
+		},
+		{
+			name:       "finish fails",
+			textTracks: true,
+			fail:       "POST /videos/1/texttracks",
+			want:       []string{create, "PATCH /tus/1", "POST /videos/1/texttracks"},
+			// the video exists, so only adding the text track is retried.
+			wantStatus: database.Complete,
+			wantKind:   database.ErrorKindFinish,
+			wantTusURI: "https://upload.test/tus/1",
+			retry:      []string{"POST /videos/1/texttracks", "PUT /vtt/1", "PATCH /texttracks/1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := filedb.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.record.IsEmpty() {
+				err = db.PutUpload(tt.record)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data := newTestUpload(t, dir, "Tap Week 1.mp4")
+			if tt.textTracks {
+				vtt := filepath.Join(dir, "Tap Week 1.vtt")
+				err = os.WriteFile(vtt, []byte("WEBVTT\n"), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data.TextTracks = []captions.TextTrack{{Path: vtt, Filename: "Tap Week 1.vtt", Language: "en", Kind: "captions"}}
+			}
+
+			api := newFakeVimeo()
+			if tt.fail != "" {
+				api.fail[tt.fail] = http.StatusInternalServerError
+			}
+			u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+			err = u.Upload(data)
+			if (err != nil) != (tt.wantKind != "") {
+				t.Fatalf("Upload() error = %v, want a %q error", err, tt.wantKind)
+			}
+
+			if diff := cmp.Diff(tt.want, calls(api.requests)); diff != "" {
+				t.Errorf("Upload() requests mismatch (-want +got):\n%s", diff)
+			}
+
+			r, err := db.GetUpload("Tap Week 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var kind database.ErrorKind
+			if r.ErrorDetails != nil {
+				kind = r.ErrorDetails.Kind
+			}
+			if r.Status != tt.wantStatus || kind != tt.wantKind || r.TusURI != tt.wantTusURI {
+				t.Errorf("Upload() record = %+v, want status %v, error kind %q, and tus URI %q", r, tt.wantStatus, tt.wantKind, tt.wantTusURI)
+			}
+
+			if tt.retry == nil {
+				return
+			}
+
+			delete(api.fail, tt.fail)
+			api.requests = nil
+			err = u.Upload(data)
+			if err != nil {
+				t.Fatalf("Upload() retry error = %v", err)
+			}
+
+			if diff := cmp.Diff(tt.retry, calls(api.requests)); diff != "" {
+				t.Errorf("Upload() retry requests mismatch (-want +got):\n%s", diff)
+			}
+
+			r, err = db.GetUpload("Tap Week 1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Status != database.Complete || r.ErrorDetails != nil || r.VideoURI != "https://vimeo.com/1" {
+				t.Errorf("Upload() record after retrying = %+v", r)
+			}
+
+			if !bytes.Equal(api.received[r.TusURI], []byte("not really a video")) {
+				t.Errorf("Upload() uploaded %q", api.received[r.TusURI])
+			}
+		})
+	}
+}
+
+func TestUploader_Upload_datastoreError(t *testing.T) {
+	dir := t.TempDir()
+	fdb, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &failingDB{UploadDatastore: fdb}
+
+	api := newFakeVimeo()
+	u := Uploader{client: api, uploadClient: api, uploadDB: db, tokens: oauth.StaticSource("token")}
+
+	err = u.Upload(newTestUpload(t, dir, "Tap Week 1.mp4"))
+	if err == nil {
+		t.Fatal("Upload() succeeded without saving the record")
+	}
+
+	// the upload stops before sending the file, and doesn't try to save the failure to the datastore that just failed.
+	if diff := cmp.Diff([]string{"POST /me/videos?fields=name,description,upload,uri"}, calls(api.requests)); diff != "" {
+		t.Errorf("Upload() requests mismatch (-want +got):\n%s", diff)
+	}
+
+	if db.puts != 1 {
+		t.Errorf("Upload() saved the record %v times, want 1", db.puts)
+	}
+}
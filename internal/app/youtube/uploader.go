@@ -0,0 +1,380 @@
+package youtube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+)
+
+// Settings contains the OAuth client and settings used for YouTube uploads.
+type Settings struct {
+	ClientID string `yaml:"client_id"`
+	// ClientSecret can be left empty and set with the YOUTUBE_CLIENT_SECRET environment variable instead.
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectPort is the local port for the login redirect, defaults to 8086.
+	RedirectPort int `yaml:"redirect_port"`
+	// TokenPath is where tokens are saved, defaults to youtube_token.json in the upload status folder.
+	TokenPath string `yaml:"token_path"`
+	// PrivacyStatus is private, unlisted, or public.
+	PrivacyStatus string `yaml:"privacy_status"`
+	CategoryID    string `yaml:"category_id"`
+	// PlaylistID is the playlist videos are added to if their class doesn't have a youtube_playlist_id.
+	PlaylistID string `yaml:"playlist_id"`
+	// NameTemplate and DescriptionTemplate are text/template strings rendered with metadata.VideoDetails.
+	NameTemplate        string   `yaml:"name_template"`
+	DescriptionTemplate string   `yaml:"description_template"`
+	Tags                []string `yaml:"tags"`
+}
+
+// Uploader uploads videos to YouTube with the resumable upload protocol.
+type Uploader struct {
+	// client is used for all HTTP calls except uploading video chunks.
+	client httpCaller
+	// uploadClient is used to upload video chunks so it has a long timeout property.
+	uploadClient httpCaller
+	settings     Settings
+	uploadDB     database.UploadDatastore
+	tokens       *oauth.Source
+}
+
+type httpCaller interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// VideoResource is the part of a YouTube video resource sent when creating a video.
+type VideoResource struct {
+	Snippet Snippet `json:"snippet"`
+	Status  Status  `json:"status"`
+}
+
+// Snippet contains a video's basic details.
+type Snippet struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags,omitempty"`
+	CategoryID  string   `json:"categoryId,omitempty"`
+}
+
+// Status contains a video's privacy settings.
+type Status struct {
+	PrivacyStatus           string `json:"privacyStatus"`
+	SelfDeclaredMadeForKids bool   `json:"selfDeclaredMadeForKids"`
+}
+
+// PlaylistItem is the payload used to add a video to a playlist.
+type PlaylistItem struct {
+	Snippet PlaylistItemSnippet `json:"snippet"`
+}
+
+// PlaylistItemSnippet identifies the playlist and video of a PlaylistItem.
+type PlaylistItemSnippet struct {
+	PlaylistID string     `json:"playlistId"`
+	ResourceID ResourceID `json:"resourceId"`
+}
+
+// ResourceID identifies a video.
+type ResourceID struct {
+	Kind    string `json:"kind"`
+	VideoID string `json:"videoId"`
+}
+
+const (
+	authorizeURI        = "https://accounts.google.com/o/oauth2/v2/auth"
+	tokenURI            = "https://oauth2.googleapis.com/token"
+	uploadURI           = "https://www.googleapis.com/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
+	playlistItemsURI    = "https://www.googleapis.com/youtube/v3/playlistItems?part=snippet"
+	videoURIPrefix      = "https://youtu.be/"
+	tokenFilename       = "youtube_token.json"
+	defaultRedirectPort = 8086
+	clientSecretEnv     = "YOUTUBE_CLIENT_SECRET"
+	// chunks must be a multiple of 256 KiB except for the last one.
+	chunkMultiple = 256 * 1024
+)
+
+// New creates a YouTube uploader that tracks uploads in db. OAuth tokens are saved to the output folder unless a
+// token path is configured.
+func New(outputFolderPath string, db database.UploadDatastore, hc httpCaller, uhc httpCaller, s Settings) (Uploader, error) {
+	if s.ClientID == "" {
+		return Uploader{}, errors.New("youtube_settings.client_id is required")
+	}
+
+	tokenPath := s.TokenPath
+	if tokenPath == "" {
+		tokenPath = filepath.Join(outputFolderPath, tokenFilename)
+	}
+
+	return Uploader{
+		client:       hc,
+		uploadClient: uhc,
+		settings:     s,
+		uploadDB:     db,
+		tokens:       oauth.NewSource(hc, s.oauthConfig(), oauth.FlowAuthorizationCode, oauth.NewFileStore(tokenPath), "run the login command"),
+	}, nil
+}
+
+func (s Settings) oauthConfig() oauth.Config {
+	secret := s.ClientSecret
+	if secret == "" {
+		secret = os.Getenv(clientSecretEnv)
+	}
+
+	port := s.RedirectPort
+	if port == 0 {
+		port = defaultRedirectPort
+	}
+
+	return oauth.Config{
+		ClientID:     s.ClientID,
+		ClientSecret: secret,
+		AuthURL:      authorizeURI,
+		TokenURL:     tokenURI,
+		Scopes:       []string{"https://www.googleapis.com/auth/youtube"},
+		RedirectPort: port,
+		// offline access is needed to get a refresh token.
+		AuthParams:        map[string]string{"access_type": "offline", "prompt": "consent"},
+		CredentialsInBody: true,
+	}
+}
+
+// Login runs the OAuth authorization code flow and saves the token. prompt is given the URL the user opens to
+// grant access.
+func (u Uploader) Login(prompt func(authURL string)) error {
+	t, err := oauth.AuthorizeCode(u.client, u.settings.oauthConfig(), prompt, time.Minute*5)
+	if err != nil {
+		return err
+	}
+
+	return u.tokens.SetToken(t)
+}
+
+func (u Uploader) Upload(data destination.UploadData) error {
+	// check for existing file in tracking file (failed initial upload case)
+	r, err := destination.FindRecord(u.uploadDB, data)
+	if err != nil {
+		fmt.Printf("WARN: error checking for prior upload, attempting upload. error: %v\n", err)
+	}
+
+	var uploadOffset int64
+
+	// a new upload, or an earlier attempt failed before the upload session was created.
+	if r.IsEmpty() || (r.Status == database.Error && r.TusURI == "") {
+		sessionURI, err := u.initiateUpload(data)
+		if err != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindCreate, err)
+		}
+
+		r.Name = data.Name()
+		r.CalculatedName = data.VideoName
+		r.Term = data.Term
+		r.Status = database.InProgress
+		r.TusURI = sessionURI
+
+		saveErr := u.uploadDB.PutUpload(r)
+		if saveErr != nil {
+			return fmt.Errorf("started upload but error saving initial data: %v\nupload session: %v", saveErr, r.TusURI)
+		}
+	} else {
+		if r.Status == database.Complete {
+			fmt.Printf("file %v was already uploaded, skipping...\n", data.Filename)
+			return u.finishUpload(r, data)
+		}
+
+		offset, videoID, oErr := u.session(r.TusURI, data).Offset(data.FileSize)
+		if oErr != nil {
+			return destination.SaveError(u.uploadDB, r, data, database.ErrorKindResume,
+				fmt.Errorf("could not get offset for video %v: %v", r.Name, oErr))
+		}
+
+		if videoID != "" {
+			return u.complete(r, data, videoID)
+		}
+
+		uploadOffset = offset
+	}
+
+	videoID, err := u.session(r.TusURI, data).Upload(uploadOffset, data)
+	if err != nil {
+		return destination.SaveError(u.uploadDB, r, data, database.ErrorKindTransfer,
+			fmt.Errorf("error uploading file %v: %v", data.Filename, err))
+	}
+
+	return u.complete(r, data, videoID)
+}
+
+// complete marks the record as uploaded and adds the video to its playlist.
+func (u Uploader) complete(r database.UploadRecord, data destination.UploadData, videoID string) error {
+	destination.Complete(u.uploadDB, &r, data, videoURIPrefix+videoID)
+	return u.finishUpload(r, data)
+}
+
+// finishUpload adds an uploaded video to its playlist, recording a failure on the record or clearing an earlier one.
+func (u Uploader) finishUpload(r database.UploadRecord, data destination.UploadData) error {
+	return destination.Finish(u.uploadDB, r, data, u.addToPlaylist)
+}
+
+// initiateUpload creates the video and returns the resumable upload session URI.
+func (u Uploader) initiateUpload(d destination.UploadData) (string, error) {
+	title, err := d.Title(u.settings.NameTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	description, err := d.Description(u.settings.DescriptionTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	privacy := u.settings.PrivacyStatus
+	if privacy == "" {
+		privacy = "private"
+	}
+
+	resp, err := u.call(http.MethodPost, uploadURI, VideoResource{
+		Snippet: Snippet{
+			Title:       title,
+			Description: description,
+			Tags:        u.settings.Tags,
+			CategoryID:  u.settings.CategoryID,
+		},
+		Status: Status{
+			PrivacyStatus: privacy,
+		},
+	}, map[string]string{
+		"X-Upload-Content-Length": fmt.Sprint(d.FileSize),
+		"X-Upload-Content-Type":   "video/*",
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("error initiating upload: %v", err)
+	}
+
+	sessionURI := resp.Header.Get("Location")
+	if sessionURI == "" {
+		return "", errors.New("upload initiation response did not include a session URI")
+	}
+
+	return sessionURI, nil
+}
+
+// session returns the resumable upload session for data's file.
+func (u Uploader) session(sessionURI string, data destination.UploadData) destination.ResumableSession {
+	chunkSize := int64(data.ChunkSize) * 1000000
+	chunkSize -= chunkSize % chunkMultiple
+	if chunkSize < chunkMultiple {
+		chunkSize = chunkMultiple
+	}
+
+	return destination.ResumableSession{
+		URI:          sessionURI,
+		Client:       u.client,
+		UploadClient: u.uploadClient,
+		ContentType:  "video/*",
+		ChunkSize:    chunkSize,
+		Destination:  "YouTube",
+		VideoID:      videoID,
+	}
+}
+
+// videoID reads the ID of the video resource returned once an upload finishes.
+func videoID(body []byte) string {
+	var v struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(body, &v) != nil {
+		return ""
+	}
+
+	return v.ID
+}
+
+// addToPlaylist adds the video to its class's playlist, or the default playlist, if it isn't in it already.
+func (u Uploader) addToPlaylist(r *database.UploadRecord, data destination.UploadData) error {
+	playlistID := data.Class.YouTubePlaylistID
+	if playlistID == "" {
+		playlistID = u.settings.PlaylistID
+	}
+
+	return destination.AddToPlaylist(u.uploadDB, r, data, playlistID, func() error {
+		_, err := u.call(http.MethodPost, playlistItemsURI, PlaylistItem{
+			Snippet: PlaylistItemSnippet{
+				PlaylistID: playlistID,
+				ResourceID: ResourceID{
+					Kind:    "youtube#video",
+					VideoID: strings.TrimPrefix(r.VideoURI, videoURIPrefix),
+				},
+			},
+		}, nil, nil)
+		return err
+	})
+}
+
+// call makes an authorized JSON request, renewing the token once if it's rejected. The response is returned with
+// its body already read and closed; if out is not nil the body is unmarshaled into it.
+func (u Uploader) call(method, uri string, payload interface{}, headers map[string]string, out interface{}) (*http.Response, error) {
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare request payload: %v", err)
+	}
+
+	renewed := false
+	for {
+		token, err := u.tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("could not get access token: %v", err)
+		}
+
+		req, err := http.NewRequest(method, uri, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+
+		req.Header.Add("Content-Type", "application/json; charset=UTF-8")
+		req.Header.Add("Authorization", "Bearer "+token)
+		for k, v := range headers {
+			req.Header.Add(k, v)
+		}
+
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error making %v request: %v", method, err)
+		}
+
+		respBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read response bytes: %v", err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !renewed {
+			renewed = true
+			err = u.tokens.Renew()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("received status code %v with response body: %v", resp.StatusCode, string(respBytes))
+		}
+
+		if out != nil {
+			err = json.Unmarshal(respBytes, out)
+			if err != nil {
+				return nil, fmt.Errorf("could not unmarshal response: %v", err)
+			}
+		}
+
+		return resp, nil
+	}
+}
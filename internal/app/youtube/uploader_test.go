@@ -0,0 +1,238 @@
+package youtube_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nmalensek/video-uploader/internal/app/database"
+	"github.com/nmalensek/video-uploader/internal/app/database/filedb"
+	"github.com/nmalensek/video-uploader/internal/app/destination"
+	"github.com/nmalensek/video-uploader/internal/app/metadata"
+	"github.com/nmalensek/video-uploader/internal/app/oauth"
+	"github.com/nmalensek/video-uploader/internal/app/youtube"
+)
+
+// fakeYouTube implements the parts of the OAuth token endpoint, resumable upload endpoint, and playlistItems API
+// the uploader uses.
+type fakeYouTube struct {
+	t   *testing.T
+	url string
+
+	mu        sync.Mutex
+	validTok  string
+	metadata  youtube.VideoResource
+	received  []byte
+	size      int64
+	failChunk int
+	chunks    int
+	playlists []string
+}
+
+func (f *fakeYouTube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "refresh_token" || r.PostForm.Get("client_id") != "client" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		f.validTok = "fresh"
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "fresh", "expires_in": 3600})
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/upload/session/") {
+		f.session(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+f.validTok {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/youtube/v3/videos":
+		if r.URL.Query().Get("uploadType") != "resumable" {
+			http.Error(w, "expected resumable upload", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&f.metadata)
+		f.size, _ = strconv.ParseInt(r.Header.Get("X-Upload-Content-Length"), 10, 64)
+		w.Header().Set("Location", f.url+"/upload/session/1")
+	case r.Method == http.MethodPost && r.URL.Path == "/youtube/v3/playlistItems":
+		var item youtube.PlaylistItem
+		json.NewDecoder(r.Body).Decode(&item)
+		f.playlists = append(f.playlists, item.Snippet.PlaylistID+"/"+item.Snippet.ResourceID.VideoID)
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// session handles PUTs to the upload session, either status checks or chunks.
+func (f *fakeYouTube) session(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rng := r.Header.Get("Content-Range")
+
+	if !strings.HasPrefix(rng, "bytes */") {
+		f.chunks++
+		if f.chunks == f.failChunk {
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+			return
+		}
+
+		var start, end, total int64
+		fmt.Sscanf(rng, "bytes %d-%d/%d", &start, &end, &total)
+		if start != int64(len(f.received)) || end-start+1 != int64(len(body)) || total != f.size {
+			f.t.Errorf("unexpected Content-Range %v with %v bytes, have %v bytes", rng, len(body), len(f.received))
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		f.received = append(f.received, body...)
+	}
+
+	if int64(len(f.received)) == f.size {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"vid123"}`))
+		return
+	}
+
+	if len(f.received) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%v", len(f.received)-1))
+	}
+	w.WriteHeader(308)
+}
+
+// rewriteTransport sends every request to the fake server regardless of host.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestUploader_Upload(t *testing.T) {
+	fake := &fakeYouTube{t: t, validTok: "expired-on-server", failChunk: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.url = srv.URL
+
+	target, _ := url.Parse(srv.URL)
+	statuses := destination.NewStatusRecorder(rewriteTransport{target: target})
+	cl := &http.Client{Transport: statuses}
+
+	dir := t.TempDir()
+
+	// a saved token that the server rejects, so the uploader has to refresh it.
+	err := oauth.NewFileStore(filepath.Join(dir, "youtube_token.json")).Save(oauth.Token{AccessToken: "stale", RefreshToken: "refresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	video := make([]byte, 600*1024)
+	rand.Read(video)
+	videoPath := filepath.Join(dir, "Tap Week 1.mp4")
+	err = os.WriteFile(videoPath, video, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := filedb.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	yt, err := youtube.New(dir, db, cl, cl, youtube.Settings{
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		PrivacyStatus: "unlisted",
+		PlaylistID:    "default-list",
+		NameTemplate:  "{{.Name}} ({{.Term}})",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := destination.RecordAttempts(yt, db, "", statuses)
+
+	data := destination.UploadData{
+		Filename:         "Tap Week 1.mp4",
+		VideoTitle:       "Tap Week 1.mp4",
+		VideoDescription: "Tap Week 1",
+		Details:          metadata.VideoDetails{Name: "Tap Week 1", Term: "2023 Spring"},
+		Class:            metadata.Class{Name: "Tap", YouTubePlaylistID: "tap-list"},
+		FilePath:         videoPath,
+		FileSize:         int64(len(video)),
+	}
+
+	// the second chunk fails, leaving the upload resumable with the failure recorded.
+	err = u.Upload(data)
+	if err == nil {
+		t.Fatal("Upload() expected the failed chunk to return an error")
+	}
+
+	r, err := db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Error || r.TusURI != srv.URL+"/upload/session/1" {
+		t.Fatalf("Upload() record after failure = %+v", r)
+	}
+
+	if d := r.ErrorDetails; d == nil || d.Kind != database.ErrorKindTransfer || d.HTTPStatus != http.StatusServiceUnavailable ||
+		d.Offset != 256*1024 || d.OccurredAt.IsZero() {
+		t.Errorf("Upload() error details after failure = %+v", r.ErrorDetails)
+	}
+
+	// running again resumes from what the server received.
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(fake.received, video) {
+		t.Errorf("Upload() server received %v bytes that don't match the %v byte file", len(fake.received), len(video))
+	}
+
+	if fake.metadata.Snippet.Title != "Tap Week 1 (2023 Spring)" || fake.metadata.Status.PrivacyStatus != "unlisted" {
+		t.Errorf("Upload() video metadata = %+v", fake.metadata)
+	}
+
+	r, err = db.GetUpload("Tap Week 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Status != database.Complete || r.VideoURI != "https://youtu.be/vid123" || r.ErrorDetails != nil {
+		t.Errorf("Upload() record after finishing = %+v", r)
+	}
+
+	// uploading again is a no-op, the video is only added to the class playlist once.
+	err = u.Upload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.playlists) != 1 || fake.playlists[0] != "tap-list/vid123" {
+		t.Errorf("Upload() playlist additions = %v, want [tap-list/vid123]", fake.playlists)
+	}
+}